@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// openCommandStore opens and initializes the store configured to be used by a command. It returns the store and a
+// function that closes it
+func openCommandStore(cfg *config.Config) (db.Store, func(), error) {
+	if cfg.Store == "memory" {
+		return nil, nil, errors.New("the commands can't be used with the memory store, since all the data is lost when the program finishes")
+	}
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		if err == bolt.ErrTimeout {
+			return nil, nil, errors.New("error opening the DB: it's being used by a running server, stop it or use its API with -remote")
+		}
+
+		return nil, nil, fmt.Errorf("error opening the DB: %v", err)
+	}
+
+	closeFn := func() {
+		if err := closeStore(); err != nil {
+			fmt.Fprintf(os.Stderr, "error closing the DB connection: %v\n", err)
+		}
+	}
+
+	if err := store.Initialize(); err != nil {
+		closeFn()
+		return nil, nil, fmt.Errorf("error initializing the DB: %v", err)
+	}
+
+	return store, closeFn, nil
+}
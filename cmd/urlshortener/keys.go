@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// keysUsage is the usage of the keys command
+const keysUsage = `usage: urlshortener [flags] keys add <name>
+       urlshortener [flags] keys list
+       urlshortener [flags] keys delete <name>`
+
+// runKeys manages the API keys of the store configured. It returns the exit code of the program
+func runKeys(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+
+	store, closeStore, err := openCommandStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+
+	keys, ok := store.(db.KeyStore)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "the %s store doesn't support API keys\n", cfg.Store)
+		return 1
+	}
+
+	switch {
+	case args[0] == "add" && len(args) == 2:
+		key, err := keys.AddKey(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error adding the API key: %v\n", err)
+			return 1
+		}
+
+		fmt.Fprintln(os.Stderr, "Store the API key in a safe place, it's not going to be shown again:")
+		fmt.Println(key)
+
+	case args[0] == "list" && len(args) == 1:
+		list, err := keys.ListKeys()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error listing the API keys: %v\n", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPREFIX\tCREATED")
+		for _, k := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", k.Name, k.Prefix, k.CreatedAt.Format(time.RFC3339))
+		}
+
+		if err := w.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "error listing the API keys: %v\n", err)
+			return 1
+		}
+
+	case args[0] == "delete" && len(args) == 2:
+		if err := keys.DeleteKey(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error deleting the API key: %v\n", err)
+			return 1
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/bulk"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/client"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// linksUsage is the usage of the commands that manage the links
+const linksUsage = `usage: urlshortener [flags] add [-short <shortURL>] [-expires-in <duration>] [-max-clicks <n>] [-redirect-status <code>] <longURL>
+       urlshortener [flags] get <shortURL>
+       urlshortener [flags] delete <shortURL>
+       urlshortener [flags] list
+       urlshortener [flags] export [-format csv|jsonl] > links.jsonl
+       urlshortener [flags] import [-format csv|jsonl] [-conflict skip|overwrite|fail] [-dry-run] [-chunk-size <n>] [file]
+       urlshortener [flags] stats [shortURL]
+       urlshortener [flags] audit [-short <shortURL>] [-actor <actor>] [-action <action>] [-since <date>] [-until <date>] [-limit <n>] > audit.jsonl`
+
+// linkStore are the operations over the links used by the commands. It's implemented by db.Store, when the store is
+// opened directly, and by client.Client, when the commands use the API of a running URL shortener
+type linkStore interface {
+	ReadLink(shortURL string) (*db.Link, error)
+	ListURLs() ([]db.Link, error)
+	WalkURLs(fn func(l db.Link) error) error
+	AddLink(l *db.Link) error
+	ImportLinks(links []db.Link, opts db.ImportOptions) ([]db.ImportResult, error)
+	DeleteURL(shortURL string) error
+	Stats() (*db.Stats, error)
+	Clicks(shortURL string) (*db.ClickStats, error)
+	WalkAudit(f db.AuditFilter, fn func(e db.AuditEntry) error) error
+}
+
+// openLinks returns the links of the URL shortener configured. If the remote URL is set, its API is used. Otherwise,
+// the store is opened, which needs the server to be stopped when using the bolt store, and the changes are recorded
+// in its audit log on behalf of the user running the command. It returns a function that closes the store
+func openLinks(cfg *config.Config) (linkStore, func(), error) {
+	if cfg.Remote != "" {
+		return &client.Client{
+			URL:    cfg.Remote,
+			APIKey: cfg.APIKey,
+		}, func() {}, nil
+	}
+
+	store, closeStore, err := openCommandStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auditLog, ok := store.(db.AuditLog)
+	if !ok {
+		closeStore()
+		return nil, nil, fmt.Errorf("the %s store doesn't keep an audit log", cfg.Store)
+	}
+
+	return &db.Audited{Store: store, Log: auditLog, Actor: commandActor()}, closeStore, nil
+}
+
+// commandActor returns who runs the commands, as it's recorded in the audit log
+func commandActor() string {
+	u, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+
+	return "cli:" + u.Username
+}
+
+// runLinksCommand runs one of the commands that manage the links. It returns the exit code of the program
+func runLinksCommand(run func(links linkStore, args []string) error) func(cfg *config.Config, args []string) int {
+	return func(cfg *config.Config, args []string) int {
+		links, closeLinks, err := openLinks(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer closeLinks()
+
+		if err := run(links, args); err != nil {
+			if err == flag.ErrHelp {
+				fmt.Fprintln(os.Stderr, linksUsage)
+				return 2
+			}
+
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		return 0
+	}
+}
+
+// runAdd adds a new link and prints its short URL
+func runAdd(links linkStore, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	shortURL := fs.String("short", "", "short URL of the link. If it's empty, a random one is generated")
+	expiresIn := fs.Duration("expires-in", 0, "duration after which the link expires")
+	maxClicks := fs.Int("max-clicks", 0, "number of clicks after which the link expires")
+	redirectStatus := fs.Int("redirect-status", 0, "status code of the redirects of the link. If it's 0, the default one is used")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return flag.ErrHelp
+	}
+
+	l := &db.Link{
+		ShortURL:  *shortURL,
+		LongURL:   fs.Arg(0),
+		MaxClicks: *maxClicks,
+
+		RedirectStatus: *redirectStatus,
+	}
+
+	if *expiresIn != 0 {
+		expiresAt := time.Now().Add(*expiresIn)
+		l.ExpiresAt = &expiresAt
+	}
+
+	if err := links.AddLink(l); err != nil {
+		return fmt.Errorf("error adding the link: %v", err)
+	}
+
+	fmt.Println(l.ShortURL)
+
+	return nil
+}
+
+// runGet prints a link as JSON
+func runGet(links linkStore, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+
+	l, err := links.ReadLink(args[0])
+	if err != nil {
+		return fmt.Errorf("error reading the link: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(l)
+}
+
+// runDelete removes a link
+func runDelete(links linkStore, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+
+	if err := links.DeleteURL(args[0]); err != nil {
+		return fmt.Errorf("error deleting the link: %v", err)
+	}
+
+	return nil
+}
+
+// runList prints all the links
+func runList(links linkStore, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+
+	list, err := links.ListURLs()
+	if err != nil {
+		return fmt.Errorf("error listing the links: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SHORT URL\tLONG URL\tOWNER\tEXPIRES")
+	for _, l := range list {
+		expires := ""
+		if l.ExpiresAt != nil {
+			expires = l.ExpiresAt.Format(time.RFC3339)
+		}
+
+		if l.MaxClicks > 0 {
+			expires = strings.TrimSpace(fmt.Sprintf("%s %d clicks", expires, l.MaxClicks))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.ShortURL, l.LongURL, l.Owner, expires)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error listing the links: %v", err)
+	}
+
+	return nil
+}
+
+// runExport prints all the links, while they are read
+func runExport(links linkStore, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", string(bulk.FormatJSONL), "format of the file: csv or jsonl")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return flag.ErrHelp
+	}
+
+	w, err := bulk.NewWriter(os.Stdout, bulk.Format(*format))
+	if err != nil {
+		return err
+	}
+
+	n, err := bulk.Export(links, w)
+	if err != nil {
+		return fmt.Errorf("error exporting the links: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d links\n", n)
+
+	return nil
+}
+
+// runImport imports the links of a file or of the standard input, in chunks. The rows that aren't imported are
+// reported with their line, and the rest of the rows are still imported unless the conflict policy is fail
+func runImport(links linkStore, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", string(bulk.FormatJSONL), "format of the file: csv, json or jsonl")
+	conflict := fs.String("conflict", string(db.ConflictSkip), "what to do with the links that already exist: skip, overwrite or fail")
+	dryRun := fs.Bool("dry-run", false, "validate the links and check the conflicts without importing them")
+	chunkSize := fs.Int("chunk-size", bulk.DefaultChunkSize, "number of links imported at once")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return flag.ErrHelp
+	}
+
+	in := os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("error opening the file: %v", err)
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	r, err := bulk.NewReader(in, bulk.Format(*format))
+	if err != nil {
+		return err
+	}
+
+	opts := bulk.Options{
+		ImportOptions: db.ImportOptions{
+			Conflict: db.ConflictPolicy(*conflict),
+			DryRun:   *dryRun,
+		},
+		ChunkSize: *chunkSize,
+	}
+
+	summary, err := bulk.Import(links, r, opts, func(res bulk.Result) {
+		if res.Status == db.ImportCreated || res.Status == db.ImportOverwritten {
+			return
+		}
+
+		msg := fmt.Sprintf("line %d: %s", res.Line, res.Status)
+		if res.ShortURL != "" {
+			msg = fmt.Sprintf("line %d: %s %s", res.Line, res.ShortURL, res.Status)
+		}
+
+		if res.Error != "" {
+			msg += ": " + res.Error
+		}
+
+		fmt.Fprintln(os.Stderr, msg)
+	})
+
+	prefix := "Imported"
+	if *dryRun {
+		prefix = "Dry run, nothing has been imported"
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %d created, %d overwritten, %d skipped, %d invalid\n", prefix,
+		summary[db.ImportCreated], summary[db.ImportOverwritten], summary[db.ImportSkipped], summary[db.ImportInvalid])
+
+	if err != nil {
+		return fmt.Errorf("error importing the links: %v", err)
+	}
+
+	if summary[db.ImportInvalid] > 0 {
+		return fmt.Errorf("%d links are invalid", summary[db.ImportInvalid])
+	}
+
+	return nil
+}
+
+// runStats prints the statistics of the store or, if a short URL is provided, the click statistics of the link
+func runStats(links linkStore, args []string) error {
+	switch len(args) {
+	case 0:
+		stats, err := links.Stats()
+		if err != nil {
+			return fmt.Errorf("error getting the statistics: %v", err)
+		}
+
+		fmt.Printf("Links: %d\n", stats.Links)
+
+	case 1:
+		stats, err := links.Clicks(args[0])
+		if err != nil {
+			return fmt.Errorf("error getting the statistics: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Clicks:\t%d\n", stats.Total)
+
+		fmt.Fprintln(w, "\nDAY\tCLICKS")
+		for _, d := range stats.PerDay {
+			fmt.Fprintf(w, "%s\t%d\n", d.Day, d.Clicks)
+		}
+
+		fmt.Fprintln(w, "\nREFERRER\tCLICKS")
+		for _, r := range stats.TopReferrers {
+			fmt.Fprintf(w, "%s\t%d\n", r.Referrer, r.Clicks)
+		}
+
+		fmt.Fprintln(w, "\nCOUNTRY\tCLICKS")
+		for _, c := range stats.TopCountries {
+			fmt.Fprintf(w, "%s\t%d\n", c.Country, c.Clicks)
+		}
+
+		return w.Flush()
+
+	default:
+		return flag.ErrHelp
+	}
+
+	return nil
+}
+
+// runAudit prints the entries of the audit log as JSON Lines, from the oldest to the newest
+func runAudit(links linkStore, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	shortURL := fs.String("short", "", "only the entries of a short URL")
+	actor := fs.String("actor", "", "only the entries of an actor (e.g. user:nefix or key:deploy)")
+	action := fs.String("action", "", "only the entries of an action: create, update, delete, disable, enable or expire")
+	since := fs.String("since", "", "only the entries since a date, in RFC 3339 format")
+	until := fs.String("until", "", "only the entries before a date, in RFC 3339 format")
+	limit := fs.Int("limit", 0, "maximum number of entries")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return flag.ErrHelp
+	}
+
+	f := db.AuditFilter{
+		ShortURL: *shortURL,
+		Actor:    *actor,
+		Action:   db.AuditAction(*action),
+		Limit:    *limit,
+	}
+
+	var err error
+	if *since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+			return fmt.Errorf("invalid -since date: %v", err)
+		}
+	}
+
+	if *until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+			return fmt.Errorf("invalid -until date: %v", err)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if err := links.WalkAudit(f, func(e db.AuditEntry) error {
+		return enc.Encode(e)
+	}); err != nil {
+		return fmt.Errorf("error reading the audit log: %v", err)
+	}
+
+	return nil
+}
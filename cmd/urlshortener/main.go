@@ -1,68 +1,338 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	_ "github.com/lib/pq"
 	bolt "go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
 
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/analytics"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/logging"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/metrics"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
 )
 
-type logWriter struct {
-	File *os.File
+// commands are the commands of the program, besides serve, that is the default one
+var commands = map[string]func(cfg *config.Config, args []string) int{
+	"keys":   runKeys,
+	"users":  runUsers,
+	"add":    runLinksCommand(runAdd),
+	"get":    runLinksCommand(runGet),
+	"delete": runLinksCommand(runDelete),
+	"list":   runLinksCommand(runList),
+	"export": runLinksCommand(runExport),
+	"import": runLinksCommand(runImport),
+	"stats":  runLinksCommand(runStats),
+	"audit":  runLinksCommand(runAudit),
 }
 
-func (w *logWriter) Write(b []byte) (int, error) {
-	fmt.Print(string(b[:]))
+func main() {
+	// Load the configuration
+	cfg, args, err := config.LoadCommand(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
 
-	return w.File.Write(b)
-}
+		log.Fatalf("error loading the configuration: %v", err)
+	}
 
-func main() {
-	// Configure the logging
-	f, err := os.OpenFile("urlshortener.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if len(args) > 0 && args[0] != "serve" {
+		command, ok := commands[args[0]]
+		if !ok {
+			log.Fatalf("unknown command %s", args[0])
+		}
+
+		os.Exit(command(cfg, args[1:]))
+	}
+
+	if len(args) > 1 {
+		log.Fatalf("unexpected arguments: %s", strings.Join(args[1:], " "))
+	}
+
+	// Configure the logging. The configuration has already been validated
+	logOpts, err := cfg.Logging()
 	if err != nil {
-		log.Fatalf("error opening log file: %v", err)
+		log.Fatalf("error configuring the logging: %v", err)
 	}
-	defer func() {
-		if err = f.Close(); err != nil {
+
+	logger, logFile, err := logging.New(logOpts)
+	if err != nil {
+		log.Fatalf("error configuring the logging: %v", err)
+	}
+
+	slog.SetDefault(logger)
+
+	// Reopen the log file when receiving a SIGHUP signal, so it can be rotated by external tools like logrotate
+	stopReopen := func() {}
+	if logFile != nil {
+		stopReopen = reopenOnSIGHUP(logFile)
+	}
+
+	exitCode := run(cfg, logger)
+
+	// The log file is the last thing that gets closed, so everything can be logged until the end
+	stopReopen()
+	slog.SetDefault(slog.New(logging.NewHandler(os.Stderr, logOpts)))
+	if logFile != nil {
+		if err := logFile.Close(); err != nil {
 			log.Fatalf("error closing the log file: %v", err)
 		}
+	}
+
+	os.Exit(exitCode)
+}
+
+// reopenOnSIGHUP reopens the log file every time a SIGHUP signal is received. It returns a function that stops it
+func reopenOnSIGHUP(f *logging.File) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for range signals {
+			if err := f.Reopen(); err != nil {
+				slog.Error("error reopening the log file", "err", err)
+				continue
+			}
+
+			slog.Info("Reopened the log file")
+		}
 	}()
 
-	w := &logWriter{
-		File: f,
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+		<-done
 	}
+}
 
-	log.SetOutput(w)
-
+// run opens the store and serves the HTTP servers until one of them fails or a SIGINT or SIGTERM signal is received.
+// When stopping, the connections are drained before closing the store. It returns the exit code of the program
+func run(cfg *config.Config, logger *slog.Logger) int {
 	// Open the DB and initialize it
-	var boltDB *bolt.DB
-	boltDB, err = bolt.Open("urlshortener.db", 0600, nil)
+	store, closeStore, err := openStore(cfg)
 	if err != nil {
-		log.Fatalf("error opening the DB: %v", err)
+		slog.Error("error opening the DB", "err", err)
+		return 1
 	}
 	defer func() {
-		if err = boltDB.Close(); err != nil {
-			log.Fatalf("error closing the DB connection: %v", err)
+		if err := closeStore(); err != nil {
+			slog.Error("error closing the DB connection", "err", err)
 		}
 	}()
 
-	db := &db.DB{
-		DB: boltDB,
+	if err := store.Initialize(); err != nil {
+		slog.Error("error initializing the DB", "err", err)
+		return 1
+	}
+
+	// Collect the metrics of the requests and of the store. The store used by the handler counts its events
+	var m *metrics.Metrics
+	handlerStore := store
+	if cfg.Metrics {
+		dbPath := ""
+		if cfg.Store == "bolt" {
+			dbPath = cfg.BoltPath
+		}
+
+		m = metrics.New(store, dbPath)
+		if boltDB, ok := store.(*db.DB); ok {
+			boltDB.ObserveTx = m.ObserveTx
+		}
+
+		handlerStore = &metrics.Store{Store: store, Metrics: m}
 	}
 
-	if err := db.Initialize(); err != nil {
-		log.Fatalf("error initializing the DB: %v", err)
+	// Start recording the hits. The pending hits are recorded after draining the connections and before closing the DB
+	recorder := analytics.NewRecorder(store, analytics.DefaultBufferSize, analytics.DefaultBatchSize, analytics.DefaultFlushInterval)
+	defer recorder.Close()
+
+	// Record all the changes of the links in the audit log
+	auditLog, ok := store.(db.AuditLog)
+	if !ok {
+		slog.Error("the store doesn't keep an audit log", "store", cfg.Store)
+		return 1
 	}
 
-	// Start the HTTP server
-	log.Println("Starting to listen at port :3000")
-	if err := http.ListenAndServe(":3000", handler.Default(db)); err != nil {
-		log.Fatalf("error listening: %v", err)
+	// Remove the expired shortened URLs periodically
+	if cfg.JanitorInterval > 0 {
+		janitor := db.NewJanitor(&db.Audited{Store: store, Log: auditLog, Actor: "janitor"}, cfg.JanitorInterval)
+		defer janitor.Close()
+	}
+
+	opts := handler.Options{
+		Recorder:       recorder,
+		Audit:          auditLog,
+		RedirectStatus: cfg.RedirectStatus,
+		PublicURL:      cfg.PublicURL,
+		QR:             qr.NewGenerator(cfg.QR(), cfg.QRCacheSize),
+	}
+
+	if m != nil {
+		opts.Metrics = m
+		if cfg.MetricsAddr == "" {
+			opts.MetricsHandler = m.Handler()
+		}
+	}
+
+	if cfg.Auth {
+		keys, ok := store.(db.KeyStore)
+		if !ok {
+			slog.Error("the store doesn't support API keys", "store", cfg.Store)
+			return 1
+		}
+
+		users, ok := store.(db.UserStore)
+		if !ok {
+			slog.Error("the store doesn't support users", "store", cfg.Store)
+			return 1
+		}
+
+		opts.Keys = keys
+		opts.Users = users
+
+		if cfg.Store == "memory" {
+			slog.Warn("The API keys and the users can't be added to the memory store, so no links can be created unless the authentication is disabled with -auth=false")
+		}
+	} else {
+		slog.Warn("The authentication is disabled, anyone can create, update and delete links")
+	}
+
+	// Start the HTTP servers
+	servers := []*http.Server{{
+		Addr:         cfg.Addr,
+		Handler:      handler.AccessLog(handler.New(handlerStore, opts), logger),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}}
+
+	if m != nil && cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+
+		servers = append(servers, &http.Server{
+			Addr:         cfg.MetricsAddr,
+			Handler:      mux,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		})
+	}
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			slog.Info("Starting to listen", "addr", srv.Addr)
+			errs <- srv.ListenAndServe()
+		}(srv)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		slog.Error("error listening", "err", err)
+		closeServers(servers)
+		return 1
+
+	case sig := <-signals:
+		slog.Info("Received a signal, draining the connections", "signal", sig.String(), "timeout", cfg.ShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	exitCode := 0
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("error draining the connections, closing them", "addr", srv.Addr, "err", err)
+
+			if err := srv.Close(); err != nil {
+				slog.Error("error closing the connections", "addr", srv.Addr, "err", err)
+			}
+
+			exitCode = 1
+		}
+	}
+
+	if exitCode == 0 {
+		slog.Info("Stopped listening")
+	}
+
+	return exitCode
+}
+
+// closeServers closes the HTTP servers that are still listening, without draining their connections
+func closeServers(servers []*http.Server) {
+	for _, srv := range servers {
+		if err := srv.Close(); err != nil {
+			slog.Error("error closing the connections", "addr", srv.Addr, "err", err)
+		}
+	}
+}
+
+// boltTimeout is the maximum duration to wait for the lock of the Bolt DB file, that is held by the running servers
+const boltTimeout = time.Second
+
+// openStore opens the store configured. It returns the store and a function that closes it
+func openStore(cfg *config.Config) (db.Store, func() error, error) {
+	switch cfg.Store {
+	case "bolt":
+		boltDB, err := bolt.Open(cfg.BoltPath, 0600, &bolt.Options{Timeout: boltTimeout})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &db.DB{
+			DB:        boltDB,
+			Generator: cfg.Generator(),
+			Policy:    cfg.CodePolicy(),
+		}, boltDB.Close, nil
+
+	case "sql":
+		sqlDB, err := sql.Open(cfg.SQLDialect, cfg.SQLDSN)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// SQLite only allows one writer at a time
+		if cfg.SQLDialect == db.DialectSQLite {
+			sqlDB.SetMaxOpenConns(1)
+		}
+
+		return &db.SQL{
+			DB:        sqlDB,
+			Dialect:   cfg.SQLDialect,
+			Generator: cfg.Generator(),
+			Policy:    cfg.CodePolicy(),
+		}, sqlDB.Close, nil
+
+	default:
+		slog.Warn("Using the memory store, all the URLs are going to be lost when stopping the program")
+
+		return &db.Memory{
+			Generator: cfg.Generator(),
+			Policy:    cfg.CodePolicy(),
+		}, func() error { return nil }, nil
 	}
 }
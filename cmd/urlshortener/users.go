@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// usersUsage is the usage of the users command
+const usersUsage = `usage: urlshortener [flags] users add [-admin] <username> [namespace]
+       urlshortener [flags] users list
+       urlshortener [flags] users delete <username>`
+
+// runUsers manages the users of the store configured. It returns the exit code of the program
+func runUsers(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usersUsage)
+		return 2
+	}
+
+	store, closeStore, err := openCommandStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeStore()
+
+	users, ok := store.(db.UserStore)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "the %s store doesn't support users\n", cfg.Store)
+		return 1
+	}
+
+	switch {
+	case args[0] == "add":
+		fs := flag.NewFlagSet("users add", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		admin := fs.Bool("admin", false, "the user can manage all the links")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+			fmt.Fprintln(os.Stderr, usersUsage)
+			return 2
+		}
+
+		u := &db.User{
+			Username:  fs.Arg(0),
+			Namespace: fs.Arg(1),
+			Admin:     *admin,
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading the password: %v\n", err)
+			return 1
+		}
+
+		if err := users.AddUser(u, password); err != nil {
+			fmt.Fprintf(os.Stderr, "error adding the user: %v\n", err)
+			return 1
+		}
+
+	case args[0] == "list" && len(args) == 1:
+		list, err := users.ListUsers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error listing the users: %v\n", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tNAMESPACE\tADMIN\tCREATED")
+		for _, u := range list {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", u.Username, u.Namespace, u.Admin, u.CreatedAt.Format(time.RFC3339))
+		}
+
+		if err := w.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "error listing the users: %v\n", err)
+			return 1
+		}
+
+	case args[0] == "delete" && len(args) == 2:
+		if err := users.DeleteUser(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error deleting the user: %v\n", err)
+			return 1
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, usersUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// readPassword reads the password of an user. If the standard input is a terminal, the password isn't shown while
+// it's typed. Otherwise, it's read from the first line of the standard input
+func readPassword() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		defer fmt.Fprintln(os.Stderr)
+
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
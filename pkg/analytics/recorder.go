@@ -0,0 +1,119 @@
+package analytics
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+const (
+	// DefaultBufferSize is the number of hits that can be waiting to be recorded
+	DefaultBufferSize = 10000
+
+	// DefaultBatchSize is the maximum number of hits that are recorded at the same time
+	DefaultBatchSize = 100
+
+	// DefaultFlushInterval is the maximum time that a hit waits before being recorded
+	DefaultFlushInterval = time.Second
+)
+
+// Recorder records the hits of the shortened URLs asynchronously, so the redirects aren't slowed down by the writes
+// to the store. The hits are recorded in batches, when the batch is full or when the flush interval passes
+type Recorder struct {
+	store         db.Store
+	batchSize     int
+	flushInterval time.Duration
+
+	hits   chan db.Hit
+	done   chan struct{}
+	mux    sync.RWMutex
+	closed bool
+}
+
+// NewRecorder creates a new recorder and starts recording the hits in the background. It needs to be closed in
+// order to record the pending hits
+func NewRecorder(store db.Store, bufferSize, batchSize int, flushInterval time.Duration) *Recorder {
+	r := &Recorder{
+		store:         store,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+
+		hits: make(chan db.Hit, bufferSize),
+		done: make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// Record queues a hit to be recorded. It never blocks: if the buffer is full or the recorder is closed, the hit is
+// discarded
+func (r *Recorder) Record(h db.Hit) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.hits <- h:
+	default:
+		slog.Warn("The analytics buffer is full, discarding a hit", "shortURL", h.ShortURL)
+	}
+}
+
+// Close stops the recorder after recording all the pending hits
+func (r *Recorder) Close() {
+	r.mux.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.hits)
+	}
+	r.mux.Unlock()
+
+	<-r.done
+}
+
+// run records the hits in batches until the recorder is closed
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]db.Hit, 0, r.batchSize)
+	for {
+		select {
+		case h, ok := <-r.hits:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+
+			batch = append(batch, h)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush records a batch of hits in the store
+func (r *Recorder) flush(batch []db.Hit) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := r.store.RecordHits(batch); err != nil {
+		slog.Error("error recording the hits", "hits", len(batch), "err", err)
+	}
+}
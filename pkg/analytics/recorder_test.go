@@ -0,0 +1,109 @@
+package analytics_test
+
+import (
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/analytics"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should record all the pending hits when closing
+func TestRecorder(t *testing.T) {
+	store := &db.Memory{}
+	if err := store.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := store.AddURL("git", "https://gitea.nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	r := analytics.NewRecorder(store, 100, 2, time.Hour)
+	for i := 0; i < 5; i++ {
+		r.Record(db.Hit{ShortURL: "git", Time: time.Now()})
+	}
+
+	r.Close()
+
+	stats, err := store.Clicks("git")
+	if err != nil {
+		t.Fatalf("unexpected error getting the clicks: %v", err)
+	}
+
+	if stats.Total != 5 {
+		t.Errorf("expecting %d, but got %d", 5, stats.Total)
+	}
+}
+
+// Should record the hits when the flush interval passes
+func TestRecorderFlushInterval(t *testing.T) {
+	store := &db.Memory{}
+	if err := store.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := store.AddURL("git", "https://gitea.nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	r := analytics.NewRecorder(store, 100, 100, 10*time.Millisecond)
+	defer r.Close()
+
+	r.Record(db.Hit{ShortURL: "git", Time: time.Now()})
+
+	for i := 0; i < 100; i++ {
+		stats, err := store.Clicks("git")
+		if err != nil {
+			t.Fatalf("unexpected error getting the clicks: %v", err)
+		}
+
+		if stats.Total == 1 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("expecting the hit to be recorded after the flush interval")
+}
+
+// Should discard the hits when the buffer is full instead of blocking
+func TestRecorderBufferFull(t *testing.T) {
+	store := &db.Memory{}
+	if err := store.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r := analytics.NewRecorder(store, 0, 100, time.Hour)
+	defer r.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			r.Record(db.Hit{ShortURL: "git", Time: time.Now()})
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expecting Record to never block")
+	}
+}
+
+// Should discard the hits recorded after closing
+func TestRecorderClosed(t *testing.T) {
+	store := &db.Memory{}
+	if err := store.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r := analytics.NewRecorder(store, 100, 100, time.Hour)
+	r.Close()
+	r.Close()
+
+	r.Record(db.Hit{ShortURL: "git", Time: time.Now()})
+}
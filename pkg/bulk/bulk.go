@@ -0,0 +1,216 @@
+package bulk
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Format is the format of the files with shortened URLs that are imported and exported
+type Format string
+
+const (
+	// FormatCSV is CSV with a header. The columns are short_url, long_url, expires_at, max_clicks, owner, disabled,
+	// created_at and redirect_status, and only long_url is required when importing
+	FormatCSV Format = "csv"
+	// FormatJSONL is JSON Lines, with one shortened URL per line using the same fields as the API and createdAt
+	FormatJSONL Format = "jsonl"
+	// FormatJSON is a JSON array of shortened URLs, with the same fields as JSON Lines. It can only be imported, and
+	// the line of each row is its position in the array
+	FormatJSON Format = "json"
+)
+
+// DefaultChunkSize is the number of shortened URLs imported at once by default
+const DefaultChunkSize = 500
+
+// ErrFormatInvalid is returned when the format isn't csv, json or jsonl
+var ErrFormatInvalid = errors.New("the format needs to be csv, json or jsonl")
+
+// ReadError is returned when the rows of a file can't be read anymore (e.g. because the file isn't valid JSON), so the
+// rest of the rows can't be imported
+type ReadError struct {
+	Err error
+}
+
+// Error returns the reason why the file can't be read
+func (e *ReadError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the reason why the file can't be read
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Record is a shortened URL as it's imported and exported. Unlike db.Link, it has its creation time
+type Record struct {
+	ShortURL  string     `json:"shortURL"`
+	LongURL   string     `json:"longURL"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	MaxClicks int        `json:"maxClicks,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	Disabled  bool       `json:"disabled,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+}
+
+// NewRecord returns the record of a shortened URL
+func NewRecord(l db.Link) Record {
+	r := Record{
+		ShortURL:  l.ShortURL,
+		LongURL:   l.LongURL,
+		ExpiresAt: l.ExpiresAt,
+		MaxClicks: l.MaxClicks,
+		Owner:     l.Owner,
+		Disabled:  l.Disabled,
+
+		RedirectStatus: l.RedirectStatus,
+	}
+
+	if !l.CreatedAt.IsZero() {
+		createdAt := l.CreatedAt
+		r.CreatedAt = &createdAt
+	}
+
+	return r
+}
+
+// Link returns the shortened URL of the record
+func (r Record) Link() db.Link {
+	l := db.Link{
+		ShortURL:  r.ShortURL,
+		LongURL:   r.LongURL,
+		ExpiresAt: r.ExpiresAt,
+		MaxClicks: r.MaxClicks,
+		Owner:     r.Owner,
+		Disabled:  r.Disabled,
+
+		RedirectStatus: r.RedirectStatus,
+	}
+
+	if r.CreatedAt != nil {
+		l.CreatedAt = *r.CreatedAt
+	}
+
+	return l
+}
+
+// Importer imports batches of shortened URLs. It's implemented by db.Store
+type Importer interface {
+	ImportLinks(links []db.Link, opts db.ImportOptions) ([]db.ImportResult, error)
+}
+
+// Walker walks all the shortened URLs. It's implemented by db.Store
+type Walker interface {
+	WalkURLs(fn func(l db.Link) error) error
+}
+
+// Options are the options of an import
+type Options struct {
+	db.ImportOptions
+	// ChunkSize is the number of shortened URLs imported at once. If it's 0, DefaultChunkSize is used
+	ChunkSize int
+}
+
+// Result is the result of importing a row
+type Result struct {
+	// Line is the line of the row in the file
+	Line int `json:"line"`
+	db.ImportResult
+}
+
+// Summary is the number of rows of an import with each status
+type Summary map[db.ImportStatus]int
+
+// Import reads all the rows and imports them in chunks. The result of each row is passed to the report function as
+// soon as its chunk is imported. The rows that can't be read are reported as invalid. If an error is returned (e.g.
+// a conflict with db.ConflictFail, or a ReadError), the import stops and the chunk where it happened isn't imported
+func Import(store Importer, r *Reader, opts Options, report func(res Result)) (Summary, error) {
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+
+	summary := Summary{}
+	add := func(res Result) {
+		summary[res.Status]++
+		if report != nil {
+			report(res)
+		}
+	}
+
+	lines := make([]int, 0, size)
+	links := make([]db.Link, 0, size)
+
+	flush := func() error {
+		if len(links) == 0 {
+			return nil
+		}
+
+		results, err := store.ImportLinks(links, opts.ImportOptions)
+		for i, res := range results {
+			// If there's an error, nothing of the chunk has been written
+			if err != nil && (res.Status == db.ImportCreated || res.Status == db.ImportOverwritten) {
+				continue
+			}
+
+			add(Result{Line: lines[i], ImportResult: res})
+		}
+
+		lines = lines[:0]
+		links = links[:0]
+
+		return err
+	}
+
+	for {
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return summary, &ReadError{err}
+		}
+
+		if row.Err != nil {
+			add(Result{
+				Line:         row.Line,
+				ImportResult: db.ImportResult{ShortURL: row.Record.ShortURL, Status: db.ImportInvalid, Error: row.Err.Error()},
+			})
+			continue
+		}
+
+		lines = append(lines, row.Line)
+		links = append(links, row.Record.Link())
+
+		if len(links) == size {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	return summary, flush()
+}
+
+// Export writes all the shortened URLs while they are walked, and returns the number of shortened URLs written
+func Export(store Walker, w *Writer) (int, error) {
+	n := 0
+	if err := store.WalkURLs(func(l db.Link) error {
+		if err := w.Write(NewRecord(l)); err != nil {
+			return err
+		}
+
+		n++
+
+		return nil
+	}); err != nil {
+		return n, err
+	}
+
+	return n, w.Flush()
+}
@@ -0,0 +1,185 @@
+package bulk_test
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/bulk"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should export and import the links without changing them
+func TestExportImport(t *testing.T) {
+	for _, f := range []bulk.Format{bulk.FormatCSV, bulk.FormatJSONL} {
+		t.Run(string(f), func(t *testing.T) {
+			src := &db.Memory{}
+			if err := src.Initialize(); err != nil {
+				t.Fatalf("error initializing the DB: %v", err)
+			}
+
+			expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+			links := []db.Link{
+				{ShortURL: "blog", LongURL: "https://nefixestrada.com", ExpiresAt: &expiresAt, CreatedAt: createdAt, RedirectStatus: http.StatusMovedPermanently},
+				{ShortURL: "go", LongURL: "https://golang.org", MaxClicks: 10, Disabled: true, CreatedAt: createdAt},
+			}
+
+			for i := range links {
+				if err := src.AddLink(&links[i]); err != nil {
+					t.Fatalf("error preparing the test: %v", err)
+				}
+			}
+
+			var buf bytes.Buffer
+			w, err := bulk.NewWriter(&buf, f)
+			if err != nil {
+				t.Fatalf("unexpected error creating the writer: %v", err)
+			}
+
+			n, err := bulk.Export(src, w)
+			if err != nil {
+				t.Fatalf("unexpected error exporting the links: %v", err)
+			}
+
+			if n != 2 {
+				t.Errorf("expecting %d, but got %d", 2, n)
+			}
+
+			dst := &db.Memory{}
+			if err := dst.Initialize(); err != nil {
+				t.Fatalf("error initializing the DB: %v", err)
+			}
+
+			r, err := bulk.NewReader(&buf, f)
+			if err != nil {
+				t.Fatalf("unexpected error creating the reader: %v", err)
+			}
+
+			summary, err := bulk.Import(dst, r, bulk.Options{}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error importing the links: %v", err)
+			}
+
+			if summary[db.ImportCreated] != 2 {
+				t.Errorf("expecting %d, but got %d", 2, summary[db.ImportCreated])
+			}
+
+			imported, err := dst.ListURLs()
+			if err != nil {
+				t.Fatalf("unexpected error listing the links: %v", err)
+			}
+
+			if !reflect.DeepEqual(imported, links) {
+				t.Errorf("expecting %v, but got %v", links, imported)
+			}
+		})
+	}
+}
+
+// Should report the rows that can't be imported with their line, and import the rest of them in chunks
+func TestImportReport(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	csv := `short_url,long_url,max_clicks
+blog,https://blog.nefixestrada.com,
+go,https://golang.org,ten
+git,https://gitea.nefixestrada.com,
+bad,notanurl,
+docs,https://golang.org/doc,5
+`
+
+	r, err := bulk.NewReader(strings.NewReader(csv), bulk.FormatCSV)
+	if err != nil {
+		t.Fatalf("unexpected error creating the reader: %v", err)
+	}
+
+	results := map[int]db.ImportStatus{}
+	summary, err := bulk.Import(d, r, bulk.Options{ChunkSize: 2}, func(res bulk.Result) {
+		results[res.Line] = res.Status
+	})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	expected := map[int]db.ImportStatus{
+		2: db.ImportSkipped,
+		3: db.ImportInvalid,
+		4: db.ImportCreated,
+		5: db.ImportInvalid,
+		6: db.ImportCreated,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expecting %v, but got %v", expected, results)
+	}
+
+	expectedSummary := bulk.Summary{db.ImportSkipped: 1, db.ImportInvalid: 2, db.ImportCreated: 2}
+	if !reflect.DeepEqual(summary, expectedSummary) {
+		t.Errorf("expecting %v, but got %v", expectedSummary, summary)
+	}
+}
+
+// Should return an error when the CSV header doesn't have the long URL
+func TestNewReaderErr(t *testing.T) {
+	if _, err := bulk.NewReader(strings.NewReader("short_url,url\n"), bulk.FormatCSV); err == nil {
+		t.Errorf("expecting an error, but got nil")
+	}
+
+	if _, err := bulk.NewReader(strings.NewReader(""), "xml"); err != bulk.ErrFormatInvalid {
+		t.Errorf("expecting %v, but got %v", bulk.ErrFormatInvalid, err)
+	}
+}
+
+// Should read the JSON arrays one element at a time, stopping at the elements that aren't valid JSON
+func TestImportJSON(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r, err := bulk.NewReader(strings.NewReader(`[
+		{"shortURL": "go", "longURL": "https://golang.org"},
+		{"shortURL": "docs", "longURL": "https://golang.org/doc", "maxClicks": "ten"},
+		{"shortURL": "blog", "longURL": "https://nefixestrada.com"},
+		{"shortURL": "git", "longURL": }
+	]`), bulk.FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error creating the reader: %v", err)
+	}
+
+	results := map[int]db.ImportStatus{}
+	_, err = bulk.Import(d, r, bulk.Options{ChunkSize: 2}, func(res bulk.Result) {
+		results[res.Line] = res.Status
+	})
+	if _, ok := err.(*bulk.ReadError); !ok {
+		t.Errorf("expecting a read error, but got %v", err)
+	}
+
+	// The first chunk is imported before reading the last element
+	expected := map[int]db.ImportStatus{
+		1: db.ImportCreated,
+		2: db.ImportInvalid,
+		3: db.ImportCreated,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expecting %v, but got %v", expected, results)
+	}
+
+	if _, err := bulk.NewReader(strings.NewReader(`{"shortURL": "go"}`), bulk.FormatJSON); err == nil {
+		t.Errorf("expecting an error, but got nil")
+	}
+
+	if _, err := bulk.NewWriter(&bytes.Buffer{}, bulk.FormatJSON); err == nil {
+		t.Errorf("expecting an error, but got nil")
+	}
+}
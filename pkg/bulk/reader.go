@@ -0,0 +1,228 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns are the columns of the CSV files, in the order they are exported
+var csvColumns = []string{"short_url", "long_url", "expires_at", "max_clicks", "owner", "disabled", "created_at", "redirect_status"}
+
+// maxLineSize is the maximum size of a line of a JSON Lines file
+const maxLineSize = 1024 * 1024
+
+// Row is a row read from a file
+type Row struct {
+	// Line is the line of the row in the file
+	Line   int
+	Record Record
+	// Err is the reason why the row couldn't be read. The rest of the rows can still be read
+	Err error
+}
+
+// Reader reads the shortened URLs of a file one row at a time, so the file isn't loaded in memory at once
+type Reader struct {
+	format Format
+
+	csv     *csv.Reader
+	columns map[string]int
+
+	scanner *bufio.Scanner
+	line    int
+
+	json *json.Decoder
+}
+
+// NewReader returns a reader of the file with the format provided. The header of the CSV files is read and checked
+func NewReader(r io.Reader, f Format) (*Reader, error) {
+	switch f {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+
+		header, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("the CSV file needs to have a header")
+			}
+
+			return nil, fmt.Errorf("error reading the CSV header: %v", err)
+		}
+
+		columns := map[string]int{}
+		for i, c := range header {
+			columns[strings.ToLower(strings.TrimSpace(c))] = i
+		}
+
+		if _, ok := columns["long_url"]; !ok {
+			return nil, errors.New("the CSV file needs to have a long_url column")
+		}
+
+		return &Reader{format: f, csv: cr, columns: columns}, nil
+
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+		return &Reader{format: f, scanner: scanner}, nil
+
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, errors.New("the JSON file needs to be an array of links")
+		}
+
+		return &Reader{format: f, json: dec}, nil
+
+	default:
+		return nil, ErrFormatInvalid
+	}
+}
+
+// Read returns the next row of the file. At the end of the file, it returns io.EOF
+func (r *Reader) Read() (*Row, error) {
+	switch r.format {
+	case FormatCSV:
+		return r.readCSV()
+
+	case FormatJSON:
+		return r.readJSON()
+
+	default:
+		return r.readJSONL()
+	}
+}
+
+// readCSV returns the next row of a CSV file
+func (r *Reader) readCSV() (*Row, error) {
+	fields, err := r.csv.Read()
+	if err != nil {
+		if pErr, ok := err.(*csv.ParseError); ok {
+			return &Row{Line: pErr.StartLine, Err: pErr.Err}, nil
+		}
+
+		return nil, err
+	}
+
+	line, _ := r.csv.FieldPos(0)
+	row := &Row{Line: line}
+
+	field := func(name string) string {
+		i, ok := r.columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+
+		return strings.TrimSpace(fields[i])
+	}
+
+	row.Record = Record{
+		ShortURL: field("short_url"),
+		LongURL:  field("long_url"),
+		Owner:    field("owner"),
+	}
+
+	if row.Record.ExpiresAt, err = parseTime(field("expires_at")); err != nil {
+		row.Err = fmt.Errorf("invalid expires_at: %v", err)
+		return row, nil
+	}
+
+	if row.Record.CreatedAt, err = parseTime(field("created_at")); err != nil {
+		row.Err = fmt.Errorf("invalid created_at: %v", err)
+		return row, nil
+	}
+
+	if val := field("max_clicks"); val != "" {
+		if row.Record.MaxClicks, err = strconv.Atoi(val); err != nil {
+			row.Err = fmt.Errorf("invalid max_clicks: %q isn't a number", val)
+			return row, nil
+		}
+	}
+
+	if val := field("disabled"); val != "" {
+		if row.Record.Disabled, err = strconv.ParseBool(val); err != nil {
+			row.Err = fmt.Errorf("invalid disabled: %q isn't a boolean", val)
+			return row, nil
+		}
+	}
+
+	if val := field("redirect_status"); val != "" {
+		if row.Record.RedirectStatus, err = strconv.Atoi(val); err != nil {
+			row.Err = fmt.Errorf("invalid redirect_status: %q isn't a number", val)
+			return row, nil
+		}
+	}
+
+	return row, nil
+}
+
+// readJSONL returns the next row of a JSON Lines file. The empty lines are ignored
+func (r *Reader) readJSONL() (*Row, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		if strings.TrimSpace(r.scanner.Text()) == "" {
+			continue
+		}
+
+		row := &Row{Line: r.line}
+		if err := json.Unmarshal(r.scanner.Bytes(), &row.Record); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %v", err)
+		}
+
+		return row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// readJSON returns the next element of a JSON array, decoding only that element. The elements with fields of the
+// wrong type are returned with the error, but the rest of the errors mean that the array can't be read anymore
+func (r *Reader) readJSON() (*Row, error) {
+	if !r.json.More() {
+		if _, err := r.json.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		return nil, io.EOF
+	}
+
+	r.line++
+	row := &Row{Line: r.line}
+
+	if err := r.json.Decode(&row.Record); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		row.Err = fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	return row, nil
+}
+
+// parseTime parses a time of a CSV file, using RFC 3339. If it's empty, it returns nil
+func parseTime(val string) (*time.Time, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, fmt.Errorf("%q isn't a RFC 3339 date", val)
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,91 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Writer writes shortened URLs to a file one row at a time
+type Writer struct {
+	csv *csv.Writer
+
+	buf  *bufio.Writer
+	json *json.Encoder
+}
+
+// NewWriter returns a writer of a file with the format provided. The header of the CSV files is written
+func NewWriter(w io.Writer, f Format) (*Writer, error) {
+	switch f {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+
+		return &Writer{csv: cw}, nil
+
+	case FormatJSONL:
+		buf := bufio.NewWriter(w)
+
+		return &Writer{buf: buf, json: json.NewEncoder(buf)}, nil
+
+	case FormatJSON:
+		return nil, errors.New("the JSON arrays can only be imported, the links are exported as jsonl")
+
+	default:
+		return nil, ErrFormatInvalid
+	}
+}
+
+// Write writes a row
+func (w *Writer) Write(r Record) error {
+	if w.csv == nil {
+		return w.json.Encode(r)
+	}
+
+	maxClicks := ""
+	if r.MaxClicks != 0 {
+		maxClicks = strconv.Itoa(r.MaxClicks)
+	}
+
+	redirectStatus := ""
+	if r.RedirectStatus != 0 {
+		redirectStatus = strconv.Itoa(r.RedirectStatus)
+	}
+
+	return w.csv.Write([]string{
+		r.ShortURL,
+		r.LongURL,
+		formatTime(r.ExpiresAt),
+		maxClicks,
+		r.Owner,
+		strconv.FormatBool(r.Disabled),
+		formatTime(r.CreatedAt),
+		redirectStatus,
+	})
+}
+
+// Flush writes the rows that are buffered
+func (w *Writer) Flush() error {
+	if w.csv == nil {
+		return w.buf.Flush()
+	}
+
+	w.csv.Flush()
+
+	return w.csv.Error()
+}
+
+// formatTime formats a time of a CSV file, using RFC 3339. If it's nil, it returns an empty string
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/bulk"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// DefaultTimeout is the timeout of the requests when the HTTP client isn't set
+const DefaultTimeout = 30 * time.Second
+
+// Error is an error returned by the API of the URL shortener
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Client is a client of the JSON REST API of a running URL shortener. Its methods are named like the ones of db.Store,
+// so the links can be managed the same way remotely and opening the store
+type Client struct {
+	// URL is the URL of the URL shortener (e.g. https://short.nefixestrada.com)
+	URL string
+	// APIKey is the API key sent in the requests. If it's empty, the requests aren't authenticated
+	APIKey string
+	// HTTPClient is the HTTP client used to send the requests. If it's nil, a client with DefaultTimeout is used
+	HTTPClient *http.Client
+}
+
+// ReadLink returns a shortened URL, even if it has expired or it's disabled
+func (c *Client) ReadLink(shortURL string) (*db.Link, error) {
+	var l db.Link
+	if err := c.do(http.MethodGet, linkPath(shortURL), nil, &l); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// ListURLs returns all the shortened URLs that the API key can access, sorted by the short URL
+func (c *Client) ListURLs() ([]db.Link, error) {
+	links := []db.Link{}
+	if err := c.do(http.MethodGet, "/api/v1/links", nil, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// WalkURLs calls the function provided with each shortened URL that the API key can access, sorted by the short URL,
+// until it returns an error
+func (c *Client) WalkURLs(fn func(l db.Link) error) error {
+	links, err := c.ListURLs()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range links {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportLinks imports a batch of shortened URLs at once, and returns the result of each one of them
+func (c *Client) ImportLinks(links []db.Link, opts db.ImportOptions) ([]db.ImportResult, error) {
+	records := make([]bulk.Record, len(links))
+	for i, l := range links {
+		records[i] = bulk.NewRecord(l)
+	}
+
+	q := url.Values{}
+	q.Set("conflict", string(opts.Conflict))
+	q.Set("dryRun", strconv.FormatBool(opts.DryRun))
+
+	results := []db.ImportResult{}
+	if err := c.do(http.MethodPost, "/api/v1/import?"+q.Encode(), records, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// AddLink adds a new shortened URL. If the short URL is empty, the one generated is set in the link
+func (c *Client) AddLink(l *db.Link) error {
+	return c.do(http.MethodPost, "/api/v1/links", l, l)
+}
+
+// DeleteURL removes a shortened URL
+func (c *Client) DeleteURL(shortURL string) error {
+	return c.do(http.MethodDelete, linkPath(shortURL), nil, nil)
+}
+
+// Stats returns statistics of the store of the URL shortener
+func (c *Client) Stats() (*db.Stats, error) {
+	var stats db.Stats
+	if err := c.do(http.MethodGet, "/api/v1/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// Clicks returns the click statistics of a shortened URL
+func (c *Client) Clicks(shortURL string) (*db.ClickStats, error) {
+	var stats db.ClickStats
+	if err := c.do(http.MethodGet, linkPath(shortURL)+"/clicks", nil, &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// History returns the previous targets of a shortened URL, from the oldest to the newest
+func (c *Client) History(shortURL string) ([]db.TargetChange, error) {
+	history := []db.TargetChange{}
+	if err := c.do(http.MethodGet, linkPath(shortURL)+"/history", nil, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest to
+// the newest, until it returns an error. Only the API keys and the admins can read it
+func (c *Client) WalkAudit(f db.AuditFilter, fn func(e db.AuditEntry) error) error {
+	q := url.Values{}
+	if f.ShortURL != "" {
+		q.Set("shortURL", f.ShortURL)
+	}
+
+	if f.Actor != "" {
+		q.Set("actor", f.Actor)
+	}
+
+	if f.Action != "" {
+		q.Set("action", string(f.Action))
+	}
+
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339))
+	}
+
+	if !f.Until.IsZero() {
+		q.Set("until", f.Until.Format(time.RFC3339))
+	}
+
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	entries := []db.AuditEntry{}
+	if err := c.do(http.MethodGet, "/api/v1/audit?"+q.Encode(), nil, &entries); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkPath returns the path of a shortened URL in the API. Each part of the short URL is escaped, so the short URLs
+// inside a namespace keep their '/'
+func linkPath(shortURL string) string {
+	parts := strings.Split(shortURL, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+
+	return "/api/v1/links/" + strings.Join(parts, "/")
+}
+
+// do sends a request to the API with the body encoded as JSON, and decodes the response into out if it's not nil.
+// The errors returned by the API are returned as *Error
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error *Error `json:"error"`
+		}
+
+		if err := json.NewDecoder(rsp.Body).Decode(&apiErr); err != nil || apiErr.Error == nil {
+			return &Error{Status: rsp.StatusCode, Message: fmt.Sprintf("unexpected response from the API: %s", rsp.Status)}
+		}
+
+		return apiErr.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
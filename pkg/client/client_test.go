@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/client"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should work as expected
+func TestClient(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	key, err := d.AddKey("test")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	srv := httptest.NewServer(handler.New(d, handler.Options{Keys: d}))
+	defer srv.Close()
+
+	c := &client.Client{URL: srv.URL + "/", APIKey: key}
+
+	l := &db.Link{ShortURL: "blog", LongURL: "https://nefixestrada.com"}
+	if err := c.AddLink(l); err != nil {
+		t.Fatalf("unexpected error adding the link: %v", err)
+	}
+
+	generated := &db.Link{LongURL: "https://golang.org"}
+	if err := c.AddLink(generated); err != nil {
+		t.Fatalf("unexpected error adding the link: %v", err)
+	}
+
+	if generated.ShortURL == "" {
+		t.Errorf("expecting the short URL to be generated")
+	}
+
+	rsp, err := c.ReadLink("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if rsp.LongURL != l.LongURL {
+		t.Errorf("expecting %s, but got %s", l.LongURL, rsp.LongURL)
+	}
+
+	links, err := c.ListURLs()
+	if err != nil {
+		t.Fatalf("unexpected error listing the links: %v", err)
+	}
+
+	if len(links) != 2 {
+		t.Errorf("expecting %d, but got %d", 2, len(links))
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("unexpected error getting the stats: %v", err)
+	}
+
+	if stats.Links != 2 {
+		t.Errorf("expecting %d, but got %d", 2, stats.Links)
+	}
+
+	clicks, err := c.Clicks("blog")
+	if err != nil {
+		t.Fatalf("unexpected error getting the clicks: %v", err)
+	}
+
+	if clicks.ShortURL != "blog" {
+		t.Errorf("expecting %s, but got %s", "blog", clicks.ShortURL)
+	}
+
+	history, err := c.History("blog")
+	if err != nil {
+		t.Fatalf("unexpected error getting the history: %v", err)
+	}
+
+	if len(history) != 0 {
+		t.Errorf("expecting %d, but got %d", 0, len(history))
+	}
+
+	if err := c.DeleteURL("blog"); err != nil {
+		t.Fatalf("unexpected error deleting the link: %v", err)
+	}
+
+	_, err = c.ReadLink("blog")
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		t.Fatalf("expecting *client.Error, but got %v", err)
+	}
+
+	if apiErr.Status != http.StatusNotFound || apiErr.Message != db.ErrNotFound.Error() {
+		t.Errorf("expecting %d %s, but got %d %s", http.StatusNotFound, db.ErrNotFound, apiErr.Status, apiErr.Message)
+	}
+}
+
+// Should return the authentication errors of the API
+func TestClientUnauthorized(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	srv := httptest.NewServer(handler.New(d, handler.Options{Keys: d}))
+	defer srv.Close()
+
+	c := &client.Client{URL: srv.URL, APIKey: "invalid"}
+
+	err := c.AddLink(&db.Link{LongURL: "https://nefixestrada.com"})
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		t.Fatalf("expecting *client.Error, but got %v", err)
+	}
+
+	if apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("expecting %d, but got %d", http.StatusUnauthorized, apiErr.Status)
+	}
+}
@@ -0,0 +1,452 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/logging"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
+)
+
+// EnvPrefix is the prefix of the environment variables used to configure the URL shortener
+const EnvPrefix = "URLSHORTENER_"
+
+// Config is the configuration of the URL shortener. Each option can be set (from lowest to highest precedence) in
+// the configuration file, with an environment variable or with a flag. The key in the configuration file is the name
+// of the flag with underscores instead of dashes, and the environment variable is the same key in upper case prefixed
+// with URLSHORTENER_ (e.g. the flag -log-file is log_file in the file and URLSHORTENER_LOG_FILE in the environment)
+type Config struct {
+	// Addr is the address where the HTTP server listens
+	Addr string `yaml:"addr"`
+	// PublicURL is the base URL where the URL shortener is reachable, used to build the full short links. If it's
+	// empty, they are built with the scheme and the host of each request
+	PublicURL string `yaml:"public_url"`
+	// LogFile is the path of the log file. If it's empty, the logs aren't written to a file
+	LogFile string `yaml:"log_file"`
+	// LogStdout is whether the logs are written to the standard output
+	LogStdout bool `yaml:"log_stdout"`
+	// LogFormat is the format of the logs: text (logfmt) or json
+	LogFormat string `yaml:"log_format"`
+	// LogLevel is the minimum level of the logs written: debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+	// LogMaxSize is the size in megabytes after which the log file is rotated. If it's 0, it isn't rotated by size
+	LogMaxSize int `yaml:"log_max_size"`
+	// LogMaxAge is the duration after which the log file is rotated. If it's 0, it isn't rotated by time
+	LogMaxAge time.Duration `yaml:"log_max_age"`
+	// LogMaxBackups is the number of rotated log files kept. If it's 0, all of them are kept
+	LogMaxBackups int `yaml:"log_max_backups"`
+	// LogCompress is whether the rotated log files are compressed with gzip
+	LogCompress bool `yaml:"log_compress"`
+
+	// ReadTimeout is the maximum duration for reading an entire request
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout is the maximum duration before timing out the writes of a response
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout is the maximum duration to wait for the next request when keep-alives are enabled
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is the maximum duration to wait for the connections to be drained when stopping
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Store is the storage backend used: bolt, sql or memory
+	Store string `yaml:"store"`
+	// BoltPath is the path of the Bolt DB file, used with the bolt store
+	BoltPath string `yaml:"bolt_path"`
+	// SQLDialect is the SQL database used with the sql store: sqlite or postgres
+	SQLDialect string `yaml:"sql_dialect"`
+	// SQLDSN is the data source name of the SQL database used with the sql store
+	SQLDSN string `yaml:"sql_dsn"`
+
+	// CodeAlphabet are the characters used when generating short URLs. If it's empty, base62 is used, or base36 if
+	// the short URLs are case insensitive
+	CodeAlphabet string `yaml:"code_alphabet"`
+	// CodeLength is the length of the generated short URLs
+	CodeLength int `yaml:"code_length"`
+	// CodeSymbols are the characters allowed in the short URLs besides the letters, the digits and the '/' of the
+	// namespaces
+	CodeSymbols string `yaml:"code_symbols"`
+	// CodeUnicode is whether the letters and the digits of all the scripts are allowed in the short URLs
+	CodeUnicode bool `yaml:"code_unicode"`
+	// CodeMinLength is the minimum length of the short URLs
+	CodeMinLength int `yaml:"code_min_length"`
+	// CodeMaxLength is the maximum length of the short URLs
+	CodeMaxLength int `yaml:"code_max_length"`
+	// CodeCaseInsensitive is whether the short URLs are matched without case
+	CodeCaseInsensitive bool `yaml:"code_case_insensitive"`
+	// CodeAllowConfusables is whether the short URLs can have characters that can be confused with other ones
+	CodeAllowConfusables bool `yaml:"code_allow_confusables"`
+
+	// RedirectStatus is the status code of the redirects of the shortened URLs that don't set one: 301, 302, 307 or 308
+	RedirectStatus int `yaml:"redirect_status"`
+
+	// QRSize is the size in pixels of the QR codes of the shortened URLs that don't set one
+	QRSize int `yaml:"qr_size"`
+	// QRLevel is the error correction level of the QR codes that don't set one: L, M, Q or H
+	QRLevel string `yaml:"qr_level"`
+	// QRMargin is the margin in modules of the QR codes that don't set one
+	QRMargin int `yaml:"qr_margin"`
+	// QRCacheSize is the number of QR codes kept in memory. If it's 0, they aren't cached
+	QRCacheSize int `yaml:"qr_cache_size"`
+
+	// Auth is whether an user or an API key is required to create, update, delete and list links
+	Auth bool `yaml:"auth"`
+
+	// JanitorInterval is how often the expired shortened URLs are removed. If it's 0, they are never removed
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+
+	// Metrics is whether the Prometheus metrics are served at /metrics. They are disabled by default, because they
+	// are served without authentication
+	Metrics bool `yaml:"metrics"`
+	// MetricsAddr is the address of a separate listener where the metrics are served. If it's empty, they are served
+	// by the HTTP server, along with the shortened URLs
+	MetricsAddr string `yaml:"metrics_addr"`
+
+	// Remote is the URL of a running URL shortener. If it's set, the commands that manage the links use its API
+	// instead of opening the store
+	Remote string `yaml:"remote"`
+	// APIKey is the API key used by the commands that manage the links through the API of the remote URL shortener
+	APIKey string `yaml:"api_key"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Addr:      ":3000",
+		LogFile:   "urlshortener.log",
+		LogStdout: true,
+		LogFormat: logging.FormatText,
+		LogLevel:  "info",
+
+		LogMaxSize:    100,
+		LogMaxBackups: 10,
+
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 5 * time.Second,
+
+		Store:      "bolt",
+		BoltPath:   "urlshortener.db",
+		SQLDialect: db.DialectSQLite,
+		SQLDSN:     "urlshortener.sqlite",
+
+		CodeLength:    db.DefaultLength,
+		CodeSymbols:   db.DefaultSymbols,
+		CodeUnicode:   true,
+		CodeMinLength: db.DefaultMinLength,
+		CodeMaxLength: db.DefaultMaxLength,
+
+		RedirectStatus: http.StatusFound,
+
+		QRSize:      qr.DefaultSize,
+		QRLevel:     qr.DefaultLevel,
+		QRMargin:    qr.DefaultMargin,
+		QRCacheSize: qr.DefaultCacheSize,
+
+		Auth: true,
+
+		JanitorInterval: time.Minute,
+	}
+}
+
+// flags registers all the configuration options as flags of the flag set
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address where the HTTP server listens")
+	fs.StringVar(&c.PublicURL, "public-url", c.PublicURL, "base URL where the URL shortener is reachable, used to build the full short links (e.g. https://short.nefixestrada.com)")
+	fs.StringVar(&c.LogFile, "log-file", c.LogFile, "path of the log file (empty disables it)")
+	fs.BoolVar(&c.LogStdout, "log-stdout", c.LogStdout, "write the logs to the standard output")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "format of the logs: text (logfmt) or json")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "minimum level of the logs written: debug, info, warn or error")
+	fs.IntVar(&c.LogMaxSize, "log-max-size", c.LogMaxSize, "size in megabytes after which the log file is rotated (0 disables it)")
+	fs.DurationVar(&c.LogMaxAge, "log-max-age", c.LogMaxAge, "duration after which the log file is rotated (0 disables it)")
+	fs.IntVar(&c.LogMaxBackups, "log-max-backups", c.LogMaxBackups, "number of rotated log files kept (0 keeps all of them)")
+	fs.BoolVar(&c.LogCompress, "log-compress", c.LogCompress, "compress the rotated log files with gzip")
+
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum duration for reading an entire request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum duration before timing out the writes of a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "maximum duration to wait for the next request when keep-alives are enabled")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "maximum duration to wait for the connections to be drained when stopping")
+
+	fs.StringVar(&c.Store, "store", c.Store, "storage backend to use: bolt, sql or memory")
+	fs.StringVar(&c.BoltPath, "bolt-path", c.BoltPath, "path of the Bolt DB file used with the bolt store")
+	fs.StringVar(&c.SQLDialect, "sql-dialect", c.SQLDialect, "SQL database to use with the sql store: sqlite or postgres")
+	fs.StringVar(&c.SQLDSN, "sql-dsn", c.SQLDSN, "data source name of the SQL database used with the sql store")
+
+	fs.StringVar(&c.CodeAlphabet, "code-alphabet", c.CodeAlphabet, "characters used when generating short URLs (empty uses base62, or base36 when the short URLs are case insensitive)")
+	fs.IntVar(&c.CodeLength, "code-length", c.CodeLength, "length of the generated short URLs")
+	fs.StringVar(&c.CodeSymbols, "code-symbols", c.CodeSymbols, "characters allowed in the short URLs besides the letters, the digits and the '/' of the namespaces")
+	fs.BoolVar(&c.CodeUnicode, "code-unicode", c.CodeUnicode, "allow the letters and the digits of all the scripts in the short URLs, not only the ASCII ones")
+	fs.IntVar(&c.CodeMinLength, "code-min-length", c.CodeMinLength, "minimum length of the short URLs")
+	fs.IntVar(&c.CodeMaxLength, "code-max-length", c.CodeMaxLength, "maximum length of the short URLs")
+	fs.BoolVar(&c.CodeCaseInsensitive, "code-case-insensitive", c.CodeCaseInsensitive, "match the short URLs without case, storing them in lower case")
+	fs.BoolVar(&c.CodeAllowConfusables, "code-allow-confusables", c.CodeAllowConfusables, "allow characters in the short URLs that can be confused with other ones")
+
+	fs.IntVar(&c.RedirectStatus, "redirect-status", c.RedirectStatus, "status code of the redirects of the links that don't set one: 301, 302, 307 or 308")
+
+	fs.IntVar(&c.QRSize, "qr-size", c.QRSize, "size in pixels of the QR codes that don't set one")
+	fs.StringVar(&c.QRLevel, "qr-level", c.QRLevel, "error correction level of the QR codes that don't set one: L, M, Q or H")
+	fs.IntVar(&c.QRMargin, "qr-margin", c.QRMargin, "margin in modules of the QR codes that don't set one")
+	fs.IntVar(&c.QRCacheSize, "qr-cache-size", c.QRCacheSize, "number of QR codes kept in memory (0 disables the cache)")
+
+	fs.BoolVar(&c.Auth, "auth", c.Auth, "require an user or an API key to create, update, delete and list links")
+
+	fs.DurationVar(&c.JanitorInterval, "janitor-interval", c.JanitorInterval, "how often the expired shortened URLs are removed (0 disables it)")
+
+	fs.BoolVar(&c.Metrics, "metrics", c.Metrics, "serve the Prometheus metrics at /metrics, without authentication")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "address of a separate listener where the metrics are served (empty serves them with the shortened URLs)")
+
+	fs.StringVar(&c.Remote, "remote", c.Remote, "URL of a running URL shortener whose API is used by the commands that manage the links")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key used by the commands that manage the links through the API of the remote URL shortener")
+}
+
+// Load reads the configuration from the configuration file, the environment variables and the flags provided as
+// arguments. The configuration file is set with the -config flag or the URLSHORTENER_CONFIG environment variable
+func Load(args []string) (*Config, error) {
+	c, rest, err := LoadCommand(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+
+	return c, nil
+}
+
+// LoadCommand is like Load, but it allows arguments after the flags (e.g. a command), that are returned
+func LoadCommand(args []string) (*Config, []string, error) {
+	c := Default()
+
+	fs := flag.NewFlagSet("urlshortener", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path of the YAML configuration file")
+	c.flags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// The flags have the highest precedence, so they're stored to be applied at the end
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	*c = *Default()
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+
+		env := EnvPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if val, ok := os.LookupEnv(env); ok {
+			if setErr := fs.Set(f.Name, val); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", val, env, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, val := range setFlags {
+		if name == "config" {
+			continue
+		}
+
+		if err := fs.Set(name, val); err != nil {
+			return nil, nil, fmt.Errorf("invalid value %q for flag -%s: %v", val, name, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return c, fs.Args(), nil
+}
+
+// loadFile reads the YAML configuration file. Only the options present in the file are changed
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading the configuration file: %v", err)
+	}
+
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("error parsing the configuration file: %v", err)
+	}
+
+	return nil
+}
+
+// Validate checks that the configuration is valid
+func (c *Config) Validate() error {
+	if c.Addr == "" {
+		return errors.New("invalid configuration: the address can't be empty")
+	}
+
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid configuration: the public URL %s needs to be an HTTP or HTTPS URL", c.PublicURL)
+		}
+	}
+
+	if c.MetricsAddr != "" && c.MetricsAddr == c.Addr {
+		return errors.New("invalid configuration: the metrics address needs to be different from the address")
+	}
+
+	if _, err := c.Logging(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	for name, d := range map[string]time.Duration{
+		"read timeout":     c.ReadTimeout,
+		"write timeout":    c.WriteTimeout,
+		"idle timeout":     c.IdleTimeout,
+		"shutdown timeout": c.ShutdownTimeout,
+		"janitor interval": c.JanitorInterval,
+	} {
+		if d < 0 {
+			return fmt.Errorf("invalid configuration: the %s can't be negative", name)
+		}
+	}
+
+	switch c.Store {
+	case "bolt":
+		if c.BoltPath == "" {
+			return errors.New("invalid configuration: the Bolt DB path can't be empty")
+		}
+
+	case "sql":
+		if c.SQLDialect != db.DialectSQLite && c.SQLDialect != db.DialectPostgres {
+			return fmt.Errorf("invalid configuration: unknown SQL dialect %s", c.SQLDialect)
+		}
+
+		if c.SQLDSN == "" {
+			return errors.New("invalid configuration: the SQL data source name can't be empty")
+		}
+
+	case "memory":
+
+	default:
+		return fmt.Errorf("invalid configuration: unknown store %s", c.Store)
+	}
+
+	if c.RedirectStatus == 0 || db.ValidateRedirectStatus(c.RedirectStatus) != nil {
+		return fmt.Errorf("invalid configuration: %v", db.ErrRedirectStatusInvalid)
+	}
+
+	if err := c.QR().Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if c.QRCacheSize < 0 {
+		return errors.New("invalid configuration: the QR cache size can't be negative")
+	}
+
+	if c.Remote != "" {
+		u, err := url.Parse(c.Remote)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid configuration: the remote URL %s needs to be an HTTP or HTTPS URL", c.Remote)
+		}
+	}
+
+	if err := c.Generator().Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if err := c.CodePolicy().Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if err := c.CodePolicy().ValidateGenerator(c.Generator()); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return nil
+}
+
+// Logging returns the options of the logger configured
+func (c *Config) Logging() (logging.Options, error) {
+	level, err := logging.ParseLevel(c.LogLevel)
+	if err != nil {
+		return logging.Options{}, err
+	}
+
+	opts := logging.Options{
+		Format: c.LogFormat,
+		Level:  level,
+		Stdout: c.LogStdout,
+		File:   c.LogFile,
+		Rotation: logging.Rotation{
+			MaxSize:    int64(c.LogMaxSize) * 1024 * 1024,
+			MaxAge:     c.LogMaxAge,
+			MaxBackups: c.LogMaxBackups,
+			Compress:   c.LogCompress,
+		},
+	}
+
+	if err := opts.Validate(); err != nil {
+		return logging.Options{}, err
+	}
+
+	return opts, nil
+}
+
+// Generator returns the short URL generator configured. If the alphabet isn't set, the default one of the case of the
+// short URLs is used
+func (c *Config) Generator() *db.Generator {
+	alphabet := c.CodeAlphabet
+	if alphabet == "" {
+		alphabet = db.DefaultAlphabet
+		if c.CodeCaseInsensitive {
+			alphabet = db.DefaultLowerAlphabet
+		}
+	}
+
+	return &db.Generator{
+		Alphabet: alphabet,
+		Length:   c.CodeLength,
+		Retries:  db.DefaultRetries,
+	}
+}
+
+// CodePolicy returns the rules that the short URLs need to follow configured
+func (c *Config) CodePolicy() *db.CodePolicy {
+	return &db.CodePolicy{
+		Symbols:          c.CodeSymbols,
+		Unicode:          c.CodeUnicode,
+		MinLength:        c.CodeMinLength,
+		MaxLength:        c.CodeMaxLength,
+		CaseInsensitive:  c.CodeCaseInsensitive,
+		AllowConfusables: c.CodeAllowConfusables,
+	}
+}
+
+// QR returns the default options of the QR codes configured
+func (c *Config) QR() qr.Options {
+	return qr.Options{
+		Size:   c.QRSize,
+		Level:  c.QRLevel,
+		Margin: c.QRMargin,
+	}
+}
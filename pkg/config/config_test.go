@@ -0,0 +1,211 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/config"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should return the default configuration
+func TestLoadDefault(t *testing.T) {
+	cfg, err := config.Load([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error loading the configuration: %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg, config.Default()) {
+		t.Errorf("expecting %v, but got %v", config.Default(), cfg)
+	}
+
+	// The metrics are served without authentication, so they need to be enabled explicitly
+	if cfg.Metrics {
+		t.Errorf("expecting the metrics to be disabled, but got %v", cfg.Metrics)
+	}
+}
+
+// The flags should have precedence over the environment variables, that have precedence over the configuration file
+func TestLoadPrecedence(t *testing.T) {
+	if err := ioutil.WriteFile("urlshortener.yml", []byte("addr: :8080\nlog_file: file.log\nstore: memory\ncode_length: 8\n"), 0600); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	os.Setenv("URLSHORTENER_CONFIG", "urlshortener.yml")
+	os.Setenv("URLSHORTENER_LOG_FILE", "env.log")
+	os.Setenv("URLSHORTENER_CODE_LENGTH", "10")
+	defer func() {
+		os.Unsetenv("URLSHORTENER_CONFIG")
+		os.Unsetenv("URLSHORTENER_LOG_FILE")
+		os.Unsetenv("URLSHORTENER_CODE_LENGTH")
+	}()
+
+	cfg, err := config.Load([]string{"-code-length", "12"})
+	if err != nil {
+		t.Fatalf("unexpected error loading the configuration: %v", err)
+	}
+
+	expected := config.Default()
+	expected.Addr = ":8080"
+	expected.LogFile = "env.log"
+	expected.Store = "memory"
+	expected.CodeLength = 12
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expecting %v, but got %v", expected, cfg)
+	}
+
+	if err := os.Remove("urlshortener.yml"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should generate lower case short URLs by default when they are case insensitive
+func TestLoadCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{}, expected: db.DefaultAlphabet},
+		{args: []string{"-code-case-insensitive"}, expected: db.DefaultLowerAlphabet},
+		{args: []string{"-code-case-insensitive", "-code-alphabet", "abcdef"}, expected: "abcdef"},
+	}
+
+	for _, tt := range tests {
+		cfg, err := config.Load(tt.args)
+		if err != nil {
+			t.Fatalf("unexpected error loading the configuration: %v", err)
+		}
+
+		if alphabet := cfg.Generator().Alphabet; alphabet != tt.expected {
+			t.Errorf("expecting %s, but got %s", tt.expected, alphabet)
+		}
+	}
+}
+
+// Should return an error when the configuration isn't valid
+func TestLoadErr(t *testing.T) {
+	tests := []struct {
+		args        []string
+		env         map[string]string
+		file        string
+		expectedErr string
+	}{
+		{
+			args:        []string{"-store", "mongo"},
+			expectedErr: "invalid configuration: unknown store mongo",
+		},
+		{
+			args:        []string{"-store", "sql", "-sql-dialect", "oracle"},
+			expectedErr: "invalid configuration: unknown SQL dialect oracle",
+		},
+		{
+			args:        []string{"-addr", ""},
+			expectedErr: "invalid configuration: the address can't be empty",
+		},
+		{
+			args:        []string{"-shutdown-timeout", "-1s"},
+			expectedErr: "invalid configuration: the shutdown timeout can't be negative",
+		},
+		{
+			args:        []string{"-code-length", "0"},
+			expectedErr: "invalid configuration: the generator length needs to be at least one",
+		},
+		{
+			args:        []string{"-remote", "short.nefixestrada.com"},
+			expectedErr: "invalid configuration: the remote URL short.nefixestrada.com needs to be an HTTP or HTTPS URL",
+		},
+		{
+			args:        []string{"-log-format", "xml"},
+			expectedErr: "invalid configuration: unknown log format xml, it needs to be text or json",
+		},
+		{
+			args:        []string{"-log-level", "verbose"},
+			expectedErr: "invalid configuration: unknown log level verbose, it needs to be debug, info, warn or error",
+		},
+		{
+			args:        []string{"-log-file", "", "-log-stdout=false"},
+			expectedErr: "invalid configuration: the logs need to be written to the standard output or to a file",
+		},
+		{
+			args:        []string{"-log-max-backups", "-1"},
+			expectedErr: "invalid configuration: the log file rotation options can't be negative",
+		},
+		{
+			args:        []string{"-code-symbols", "-?"},
+			expectedErr: "invalid configuration: the character '?' can't be allowed in the short URLs",
+		},
+		{
+			args:        []string{"-code-max-length", "4"},
+			expectedErr: "invalid configuration: the generator length needs to be between 1 and 4",
+		},
+		{
+			args:        []string{"-code-case-insensitive", "-code-alphabet", "abcDEF"},
+			expectedErr: "invalid configuration: the generator alphabet can't have upper case letters when the short URLs are case insensitive",
+		},
+		{
+			args:        []string{"-public-url", "short.nefixestrada.com"},
+			expectedErr: "invalid configuration: the public URL short.nefixestrada.com needs to be an HTTP or HTTPS URL",
+		},
+		{
+			args:        []string{"-redirect-status", "303"},
+			expectedErr: "invalid configuration: the redirect status needs to be 301, 302, 307 or 308",
+		},
+		{
+			args:        []string{"-qr-level", "X"},
+			expectedErr: "invalid configuration: the error correction level of the QR code needs to be L, M, Q or H",
+		},
+		{
+			args:        []string{"-qr-cache-size", "-1"},
+			expectedErr: "invalid configuration: the QR cache size can't be negative",
+		},
+		{
+			args:        []string{"-metrics-addr", ":3000"},
+			expectedErr: "invalid configuration: the metrics address needs to be different from the address",
+		},
+		{
+			args:        []string{"serve"},
+			expectedErr: "unexpected arguments: serve",
+		},
+		{
+			env:         map[string]string{"URLSHORTENER_CODE_LENGTH": "six"},
+			expectedErr: `invalid value "six" for URLSHORTENER_CODE_LENGTH: parse error`,
+		},
+		{
+			file:        "unknown: true\n",
+			expectedErr: "error parsing the configuration file: yaml: unmarshal errors:\n  line 1: field unknown not found in type config.Config",
+		},
+	}
+
+	for _, tt := range tests {
+		for k, v := range tt.env {
+			os.Setenv(k, v)
+		}
+
+		args := tt.args
+		if tt.file != "" {
+			if err := ioutil.WriteFile("urlshortener.yml", []byte(tt.file), 0600); err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			args = append(args, "-config", "urlshortener.yml")
+		}
+
+		_, err := config.Load(args)
+		if err == nil || err.Error() != tt.expectedErr {
+			t.Errorf("expecting %s, but got %v", tt.expectedErr, err)
+		}
+
+		for k := range tt.env {
+			os.Unsetenv(k)
+		}
+
+		if tt.file != "" {
+			if err := os.Remove("urlshortener.yml"); err != nil {
+				t.Fatalf("error finishing the test: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditAction is the change of a shortened URL recorded in the audit log
+type AuditAction string
+
+const (
+	// AuditCreate is recorded when a shortened URL is created, including the imported ones
+	AuditCreate AuditAction = "create"
+	// AuditUpdate is recorded when the target of a shortened URL changes or when it's overwritten by an import
+	AuditUpdate AuditAction = "update"
+	// AuditDelete is recorded when a shortened URL is removed
+	AuditDelete AuditAction = "delete"
+	// AuditDisable is recorded when a shortened URL is disabled
+	AuditDisable AuditAction = "disable"
+	// AuditEnable is recorded when a shortened URL is enabled again
+	AuditEnable AuditAction = "enable"
+	// AuditExpire is recorded when an expired shortened URL is removed
+	AuditExpire AuditAction = "expire"
+)
+
+// AuditEntry is a change of a shortened URL. Old is the shortened URL before the change and New is the shortened URL
+// after it, and they are nil when the shortened URL didn't exist before or doesn't exist after the change
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is who made the change (e.g. user:nefix, key:deploy, cli:root or janitor)
+	Actor    string      `json:"actor"`
+	Action   AuditAction `json:"action"`
+	ShortURL string      `json:"shortURL"`
+	Old      *Link       `json:"old,omitempty"`
+	New      *Link       `json:"new,omitempty"`
+}
+
+// AuditFilter selects entries of the audit log. The empty fields match all the entries
+type AuditFilter struct {
+	Actor    string
+	Action   AuditAction
+	ShortURL string
+	// Since and Until are the range of time of the entries, including Since and excluding Until
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of entries. If it's 0, there's no limit
+	Limit int
+}
+
+// Match returns whether an entry of the audit log is selected by the filter. The limit isn't checked
+func (f AuditFilter) Match(e AuditEntry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+
+	if f.ShortURL != "" && e.ShortURL != f.ShortURL {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	return f.Until.IsZero() || e.Time.Before(f.Until)
+}
+
+// AuditLog is the interface that needs to be implemented by the storage backends that keep the audit log. The audit
+// log is append only: its entries can't be changed or removed
+type AuditLog interface {
+	// AppendAudit adds entries at the end of the audit log
+	AppendAudit(entries ...AuditEntry) error
+	// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest
+	// to the newest, until it returns an error
+	WalkAudit(f AuditFilter, fn func(e AuditEntry) error) error
+}
+
+// AuditFunc returns the entry of the audit log of a change of a shortened URL, from the shortened URL before and after
+// the change. New is nil when the shortened URL is removed
+type AuditFunc func(old, new *Link) AuditEntry
+
+// AuditStore is implemented by the stores that keep the audit log and can record the changes of the shortened URLs in
+// the same transaction as the changes, so a change is never made without its entry and the entries always have the
+// values before and after it. The methods are the same as the ones of the Store, appending the entries returned by
+// the audit function. If it's nil, the changes aren't recorded
+type AuditStore interface {
+	// UpdateLinkAudit changes the target URL and the redirect status of an existing shortened URL and records it
+	UpdateLinkAudit(shortURL string, u LinkUpdate, audit AuditFunc) error
+	// SetDisabledAudit disables or enables an existing shortened URL and records it
+	SetDisabledAudit(shortURL string, disabled bool, audit AuditFunc) error
+	// DeleteURLAudit removes a shortened URL and records it
+	DeleteURLAudit(shortURL string, audit AuditFunc) error
+	// DeleteExpiredAudit removes all the shortened URLs that have expired at the time provided and records each one
+	DeleteExpiredAudit(now time.Time, audit AuditFunc) (int, error)
+}
+
+// ListAudit returns the entries of the audit log selected by the filter, from the oldest to the newest
+func ListAudit(audit AuditLog, f AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	if err := audit.WalkAudit(f, func(e AuditEntry) error {
+		entries = append(entries, e)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Audited needs to implement the Store and AuditLog interfaces
+var _ Store = &Audited{}
+var _ AuditLog = &Audited{}
+
+// Audited is a Store that records all the changes of the shortened URLs made through it in an audit log, on behalf
+// of an actor. If the store is an AuditStore, the changes of the existing shortened URLs are recorded in the same
+// transaction as the changes, in the audit log of the store. Otherwise, and for the creations, the entries are added
+// after the changes succeed, so a change is returned as failed if it can't be recorded, even if it has been made
+type Audited struct {
+	Store
+
+	// Log is where the changes are recorded
+	Log AuditLog
+	// Actor is who makes the changes
+	Actor string
+}
+
+// AddURL adds a new shortened URL and records its creation
+func (a *Audited) AddURL(shortURL string, longURL string) error {
+	if shortURL == "" {
+		return ErrShortURLEmpty
+	}
+
+	return a.AddLink(&Link{ShortURL: shortURL, LongURL: longURL})
+}
+
+// AddLink adds a new shortened URL and records its creation
+func (a *Audited) AddLink(l *Link) error {
+	if err := a.Store.AddLink(l); err != nil {
+		return err
+	}
+
+	created := *l
+
+	return a.record(a.entry(AuditCreate, l.ShortURL, nil, &created))
+}
+
+// ImportLinks imports a batch of shortened URLs and records the ones created and overwritten
+func (a *Audited) ImportLinks(links []Link, opts ImportOptions) ([]ImportResult, error) {
+	old := map[string]*Link{}
+	if !opts.DryRun && opts.Conflict == ConflictOverwrite {
+		for _, l := range links {
+			if l.ShortURL == "" {
+				continue
+			}
+
+			if prev, err := a.Store.ReadLink(l.ShortURL); err == nil {
+				old[prev.ShortURL] = prev
+			}
+		}
+	}
+
+	results, err := a.Store.ImportLinks(links, opts)
+	if err != nil || opts.DryRun {
+		return results, err
+	}
+
+	entries := []AuditEntry{}
+	for i, res := range results {
+		imported := links[i]
+		imported.ShortURL = res.ShortURL
+
+		switch res.Status {
+		case ImportCreated:
+			entries = append(entries, a.entry(AuditCreate, res.ShortURL, nil, &imported))
+
+		case ImportOverwritten:
+			entries = append(entries, a.entry(AuditUpdate, res.ShortURL, old[res.ShortURL], &imported))
+		}
+	}
+
+	return results, a.record(entries...)
+}
+
+// UpdateURL changes the target URL of an existing shortened URL and records the change
+func (a *Audited) UpdateURL(shortURL string, longURL string) error {
+	return a.UpdateLink(shortURL, LinkUpdate{LongURL: longURL})
+}
+
+// UpdateLink changes the target URL and the redirect status of an existing shortened URL at once and records all the
+// changes in a single entry
+func (a *Audited) UpdateLink(shortURL string, u LinkUpdate) error {
+	audit := a.audit(AuditUpdate)
+
+	if s, ok := a.Store.(AuditStore); ok {
+		return s.UpdateLinkAudit(shortURL, u, audit)
+	}
+
+	old, err := a.Store.ReadLink(shortURL)
+	if err != nil {
+		return a.Store.UpdateLink(shortURL, u)
+	}
+
+	if err := a.Store.UpdateLink(shortURL, u); err != nil {
+		return err
+	}
+
+	updated := *old
+	if u.LongURL != "" {
+		updated.LongURL = u.LongURL
+	}
+
+	if u.RedirectStatus != nil {
+		updated.RedirectStatus = *u.RedirectStatus
+	}
+
+	return a.record(audit(old, &updated))
+}
+
+// SetDisabled disables or enables an existing shortened URL and records the change
+func (a *Audited) SetDisabled(shortURL string, disabled bool) error {
+	audit := a.audit(AuditEnable)
+	if disabled {
+		audit = a.audit(AuditDisable)
+	}
+
+	if s, ok := a.Store.(AuditStore); ok {
+		return s.SetDisabledAudit(shortURL, disabled, audit)
+	}
+
+	old, err := a.Store.ReadLink(shortURL)
+	if err != nil {
+		return a.Store.SetDisabled(shortURL, disabled)
+	}
+
+	if err := a.Store.SetDisabled(shortURL, disabled); err != nil {
+		return err
+	}
+
+	updated := *old
+	updated.Disabled = disabled
+
+	return a.record(audit(old, &updated))
+}
+
+// SetRedirectStatus changes the status code of the redirects of an existing shortened URL and records the change
+func (a *Audited) SetRedirectStatus(shortURL string, status int) error {
+	return a.UpdateLink(shortURL, LinkUpdate{RedirectStatus: &status})
+}
+
+// DeleteURL removes a shortened URL and records its removal
+func (a *Audited) DeleteURL(shortURL string) error {
+	audit := a.audit(AuditDelete)
+
+	if s, ok := a.Store.(AuditStore); ok {
+		return s.DeleteURLAudit(shortURL, audit)
+	}
+
+	old, err := a.Store.ReadLink(shortURL)
+	if err != nil {
+		return a.Store.DeleteURL(shortURL)
+	}
+
+	if err := a.Store.DeleteURL(shortURL); err != nil {
+		return err
+	}
+
+	return a.record(audit(old, nil))
+}
+
+// DeleteExpired removes all the shortened URLs that have expired at the time provided and records their removal. It
+// returns the number of shortened URLs removed
+func (a *Audited) DeleteExpired(now time.Time) (int, error) {
+	audit := a.audit(AuditExpire)
+
+	if s, ok := a.Store.(AuditStore); ok {
+		return s.DeleteExpiredAudit(now, audit)
+	}
+
+	expired := []Link{}
+	if err := a.Store.WalkURLs(func(l Link) error {
+		if l.Expired(now, l.Clicks) {
+			expired = append(expired, l)
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	n, err := a.Store.DeleteExpired(now)
+	if err != nil {
+		return n, err
+	}
+
+	entries := make([]AuditEntry, len(expired))
+	for i := range expired {
+		entries[i] = audit(&expired[i], nil)
+	}
+
+	return n, a.record(entries...)
+}
+
+// AppendAudit adds entries at the end of the audit log
+func (a *Audited) AppendAudit(entries ...AuditEntry) error {
+	return a.Log.AppendAudit(entries...)
+}
+
+// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest to
+// the newest, until it returns an error
+func (a *Audited) WalkAudit(f AuditFilter, fn func(e AuditEntry) error) error {
+	return a.Log.WalkAudit(f, fn)
+}
+
+// entry returns a new entry of the audit log made by the actor
+func (a *Audited) entry(action AuditAction, shortURL string, old, new *Link) AuditEntry {
+	return AuditEntry{
+		Time:     time.Now().UTC(),
+		Actor:    a.Actor,
+		Action:   action,
+		ShortURL: shortURL,
+		Old:      old,
+		New:      new,
+	}
+}
+
+// audit returns the function that builds the entries of an action made by the actor. The entries have the short URL
+// as it's stored, so all the changes of a shortened URL have the same one
+func (a *Audited) audit(action AuditAction) AuditFunc {
+	return func(old, new *Link) AuditEntry {
+		return a.entry(action, old.ShortURL, old, new)
+	}
+}
+
+// record adds the entries to the audit log
+func (a *Audited) record(entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := a.Log.AppendAudit(entries...); err != nil {
+		return fmt.Errorf("error recording the change in the audit log: %v", err)
+	}
+
+	return nil
+}
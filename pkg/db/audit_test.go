@@ -0,0 +1,326 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// auditStore is a store that keeps the audit log
+type auditStore interface {
+	db.Store
+	db.AuditLog
+}
+
+// testAudit checks that all the changes made through an audited store are recorded with their actor and their
+// previous and new values, and that the audit log can be filtered
+func testAudit(t *testing.T, s auditStore) {
+	before := time.Now().Add(-time.Second)
+
+	a := &db.Audited{Store: s, Log: s, Actor: "user:nefix"}
+
+	if err := a.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := a.UpdateURL("blog", "https://blog.nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error updating the URL: %v", err)
+	}
+
+	if err := a.SetDisabled("blog", true); err != nil {
+		t.Fatalf("unexpected error disabling the URL: %v", err)
+	}
+
+	if _, err := a.ImportLinks([]db.Link{
+		{ShortURL: "blog", LongURL: "https://golang.org"},
+		{ShortURL: "go", LongURL: "https://golang.org"},
+	}, db.ImportOptions{Conflict: db.ConflictOverwrite, DryRun: true}); err != nil {
+		t.Fatalf("unexpected error importing the URLs: %v", err)
+	}
+
+	if _, err := a.ImportLinks([]db.Link{
+		{ShortURL: "blog", LongURL: "https://golang.org"},
+		{ShortURL: "go", LongURL: "https://golang.org"},
+	}, db.ImportOptions{Conflict: db.ConflictOverwrite}); err != nil {
+		t.Fatalf("unexpected error importing the URLs: %v", err)
+	}
+
+	if err := a.DeleteURL("blog"); err != nil {
+		t.Fatalf("unexpected error deleting the URL: %v", err)
+	}
+
+	// The failed changes shouldn't be recorded
+	if err := a.DeleteURL("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute)
+	if err := s.AddLink(&db.Link{ShortURL: "old", LongURL: "https://nefixestrada.com", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	janitor := &db.Audited{Store: s, Log: s, Actor: "janitor"}
+	if n, err := janitor.DeleteExpired(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("expecting 1 <nil>, but got %d %v", n, err)
+	}
+
+	entries, err := db.ListAudit(s, db.AuditFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error listing the audit log: %v", err)
+	}
+
+	expected := []struct {
+		actor    string
+		action   db.AuditAction
+		shortURL string
+		old      string
+		new      string
+	}{
+		{"user:nefix", db.AuditCreate, "blog", "", "https://nefixestrada.com"},
+		{"user:nefix", db.AuditUpdate, "blog", "https://nefixestrada.com", "https://blog.nefixestrada.com"},
+		{"user:nefix", db.AuditDisable, "blog", "https://blog.nefixestrada.com", "https://blog.nefixestrada.com"},
+		{"user:nefix", db.AuditUpdate, "blog", "https://blog.nefixestrada.com", "https://golang.org"},
+		{"user:nefix", db.AuditCreate, "go", "", "https://golang.org"},
+		{"user:nefix", db.AuditDelete, "blog", "https://golang.org", ""},
+		{"janitor", db.AuditExpire, "old", "https://nefixestrada.com", ""},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("expecting %d entries, but got %v", len(expected), entries)
+	}
+
+	for i, e := range entries {
+		exp := expected[i]
+		if e.Actor != exp.actor || e.Action != exp.action || e.ShortURL != exp.shortURL {
+			t.Errorf("expecting %s %s %s, but got %s %s %s", exp.actor, exp.action, exp.shortURL, e.Actor, e.Action, e.ShortURL)
+		}
+
+		old := ""
+		if e.Old != nil {
+			old = e.Old.LongURL
+		}
+
+		if old != exp.old {
+			t.Errorf("expecting %s, but got %s", exp.old, old)
+		}
+
+		new := ""
+		if e.New != nil {
+			new = e.New.LongURL
+		}
+
+		if new != exp.new {
+			t.Errorf("expecting %s, but got %s", exp.new, new)
+		}
+
+		if e.Time.Before(before) {
+			t.Errorf("expecting the time to be after %v, but got %v", before, e.Time)
+		}
+	}
+
+	if entries[2].Old.Disabled || !entries[2].New.Disabled {
+		t.Errorf("expecting the link to be disabled, but got %v %v", entries[2].Old.Disabled, entries[2].New.Disabled)
+	}
+
+	filtered, err := db.ListAudit(s, db.AuditFilter{ShortURL: "blog", Action: db.AuditUpdate, Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error listing the audit log: %v", err)
+	}
+
+	if len(filtered) != 1 || filtered[0].New.LongURL != "https://blog.nefixestrada.com" {
+		t.Errorf("expecting the first update, but got %v", filtered)
+	}
+
+	filtered, err = db.ListAudit(s, db.AuditFilter{Actor: "janitor", Since: before, Until: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error listing the audit log: %v", err)
+	}
+
+	if len(filtered) != 1 || filtered[0].ShortURL != "old" {
+		t.Errorf("expecting the expired link, but got %v", filtered)
+	}
+
+	filtered, err = db.ListAudit(s, db.AuditFilter{Since: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error listing the audit log: %v", err)
+	}
+
+	if len(filtered) != 0 {
+		t.Errorf("expecting %d, but got %d", 0, len(filtered))
+	}
+}
+
+// Should work as expected
+func TestAudit(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testAudit(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryAudit(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testAudit(t, m)
+}
+
+// Should work as expected
+func TestSQLAudit(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testAudit(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// testAuditAtomic checks that the changes aren't made when they can't be recorded in the audit log of the store
+func testAuditAtomic(t *testing.T, s auditStore, breakLog func() error) {
+	expiresAt := time.Now().Add(time.Minute)
+	if err := s.AddLink(&db.Link{ShortURL: "blog", LongURL: "https://nefixestrada.com", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := breakLog(); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	a := &db.Audited{Store: s, Log: s, Actor: "user:nefix"}
+
+	if err := a.UpdateURL("blog", "https://blog.nefixestrada.com"); err == nil {
+		t.Errorf("expecting an error, but got %v", err)
+	}
+
+	if err := a.SetDisabled("blog", true); err == nil {
+		t.Errorf("expecting an error, but got %v", err)
+	}
+
+	if err := a.DeleteURL("blog"); err == nil {
+		t.Errorf("expecting an error, but got %v", err)
+	}
+
+	if n, err := a.DeleteExpired(time.Now().Add(time.Hour)); err == nil || n != 0 {
+		t.Errorf("expecting 0 and an error, but got %d %v", n, err)
+	}
+
+	l, err := s.ReadLink("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if l.LongURL != "https://nefixestrada.com" || l.Disabled {
+		t.Errorf("expecting the link to be unchanged, but got %v", l)
+	}
+}
+
+// Should not change the links when the changes can't be recorded
+func TestAuditAtomic(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testAuditAtomic(t, d, func() error {
+		return boltDB.Update(func(tx *bolt.Tx) error {
+			return tx.DeleteBucket([]byte("audit"))
+		})
+	})
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should not change the links when the changes can't be recorded
+func TestSQLAuditAtomic(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testAuditAtomic(t, s, func() error {
+		_, err := s.DB.Exec(`DROP TABLE audit_log`)
+		return err
+	})
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should record the changes with the short URL as it's stored, so all the changes of a link have the same one
+func TestMemoryAuditCanonical(t *testing.T) {
+	m := &db.Memory{Policy: insensitivePolicy()}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	a := &db.Audited{Store: m, Log: m, Actor: "user:nefix"}
+
+	if err := a.AddURL("Blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := a.UpdateURL("BLOG", "https://blog.nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error updating the URL: %v", err)
+	}
+
+	if err := a.SetDisabled("bLoG", true); err != nil {
+		t.Fatalf("unexpected error disabling the URL: %v", err)
+	}
+
+	if err := a.DeleteURL("BLOG"); err != nil {
+		t.Fatalf("unexpected error deleting the URL: %v", err)
+	}
+
+	entries, err := db.ListAudit(m, db.AuditFilter{ShortURL: "blog"})
+	if err != nil {
+		t.Fatalf("unexpected error listing the audit log: %v", err)
+	}
+
+	if len(entries) != 4 {
+		t.Errorf("expecting %d entries, but got %v", 4, entries)
+	}
+}
@@ -1,72 +1,1175 @@
 package db
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"errors"
-
-	"github.com/asaskevich/govalidator"
+	"sort"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
+// DB needs to implement the Store, KeyStore, UserStore, AuditLog and AuditStore interfaces
+var _ Store = &DB{}
+var _ KeyStore = &DB{}
+var _ UserStore = &DB{}
+var _ AuditLog = &DB{}
+var _ AuditStore = &DB{}
+
 // DB is the struct that contains the connection with the Bold DB
 type DB struct {
 	DB *bolt.DB
+
+	// Generator is used to generate the short URLs when they aren't provided. If it's nil, the default one is used
+	Generator *Generator
+
+	// Policy are the rules that the short URLs need to follow. If it's nil, the default one is used
+	Policy *CodePolicy
+
+	// ObserveTx is called after each transaction with whether it was writable and its duration. If it's nil, the
+	// transactions aren't observed
+	ObserveTx func(writable bool, d time.Duration)
+}
+
+// canonical returns the short URL as it's stored, following the code policy
+func (d *DB) canonical(shortURL string) string {
+	return policyOrDefault(d.Policy).Canonical(shortURL)
+}
+
+// view runs a read-only transaction, observing its duration
+func (d *DB) view(fn func(tx *bolt.Tx) error) error {
+	defer d.observe(false, time.Now())
+
+	return d.DB.View(fn)
+}
+
+// update runs a read-write transaction, observing its duration
+func (d *DB) update(fn func(tx *bolt.Tx) error) error {
+	defer d.observe(true, time.Now())
+
+	return d.DB.Update(fn)
+}
+
+// observe calls ObserveTx, if it's set, with the duration of a transaction that started at the time provided
+func (d *DB) observe(writable bool, start time.Time) {
+	if d.ObserveTx != nil {
+		d.ObserveTx(writable, time.Since(start))
+	}
+}
+
+// Ping checks that the DB is open and that the bucket urls can be read
+func (d *DB) Ping() error {
+	return d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("urls"))
+		if b == nil {
+			return errors.New("the bucket urls doesn't exist")
+		}
+
+		b.Cursor().First()
+
+		return nil
+	})
 }
 
 // ReadURL reads a shortened URL from the DB and returns the target URL for it
-func (d *DB) ReadURL(shortURL string) (fullURL string, err error) {
-	if err := d.DB.View(func(tx *bolt.Tx) error {
-		fullURL = string(tx.Bucket([]byte("urls")).Get([]byte(shortURL)))
+func (d *DB) ReadURL(shortURL string) (string, error) {
+	fullURL, _, err := d.ReadRedirect(shortURL)
+
+	return fullURL, err
+}
 
-		if fullURL == "" {
-			return errors.New("the shortened URL wasn't found in the DB")
+// ReadRedirect reads a shortened URL from the DB and returns the target URL and the redirect status for it
+func (d *DB) ReadRedirect(shortURL string) (fullURL string, status int, err error) {
+	shortURL = d.canonical(shortURL)
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
 		}
 
+		if err := r.link(shortURL).Available(time.Now()); err != nil {
+			return err
+		}
+
+		fullURL = r.LongURL
+		status = r.RedirectStatus
+
 		return nil
 	}); err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	return fullURL, status, nil
+}
+
+// FollowLink reads a shortened URL that is going to redirect from the DB. The links without maximum number of clicks
+// are read in a read-only transaction, so the redirects don't wait for each other, and the ones with a maximum count
+// the click in a read-write transaction that checks again that they're available
+func (d *DB) FollowLink(shortURL string) (*Link, error) {
+	l, err := d.ReadLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Available(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if l.MaxClicks == 0 {
+		return l, nil
+	}
+
+	shortURL = l.ShortURL
+
+	if err := d.update(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		if err := r.link(shortURL).Available(time.Now()); err != nil {
+			return err
+		}
+
+		r.Clicks++
+		if err := writeRecord(tx, shortURL, r); err != nil {
+			return err
+		}
+
+		l = r.link(shortURL)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ReadLink reads a shortened URL from the DB, even if it has expired
+func (d *DB) ReadLink(shortURL string) (*Link, error) {
+	shortURL = d.canonical(shortURL)
+
+	var l *Link
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		l = r.link(shortURL)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ListURLs returns all the shortened URLs of the DB, sorted by the short URL
+func (d *DB) ListURLs() ([]Link, error) {
+	links := []Link{}
+
+	if err := d.WalkURLs(func(l Link) error {
+		links = append(links, l)
+
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
-	return fullURL, nil
+	return links, nil
 }
 
 // AddURL adds a new URL to the DB
 func (d *DB) AddURL(shortURL string, longURL string) error {
 	if shortURL == "" {
-		return errors.New("the short URL can't be empty")
+		return ErrShortURLEmpty
 	}
 
-	if longURL == "" {
-		return errors.New("the long URL can't be empty")
+	return d.AddLink(&Link{
+		ShortURL: shortURL,
+		LongURL:  longURL,
+	})
+}
+
+// AddLink adds a new shortened URL to the DB. If the short URL is empty, a new one is generated and set in the link
+func (d *DB) AddLink(l *Link) error {
+	if err := prepareLink(l, policyOrDefault(d.Policy)); err != nil {
+		return err
 	}
 
-	if !govalidator.IsURL(longURL) {
-		return errors.New("the long URL needs to be a valid URL")
+	g := generatorOrDefault(d.Generator)
+
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("urls"))
+		if b == nil {
+			return errors.New("the bucket urls doesn't exist")
+		}
+
+		var owner *User
+		if l.Owner != "" {
+			u, err := readUser(tx, l.Owner)
+			if err != nil {
+				return err
+			}
+
+			owner = &u.User
+		}
+
+		if err := checkNamespace(owner, l.ShortURL); err != nil {
+			return err
+		}
+
+		shortURL := l.ShortURL
+		if shortURL == "" {
+			var err error
+			shortURL, err = generateUnused(g, policyOrDefault(d.Policy), ownerPrefix(owner), func(shortURL string) bool {
+				return b.Get([]byte(shortURL)) != nil
+			})
+			if err != nil {
+				return err
+			}
+
+		} else if content := b.Get([]byte(shortURL)); content != nil {
+			return ErrAlreadyExists
+		}
+
+		if err := writeRecord(tx, shortURL, newRecord(l)); err != nil {
+			return err
+		}
+
+		l.ShortURL = shortURL
+
+		return nil
+	})
+}
+
+// ImportLinks imports a batch of shortened URLs in a single transaction
+func (d *DB) ImportLinks(links []Link, opts ImportOptions) ([]ImportResult, error) {
+	var results []ImportResult
+
+	if err := d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("urls"))
+		if b == nil {
+			return errors.New("the bucket urls doesn't exist")
+		}
+
+		im := &importer{
+			generator: d.Generator,
+			policy:    d.Policy,
+			exists: func(shortURL string) (bool, error) {
+				return b.Get([]byte(shortURL)) != nil, nil
+			},
+			write: func(l *Link, overwrite bool) error {
+				r := newRecord(l)
+				if overwrite {
+					old, err := readRecord(tx, l.ShortURL)
+					if err != nil {
+						return err
+					}
+
+					old.replaceTarget(l.LongURL, time.Now())
+					r.Clicks = old.Clicks
+					r.History = old.History
+				}
+
+				return writeRecord(tx, l.ShortURL, r)
+			},
+		}
+
+		var err error
+		results, err = im.run(links, opts)
+
+		return err
+	}); err != nil {
+		return results, err
 	}
 
-	return d.DB.Update(func(tx *bolt.Tx) error {
+	return results, nil
+}
+
+// WalkURLs calls the function provided with each shortened URL of the DB, sorted by the short URL, until it returns an
+// error. The DB can't be changed by the function
+func (d *DB) WalkURLs(fn func(l Link) error) error {
+	return d.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("urls"))
 		if b == nil {
 			return errors.New("the bucket urls doesn't exist")
 		}
 
-		if content := b.Get([]byte(shortURL)); content != nil {
-			return errors.New("there's already an shortened URL with that URL")
+		return b.ForEach(func(k, v []byte) error {
+			r, err := decodeRecord(v)
+			if err != nil {
+				return err
+			}
+
+			return fn(*r.link(string(k)))
+		})
+	})
+}
+
+// UpdateURL changes the target URL of an existing shortened URL. The previous target is added to its history
+func (d *DB) UpdateURL(shortURL string, longURL string) error {
+	return d.UpdateLink(shortURL, LinkUpdate{LongURL: longURL})
+}
+
+// UpdateLink changes the target URL and the redirect status of an existing shortened URL in a single transaction
+func (d *DB) UpdateLink(shortURL string, u LinkUpdate) error {
+	return d.UpdateLinkAudit(shortURL, u, nil)
+}
+
+// UpdateLinkAudit changes the target URL and the redirect status of an existing shortened URL and records the change
+// in the audit log, in a single transaction
+func (d *DB) UpdateLinkAudit(shortURL string, u LinkUpdate, audit AuditFunc) error {
+	shortURL = d.canonical(shortURL)
+
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	return d.update(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		old := r.link(shortURL)
+
+		if u.LongURL != "" {
+			r.replaceTarget(u.LongURL, time.Now())
+		}
+
+		if u.RedirectStatus != nil {
+			r.RedirectStatus = *u.RedirectStatus
+		}
+
+		if err := writeRecord(tx, shortURL, r); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, audit, old, r.link(shortURL))
+	})
+}
+
+// History returns the previous targets of a shortened URL, from the oldest to the newest
+func (d *DB) History(shortURL string) ([]TargetChange, error) {
+	shortURL = d.canonical(shortURL)
+
+	history := []TargetChange{}
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		history = append(history, r.History...)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// SetDisabled disables or enables an existing shortened URL. The disabled shortened URLs don't redirect
+func (d *DB) SetDisabled(shortURL string, disabled bool) error {
+	return d.SetDisabledAudit(shortURL, disabled, nil)
+}
+
+// SetDisabledAudit disables or enables an existing shortened URL and records the change in the audit log, in a single
+// transaction
+func (d *DB) SetDisabledAudit(shortURL string, disabled bool, audit AuditFunc) error {
+	shortURL = d.canonical(shortURL)
+
+	return d.update(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		old := r.link(shortURL)
+
+		r.Disabled = disabled
+		if err := writeRecord(tx, shortURL, r); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, audit, old, r.link(shortURL))
+	})
+}
+
+// SetRedirectStatus changes the status code of the redirects of an existing shortened URL
+func (d *DB) SetRedirectStatus(shortURL string, status int) error {
+	return d.UpdateLink(shortURL, LinkUpdate{RedirectStatus: &status})
+}
+
+// DeleteURL removes a shortened URL from the DB
+func (d *DB) DeleteURL(shortURL string) error {
+	return d.DeleteURLAudit(shortURL, nil)
+}
+
+// DeleteURLAudit removes a shortened URL from the DB and records its removal in the audit log, in a single transaction
+func (d *DB) DeleteURLAudit(shortURL string, audit AuditFunc) error {
+	shortURL = d.canonical(shortURL)
+
+	return d.update(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteLink(tx, shortURL); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, audit, r.link(shortURL), nil)
+	})
+}
+
+// DeleteExpired removes all the shortened URLs that have expired at the time provided. It returns the number of
+// shortened URLs removed
+func (d *DB) DeleteExpired(now time.Time) (int, error) {
+	return d.DeleteExpiredAudit(now, nil)
+}
+
+// DeleteExpiredAudit removes all the shortened URLs that have expired at the time provided and records the removal of
+// each one in the audit log, in a single transaction. It returns the number of shortened URLs removed
+func (d *DB) DeleteExpiredAudit(now time.Time, audit AuditFunc) (int, error) {
+	deleted := 0
+
+	if err := d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("urls"))
+		if b == nil {
+			return errors.New("the bucket urls doesn't exist")
 		}
 
-		if err := b.Put([]byte(shortURL), []byte(longURL)); err != nil {
+		expired := []*Link{}
+		if err := b.ForEach(func(k, v []byte) error {
+			r, err := decodeRecord(v)
+			if err != nil {
+				return err
+			}
+
+			if r.expired(now) {
+				expired = append(expired, r.link(string(k)))
+			}
+
+			return nil
+		}); err != nil {
 			return err
 		}
 
+		// The keys can't be deleted while iterating the bucket
+		for _, l := range expired {
+			if err := deleteLink(tx, l.ShortURL); err != nil {
+				return err
+			}
+
+			if err := appendAudit(tx, audit, l, nil); err != nil {
+				return err
+			}
+		}
+
+		deleted = len(expired)
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// deleteLink removes a shortened URL with its hits and click counts inside a transaction
+func deleteLink(tx *bolt.Tx, shortURL string) error {
+	if err := tx.Bucket([]byte("urls")).Delete([]byte(shortURL)); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"hits", "counts"} {
+		if b := tx.Bucket([]byte(name)); b != nil && b.Bucket([]byte(shortURL)) != nil {
+			if err := b.DeleteBucket([]byte(shortURL)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Stats returns the statistics of the DB
+func (d *DB) Stats() (*Stats, error) {
+	stats := &Stats{}
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("urls"))
+		if b == nil {
+			return errors.New("the bucket urls doesn't exist")
+		}
+
+		stats.Links = b.Stats().KeyN
+
 		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// RecordHits stores the hits of shortened URLs, increments their click counters and counts them by day, referrer and
+// country. All the hits are stored in a single transaction. The hits of shortened URLs that don't exist are ignored
+func (d *DB) RecordHits(hits []Hit) error {
+	return d.update(func(tx *bolt.Tx) error {
+		hitsBucket := tx.Bucket([]byte("hits"))
+		if hitsBucket == nil {
+			return errors.New("the bucket hits doesn't exist")
+		}
+
+		for _, h := range hits {
+			h.ShortURL = d.canonical(h.ShortURL)
+
+			r, err := readRecord(tx, h.ShortURL)
+			if err != nil {
+				if err == ErrNotFound {
+					continue
+				}
+
+				return err
+			}
+
+			if !h.Counted {
+				r.Clicks++
+				if err := writeRecord(tx, h.ShortURL, r); err != nil {
+					return err
+				}
+			}
+
+			b, err := hitsBucket.CreateBucketIfNotExists([]byte(h.ShortURL))
+			if err != nil {
+				return err
+			}
+
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			// The key is the time of the hit followed by a sequence, so the hits are sorted chronologically
+			key := make([]byte, 16)
+			binary.BigEndian.PutUint64(key, uint64(h.Time.UnixNano()))
+			binary.BigEndian.PutUint64(key[8:], seq)
+
+			val, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put(key, val); err != nil {
+				return err
+			}
+
+			if err := countHit(tx, h); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// countHit increments the click counts of the shortened URL of a hit inside a transaction. The counts are stored in
+// the bucket of the shortened URL inside the counts bucket, in a bucket for the days, the referrers and the countries
+func countHit(tx *bolt.Tx, h Hit) error {
+	countsBucket := tx.Bucket([]byte("counts"))
+	if countsBucket == nil {
+		return errors.New("the bucket counts doesn't exist")
+	}
+
+	b, err := countsBucket.CreateBucketIfNotExists([]byte(h.ShortURL))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range []struct{ bucket, key string }{
+		{"days", hitDay(h)},
+		{"referrers", h.Referrer},
+		{"countries", h.Country},
+	} {
+		if c.key == "" {
+			continue
+		}
+
+		counts, err := b.CreateBucketIfNotExists([]byte(c.bucket))
+		if err != nil {
+			return err
+		}
+
+		var n uint64
+		if val := counts.Get([]byte(c.key)); val != nil {
+			n = binary.BigEndian.Uint64(val)
+		}
+
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, n+1)
+
+		if err := counts.Put([]byte(c.key), val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readClickCounts reads the click counts of a shortened URL inside a transaction
+func readClickCounts(tx *bolt.Tx, shortURL string) (*clickCounts, error) {
+	counts := newClickCounts()
+
+	b := tx.Bucket([]byte("counts")).Bucket([]byte(shortURL))
+	if b == nil {
+		return counts, nil
+	}
+
+	for bucket, m := range map[string]map[string]int{
+		"days":      counts.days,
+		"referrers": counts.referrers,
+		"countries": counts.countries,
+	} {
+		c := b.Bucket([]byte(bucket))
+		if c == nil {
+			continue
+		}
+
+		if err := c.ForEach(func(k, v []byte) error {
+			m[string(k)] = int(binary.BigEndian.Uint64(v))
+
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// countStoredHits counts the hits stored by older versions, which didn't keep the click counts, inside a transaction
+func countStoredHits(tx *bolt.Tx) error {
+	hits := tx.Bucket([]byte("hits"))
+
+	return hits.ForEach(func(shortURL, v []byte) error {
+		b := hits.Bucket(shortURL)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var h Hit
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+
+			h.ShortURL = string(shortURL)
+
+			return countHit(tx, h)
+		})
 	})
 }
 
-// Initialize creates the required bucket
+// Clicks returns the click statistics of a shortened URL
+func (d *DB) Clicks(shortURL string) (*ClickStats, error) {
+	shortURL = d.canonical(shortURL)
+
+	var stats *ClickStats
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		r, err := readRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		counts, err := readClickCounts(tx, shortURL)
+		if err != nil {
+			return err
+		}
+
+		stats = newClickStats(shortURL, r.Clicks, counts)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Initialize creates the required buckets, migrates the shortened URLs and the hits stored by older versions and
+// renames the shortened URLs that aren't canonical with the code policy
 func (d *DB) Initialize() error {
-	return d.DB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("urls"))
+	return d.update(func(tx *bolt.Tx) error {
+		for _, b := range []string{"urls", "hits", "keys", "users", "audit"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(b)); err != nil {
+				return err
+			}
+		}
+
+		if tx.Bucket([]byte("counts")) == nil {
+			if _, err := tx.CreateBucket([]byte("counts")); err != nil {
+				return err
+			}
+
+			if err := countStoredHits(tx); err != nil {
+				return err
+			}
+		}
+
+		if err := migrateRecords(tx); err != nil {
+			return err
+		}
+
+		return migrateCanonical(tx, policyOrDefault(d.Policy))
+	})
+}
+
+// migrateCanonical renames the shortened URLs that aren't canonical with the code policy, with their hits and click
+// counts, inside a transaction. If two of them have the same canonical short URL, none of them is renamed
+func migrateCanonical(tx *bolt.Tx, p *CodePolicy) error {
+	urls := tx.Bucket([]byte("urls"))
+
+	shortURLs := []string{}
+	if err := urls.ForEach(func(k, v []byte) error {
+		shortURLs = append(shortURLs, string(k))
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	renames, err := p.canonicalRenames(shortURLs)
+	if err != nil {
+		return err
+	}
+
+	for shortURL, canonical := range renames {
+		// The values read inside a transaction that writes aren't valid after writing, so they are copied
+		val := append([]byte{}, urls.Get([]byte(shortURL))...)
+		if err := urls.Put([]byte(canonical), val); err != nil {
+			return err
+		}
+
+		if err := urls.Delete([]byte(shortURL)); err != nil {
+			return err
+		}
+
+		for _, name := range []string{"hits", "counts"} {
+			if err := moveBucket(tx.Bucket([]byte(name)), shortURL, canonical); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveBucket renames a nested bucket, copying all its keys and nested buckets. If it doesn't exist, nothing is done
+func moveBucket(parent *bolt.Bucket, from, to string) error {
+	src := parent.Bucket([]byte(from))
+	if src == nil {
+		return nil
+	}
+
+	dst, err := parent.CreateBucket([]byte(to))
+	if err != nil {
+		return err
+	}
+
+	if err := copyBucket(src, dst); err != nil {
+		return err
+	}
+
+	return parent.DeleteBucket([]byte(from))
+}
+
+// copyBucket copies the sequence, the keys and the nested buckets of a bucket into another one
+func copyBucket(src, dst *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		k = append([]byte{}, k...)
+
+		if v == nil {
+			nested, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+
+			return copyBucket(src.Bucket(k), nested)
+		}
+
+		return dst.Put(k, append([]byte{}, v...))
+	})
+}
+
+// AddKey creates a new API key with the name provided and returns it. Only the hash of the key is stored
+func (d *DB) AddKey(name string) (string, error) {
+	key, hash, k, err := newKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		if b == nil {
+			return errors.New("the bucket keys doesn't exist")
+		}
+
+		if _, err := findKey(b, name); err != ErrKeyNotFound {
+			if err == nil {
+				return ErrKeyAlreadyExists
+			}
+
+			return err
+		}
+
+		val, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(hash), val)
+	}); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// CheckKey returns the API key if it's valid. If it isn't, it returns ErrKeyInvalid
+func (d *DB) CheckKey(key string) (*APIKey, error) {
+	k := &APIKey{}
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		if b == nil {
+			return errors.New("the bucket keys doesn't exist")
+		}
+
+		content := b.Get([]byte(hashKey(key)))
+		if content == nil {
+			return ErrKeyInvalid
+		}
+
+		return json.Unmarshal(content, k)
+	}); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ListKeys returns all the API keys, sorted by name
+func (d *DB) ListKeys() ([]APIKey, error) {
+	keys := []APIKey{}
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		if b == nil {
+			return errors.New("the bucket keys doesn't exist")
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
 
+			keys = append(keys, key)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+
+	return keys, nil
+}
+
+// DeleteKey removes the API key with the name provided
+func (d *DB) DeleteKey(name string) error {
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("keys"))
+		if b == nil {
+			return errors.New("the bucket keys doesn't exist")
+		}
+
+		hash, err := findKey(b, name)
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(hash))
+	})
+}
+
+// findKey returns the hash of the API key with the name provided. The keys are stored by hash, so all of them need to
+// be checked
+func findKey(b *bolt.Bucket, name string) (string, error) {
+	var hash string
+
+	if err := b.ForEach(func(k, v []byte) error {
+		var key APIKey
+		if err := json.Unmarshal(v, &key); err != nil {
+			return err
+		}
+
+		if key.Name == name {
+			hash = string(k)
+		}
+
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if hash == "" {
+		return "", ErrKeyNotFound
+	}
+
+	return hash, nil
+}
+
+// AddUser adds a new user with the password provided. Only the hash of the password is stored
+func (d *DB) AddUser(u *User, password string) error {
+	hash, err := newUser(u, password)
+	if err != nil {
 		return err
+	}
+
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("users"))
+		if b == nil {
+			return errors.New("the bucket users doesn't exist")
+		}
+
+		if content := b.Get([]byte(u.Username)); content != nil {
+			return ErrUserAlreadyExists
+		}
+
+		val, err := json.Marshal(userRecord{
+			User:         *u,
+			PasswordHash: hash,
+		})
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(u.Username), val)
+	})
+}
+
+// Authenticate returns the user if the password is valid. If it isn't, it returns ErrUserInvalid
+func (d *DB) Authenticate(username, password string) (*User, error) {
+	var u *userRecord
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		var err error
+		u, err = readUser(tx, username)
+
+		return err
+	}); err != nil {
+		if err == ErrUserNotFound {
+			return nil, ErrUserInvalid
+		}
+
+		return nil, err
+	}
+
+	if err := checkPassword(u.PasswordHash, password); err != nil {
+		return nil, err
+	}
+
+	return &u.User, nil
+}
+
+// ReadUser returns an user
+func (d *DB) ReadUser(username string) (*User, error) {
+	var u *userRecord
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		var err error
+		u, err = readUser(tx, username)
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return &u.User, nil
+}
+
+// ListUsers returns all the users, sorted by username
+func (d *DB) ListUsers() ([]User, error) {
+	users := []User{}
+
+	if err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("users"))
+		if b == nil {
+			return errors.New("the bucket users doesn't exist")
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var u userRecord
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+
+			users = append(users, u.User)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes an user. Its links aren't removed
+func (d *DB) DeleteUser(username string) error {
+	return d.update(func(tx *bolt.Tx) error {
+		if _, err := readUser(tx, username); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte("users")).Delete([]byte(username))
+	})
+}
+
+// readUser reads an user inside a transaction
+func readUser(tx *bolt.Tx, username string) (*userRecord, error) {
+	b := tx.Bucket([]byte("users"))
+	if b == nil {
+		return nil, errors.New("the bucket users doesn't exist")
+	}
+
+	content := b.Get([]byte(username))
+	if content == nil {
+		return nil, ErrUserNotFound
+	}
+
+	u := &userRecord{}
+	if err := json.Unmarshal(content, u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// AppendAudit adds entries at the end of the audit log
+func (d *DB) AppendAudit(entries ...AuditEntry) error {
+	return d.update(func(tx *bolt.Tx) error {
+		return writeAudit(tx, entries...)
+	})
+}
+
+// appendAudit adds the entry of a change of a shortened URL to the audit log inside a transaction. If the audit
+// function is nil, the change isn't recorded
+func appendAudit(tx *bolt.Tx, audit AuditFunc, old, new *Link) error {
+	if audit == nil {
+		return nil
+	}
+
+	return writeAudit(tx, audit(old, new))
+}
+
+// writeAudit adds entries at the end of the audit log inside a transaction
+func writeAudit(tx *bolt.Tx, entries ...AuditEntry) error {
+	b := tx.Bucket([]byte("audit"))
+	if b == nil {
+		return errors.New("the bucket audit doesn't exist")
+	}
+
+	for _, e := range entries {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		// The key is the time of the entry followed by a sequence, so the entries are sorted chronologically
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint64(key, uint64(e.Time.UnixNano()))
+		binary.BigEndian.PutUint64(key[8:], seq)
+
+		val, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(key, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest to
+// the newest, until it returns an error
+func (d *DB) WalkAudit(f AuditFilter, fn func(e AuditEntry) error) error {
+	return d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("audit"))
+		if b == nil {
+			return errors.New("the bucket audit doesn't exist")
+		}
+
+		c := b.Cursor()
+
+		var k, v []byte
+		if f.Since.IsZero() {
+			k, v = c.First()
+		} else {
+			since := make([]byte, 8)
+			binary.BigEndian.PutUint64(since, uint64(f.Since.UnixNano()))
+			k, v = c.Seek(since)
+		}
+
+		n := 0
+		for ; k != nil; k, v = c.Next() {
+			var e AuditEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+				return nil
+			}
+
+			if !f.Match(e) {
+				continue
+			}
+
+			if err := fn(e); err != nil {
+				return err
+			}
+
+			n++
+			if f.Limit > 0 && n == f.Limit {
+				return nil
+			}
+		}
+
+		return nil
 	})
 }
@@ -1,7 +1,9 @@
 package db_test
 
 import (
+	"bytes"
 	"os"
+	"reflect"
 	"testing"
 
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
@@ -311,13 +313,15 @@ func TestAddURLErrInserting(t *testing.T) {
 			t.Fatalf("error inserting test data to the DB: %v", err)
 		}
 
+		// The policy allows the short URL, so the error is returned by Bolt
 		db := db.DB{
-			DB: boltDB,
+			DB:     boltDB,
+			Policy: &db.CodePolicy{MinLength: 1, MaxLength: bolt.MaxKeySize + 1},
 		}
 
 		expectedErr := "key too large"
 
-		longKey := make([]byte, bolt.MaxKeySize+1)
+		longKey := bytes.Repeat([]byte("a"), bolt.MaxKeySize+1)
 
 		err = db.AddURL(string(longKey), tt.longURL)
 		if err.Error() != expectedErr {
@@ -383,3 +387,319 @@ func TestInitializeErrBucket(t *testing.T) {
 		t.Fatalf("error finishing the test: %v", err)
 	}
 }
+
+// Should work as expected
+func TestListURLs(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		if err = boltDB.Update(func(tx *bolt.Tx) error {
+			var b *bolt.Bucket
+			b, err = tx.CreateBucket([]byte("urls"))
+			if err != nil {
+				return err
+			}
+
+			return b.Put([]byte(tt.shortURL), []byte(tt.longURL))
+		}); err != nil {
+			t.Fatalf("error inserting test data to the DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		expected := []db.Link{{ShortURL: tt.shortURL, LongURL: tt.longURL}}
+
+		rsp, err := d.ListURLs()
+		if err != nil {
+			t.Errorf("unexpected error listing the URLs: %v", err)
+		}
+
+		if !reflect.DeepEqual(rsp, expected) {
+			t.Errorf("expecting %v, but got %v", expected, rsp)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should work as expected
+func TestUpdateURL(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		if err = boltDB.Update(func(tx *bolt.Tx) error {
+			var b *bolt.Bucket
+			b, err = tx.CreateBucket([]byte("urls"))
+			if err != nil {
+				return err
+			}
+
+			return b.Put([]byte(tt.shortURL), []byte(tt.longURL))
+		}); err != nil {
+			t.Fatalf("error inserting test data to the DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		expected := "https://nefixestrada.com"
+
+		if err = d.UpdateURL(tt.shortURL, expected); err != nil {
+			t.Errorf("unexpected error updating the URL: %v", err)
+		}
+
+		rsp, err := d.ReadURL(tt.shortURL)
+		if err != nil {
+			t.Errorf("unexpected error when reading the URL in the DB: %v", err)
+		}
+
+		if rsp != expected {
+			t.Errorf("expecting %s, but got %s", expected, rsp)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should return a not found error
+func TestUpdateURLNotFound(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		err = d.UpdateURL(tt.shortURL, tt.longURL)
+		if err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// The long URL needs to be an URL
+func TestUpdateURLLongIsURL(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		err = d.UpdateURL(tt.shortURL, "https://notanurl!")
+		if err != db.ErrLongURLInvalid {
+			t.Errorf("expecting %v, but got %v", db.ErrLongURLInvalid, err)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should work as expected
+func TestDeleteURL(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		if err = d.AddURL(tt.shortURL, tt.longURL); err != nil {
+			t.Fatalf("error inserting test data to the DB: %v", err)
+		}
+
+		if err = d.DeleteURL(tt.shortURL); err != nil {
+			t.Errorf("unexpected error deleting the URL: %v", err)
+		}
+
+		if _, err = d.ReadURL(tt.shortURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should return a not found error
+func TestDeleteURLNotFound(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		err = d.DeleteURL(tt.shortURL)
+		if err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should work as expected
+func TestAddLinkGenerated(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		l := &db.Link{LongURL: tt.longURL}
+		if err = d.AddLink(l); err != nil {
+			t.Errorf("unexpected error adding the URL: %v", err)
+		}
+
+		shortURL := l.ShortURL
+
+		if len(shortURL) != db.DefaultLength {
+			t.Errorf("expecting %d, but got %d", db.DefaultLength, len(shortURL))
+		}
+
+		rsp, err := d.ReadURL(shortURL)
+		if err != nil {
+			t.Errorf("unexpected error when reading the URL in the DB: %v", err)
+		}
+
+		if rsp != tt.longURL {
+			t.Errorf("expecting %s, but got %s", tt.longURL, rsp)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should return an error when all the short URLs are already in use
+func TestAddLinkGeneratedExhausted(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+			Generator: &db.Generator{
+				Alphabet: "ab",
+				Length:   1,
+				Retries:  5,
+			},
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		for _, shortURL := range []string{"a", "b"} {
+			if err = d.AddURL(shortURL, tt.longURL); err != nil {
+				t.Fatalf("error inserting test data to the DB: %v", err)
+			}
+		}
+
+		err = d.AddLink(&db.Link{LongURL: tt.longURL})
+		if err != db.ErrGeneratorExhausted {
+			t.Errorf("expecting %v, but got %v", db.ErrGeneratorExhausted, err)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should work as expected
+func TestStats(t *testing.T) {
+	for _, tt := range tests {
+		boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+		if err != nil {
+			t.Fatalf("error creating the testing DB: %v", err)
+		}
+
+		d := db.DB{
+			DB: boltDB,
+		}
+
+		if err = d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		if err = d.AddURL(tt.shortURL, tt.longURL); err != nil {
+			t.Fatalf("error inserting test data to the DB: %v", err)
+		}
+
+		stats, err := d.Stats()
+		if err != nil {
+			t.Errorf("unexpected error getting the stats: %v", err)
+		}
+
+		if stats.Links != 1 {
+			t.Errorf("expecting %d, but got %d", 1, stats.Links)
+		}
+
+		if err := os.Remove("urlshortener.db"); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// testDisabled checks that the disabled links don't redirect until they are enabled again, and that the links keep
+// their creation time and their clicks
+func testDisabled(t *testing.T, s db.Store) {
+	before := time.Now().Add(-time.Second)
+
+	if err := s.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := s.RecordHits([]db.Hit{{ShortURL: "blog", Time: time.Now()}}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := s.SetDisabled("blog", true); err != nil {
+		t.Fatalf("unexpected error disabling the URL: %v", err)
+	}
+
+	if _, err := s.ReadURL("blog"); err != db.ErrDisabled {
+		t.Errorf("expecting %v, but got %v", db.ErrDisabled, err)
+	}
+
+	l, err := s.ReadLink("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if !l.Disabled {
+		t.Errorf("expecting %v, but got %v", true, l.Disabled)
+	}
+
+	if l.Clicks != 1 {
+		t.Errorf("expecting %d, but got %d", 1, l.Clicks)
+	}
+
+	if !l.CreatedAt.After(before) {
+		t.Errorf("expecting the creation time to be after %v, but got %v", before, l.CreatedAt)
+	}
+
+	if err := s.SetDisabled("blog", false); err != nil {
+		t.Fatalf("unexpected error enabling the URL: %v", err)
+	}
+
+	if _, err := s.ReadURL("blog"); err != nil {
+		t.Errorf("unexpected error reading the URL: %v", err)
+	}
+
+	if err := s.SetDisabled("notfound", true); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+}
+
+// Should work as expected
+func TestDisabled(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testDisabled(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryDisabled(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testDisabled(t, m)
+}
+
+// Should work as expected
+func TestSQLDisabled(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testDisabled(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
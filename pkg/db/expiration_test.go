@@ -0,0 +1,448 @@
+package db_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestLinkExpired(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		link     db.Link
+		clicks   int
+		expected bool
+	}{
+		{
+			link:     db.Link{},
+			clicks:   100,
+			expected: false,
+		},
+		{
+			link:     db.Link{ExpiresAt: &future},
+			expected: false,
+		},
+		{
+			link:     db.Link{ExpiresAt: &now},
+			expected: true,
+		},
+		{
+			link:     db.Link{MaxClicks: 3},
+			clicks:   2,
+			expected: false,
+		},
+		{
+			link:     db.Link{MaxClicks: 3},
+			clicks:   3,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		if expired := tt.link.Expired(now, tt.clicks); expired != tt.expected {
+			t.Errorf("expecting %t, but got %t", tt.expected, expired)
+		}
+	}
+}
+
+func testExpiration(t *testing.T, s db.Store) {
+	past := time.Now().Add(-time.Hour)
+	if err := s.AddLink(&db.Link{ShortURL: "past", LongURL: "https://nefixestrada.com", ExpiresAt: &past}); err != db.ErrExpiresAtPast {
+		t.Errorf("expecting %v, but got %v", db.ErrExpiresAtPast, err)
+	}
+
+	if err := s.AddLink(&db.Link{ShortURL: "negative", LongURL: "https://nefixestrada.com", MaxClicks: -1}); err != db.ErrMaxClicksNegative {
+		t.Errorf("expecting %v, but got %v", db.ErrMaxClicksNegative, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if err := s.AddLink(&db.Link{ShortURL: "ttl", LongURL: "https://nefixestrada.com", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := s.AddLink(&db.Link{ShortURL: "clicks", LongURL: "https://gitea.nefixestrada.com", MaxClicks: 2}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := s.AddURL("forever", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	l, err := s.ReadLink("ttl")
+	if err != nil {
+		t.Errorf("unexpected error reading the link: %v", err)
+	}
+
+	if l.ExpiresAt == nil || !l.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expecting %v, but got %v", expiresAt, l.ExpiresAt)
+	}
+
+	if _, err = s.ReadURL("ttl"); err != nil {
+		t.Errorf("unexpected error reading the URL: %v", err)
+	}
+
+	// The link expires when reaching the maximum number of clicks
+	if _, err = s.ReadURL("clicks"); err != nil {
+		t.Errorf("unexpected error reading the URL: %v", err)
+	}
+
+	if err = s.RecordHits([]db.Hit{{ShortURL: "clicks", Time: time.Now()}, {ShortURL: "clicks", Time: time.Now()}}); err != nil {
+		t.Errorf("unexpected error recording the hits: %v", err)
+	}
+
+	if _, err = s.ReadURL("clicks"); err != db.ErrExpired {
+		t.Errorf("expecting %v, but got %v", db.ErrExpired, err)
+	}
+
+	// The expired links can still be read until they're removed
+	l, err = s.ReadLink("clicks")
+	if err != nil {
+		t.Errorf("unexpected error reading the link: %v", err)
+	}
+
+	if l.MaxClicks != 2 {
+		t.Errorf("expecting %d, but got %d", 2, l.MaxClicks)
+	}
+
+	deleted, err := s.DeleteExpired(time.Now())
+	if err != nil {
+		t.Errorf("unexpected error deleting the expired URLs: %v", err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("expecting %d, but got %d", 1, deleted)
+	}
+
+	if _, err = s.ReadLink("clicks"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	// The link expires when reaching the expiration date
+	deleted, err = s.DeleteExpired(expiresAt)
+	if err != nil {
+		t.Errorf("unexpected error deleting the expired URLs: %v", err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("expecting %d, but got %d", 1, deleted)
+	}
+
+	if _, err = s.ReadURL("ttl"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	if _, err = s.ReadURL("forever"); err != nil {
+		t.Errorf("unexpected error reading the URL: %v", err)
+	}
+}
+
+// Should work as expected
+func TestExpiration(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testExpiration(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryExpiration(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testExpiration(t, m)
+}
+
+// Should work as expected
+func TestSQLExpiration(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testExpiration(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should remove the expired links periodically
+func TestJanitor(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	if err := m.AddLink(&db.Link{ShortURL: "git", LongURL: "https://gitea.nefixestrada.com", MaxClicks: 1}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := m.RecordHits([]db.Hit{{ShortURL: "git", Time: time.Now()}}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	j := db.NewJanitor(m, 10*time.Millisecond)
+	defer j.Close()
+
+	for i := 0; i < 100; i++ {
+		if _, err := m.ReadLink("git"); err == db.ErrNotFound {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("expecting %v, but the link wasn't removed", db.ErrNotFound)
+}
+
+// testMaxClicks checks that following the links with a maximum number of clicks counts the clicks atomically, so the
+// concurrent redirects can't exceed the limit, and that their hits aren't counted again when they're recorded
+func testMaxClicks(t *testing.T, s db.Store) {
+	const maxClicks, extra = 5, 10
+
+	if err := s.AddLink(&db.Link{ShortURL: "limited", LongURL: "https://nefixestrada.com", MaxClicks: maxClicks}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := s.AddURL("forever", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, maxClicks+extra)
+
+	for i := 0; i < maxClicks+extra; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s.FollowLink("limited")
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	followed, expired := 0, 0
+	for err := range errs {
+		switch err {
+		case nil:
+			followed++
+
+		case db.ErrExpired:
+			expired++
+
+		default:
+			t.Errorf("unexpected error following the link: %v", err)
+		}
+	}
+
+	if followed != maxClicks || expired != extra {
+		t.Errorf("expecting %d followed and %d expired, but got %d and %d", maxClicks, extra, followed, expired)
+	}
+
+	// The hits of the clicks already counted are stored, but not counted again
+	hits := []db.Hit{}
+	for i := 0; i < maxClicks; i++ {
+		hits = append(hits, db.Hit{ShortURL: "limited", Time: time.Now(), Counted: true})
+	}
+
+	if err := s.RecordHits(hits); err != nil {
+		t.Fatalf("unexpected error recording the hits: %v", err)
+	}
+
+	stats, err := s.Clicks("limited")
+	if err != nil {
+		t.Fatalf("unexpected error reading the clicks: %v", err)
+	}
+
+	if stats.Total != maxClicks {
+		t.Errorf("expecting %d, but got %d", maxClicks, stats.Total)
+	}
+
+	if _, err := s.ReadURL("limited"); err != db.ErrExpired {
+		t.Errorf("expecting %v, but got %v", db.ErrExpired, err)
+	}
+
+	// The links without maximum number of clicks are counted when their hits are recorded
+	l, err := s.FollowLink("forever")
+	if err != nil {
+		t.Fatalf("unexpected error following the link: %v", err)
+	}
+
+	if l.LongURL != "https://nefixestrada.com" || l.Clicks != 0 {
+		t.Errorf("expecting %s with %d clicks, but got %s with %d", "https://nefixestrada.com", 0, l.LongURL, l.Clicks)
+	}
+
+	if _, err := s.FollowLink("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+}
+
+// Should work as expected
+func TestMaxClicks(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testMaxClicks(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryMaxClicks(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testMaxClicks(t, m)
+}
+
+// Should work as expected
+func TestSQLMaxClicks(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testMaxClicks(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should follow the links without maximum number of clicks in read-only transactions, so the concurrent redirects
+// don't wait for each other nor for the writes
+func TestFollowLinkUnlimited(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	writable := 0
+	d := &db.DB{
+		DB: boltDB,
+		ObserveTx: func(w bool, _ time.Duration) {
+			if w {
+				writable++
+			}
+		},
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("forever", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	writable = 0
+
+	// Keep a read-write transaction open while following the link
+	locked, release, finished := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		finished <- boltDB.Update(func(tx *bolt.Tx) error {
+			close(locked)
+			<-release
+
+			return nil
+		})
+	}()
+
+	<-locked
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := d.FollowLink("forever")
+			errs <- err
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expecting the redirects to finish, but they're waiting for the read-write transaction")
+	}
+
+	close(release)
+	if err := <-finished; err != nil {
+		t.Fatalf("unexpected error finishing the read-write transaction: %v", err)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error following the link: %v", err)
+		}
+	}
+
+	if writable != 0 {
+		t.Errorf("expecting %d read-write transactions, but got %d", 0, writable)
+	}
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
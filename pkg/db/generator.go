@@ -0,0 +1,108 @@
+package db
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultAlphabet is the alphabet used by default when generating short URLs (base62)
+	DefaultAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// DefaultLowerAlphabet is the alphabet used by default when generating case insensitive short URLs (base36)
+	DefaultLowerAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	// DefaultLength is the length used by default when generating short URLs
+	DefaultLength = 6
+
+	// DefaultRetries is the number of times that a short URL is generated again if it's already in use
+	DefaultRetries = 10
+)
+
+// ErrGeneratorExhausted is returned when it's not possible to generate a short URL that isn't already in use
+var ErrGeneratorExhausted = errors.New("couldn't generate a short URL that isn't already in use, try increasing the length")
+
+// Generator generates random short URLs
+type Generator struct {
+	// Alphabet are the characters that can be used in the short URLs
+	Alphabet string
+	// Length is the number of characters of the short URLs
+	Length int
+	// Retries is the number of times that a short URL is generated again if it's already in use
+	Retries int
+}
+
+// DefaultGenerator returns a generator with the default configuration
+func DefaultGenerator() *Generator {
+	return &Generator{
+		Alphabet: DefaultAlphabet,
+		Length:   DefaultLength,
+		Retries:  DefaultRetries,
+	}
+}
+
+// generatorOrDefault returns the generator provided or the default one if it's nil
+func generatorOrDefault(g *Generator) *Generator {
+	if g == nil {
+		return DefaultGenerator()
+	}
+
+	return g
+}
+
+// generateUnused generates short URLs with the prefix provided until it finds one that isn't in use nor reserved. The
+// short URLs are made canonical with the code policy. If it doesn't find one after all the retries of the generator,
+// it returns ErrGeneratorExhausted
+func generateUnused(g *Generator, p *CodePolicy, prefix string, inUse func(shortURL string) bool) (string, error) {
+	for i := 0; i <= g.Retries; i++ {
+		code, err := g.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		shortURL := p.Canonical(prefix + code)
+
+		if !IsReserved(shortURL) && !inUse(shortURL) {
+			return shortURL, nil
+		}
+	}
+
+	return "", ErrGeneratorExhausted
+}
+
+// Validate checks that the configuration of the generator is valid
+func (g *Generator) Validate() error {
+	if utf8.RuneCountInString(g.Alphabet) < 2 {
+		return errors.New("the generator alphabet needs to have at least two characters")
+	}
+
+	if g.Length < 1 {
+		return errors.New("the generator length needs to be at least one")
+	}
+
+	if g.Retries < 0 {
+		return errors.New("the generator retries can't be negative")
+	}
+
+	return nil
+}
+
+// Generate returns a new random short URL
+func (g *Generator) Generate() (string, error) {
+	alphabet := []rune(g.Alphabet)
+	max := big.NewInt(int64(len(alphabet)))
+
+	shortURL := make([]rune, g.Length)
+	for i := range shortURL {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+
+		shortURL[i] = alphabet[n.Int64()]
+	}
+
+	return string(shortURL), nil
+}
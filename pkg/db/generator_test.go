@@ -0,0 +1,68 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestGenerate(t *testing.T) {
+	g := &db.Generator{
+		Alphabet: "ab",
+		Length:   8,
+	}
+
+	shortURL, err := g.Generate()
+	if err != nil {
+		t.Errorf("unexpected error generating the short URL: %v", err)
+	}
+
+	if len(shortURL) != g.Length {
+		t.Errorf("expecting %d, but got %d", g.Length, len(shortURL))
+	}
+
+	if strings.Trim(shortURL, g.Alphabet) != "" {
+		t.Errorf("expecting only characters of %s, but got %s", g.Alphabet, shortURL)
+	}
+}
+
+// Should return an error when the configuration isn't valid
+func TestGeneratorValidate(t *testing.T) {
+	tests := []struct {
+		generator   *db.Generator
+		expectedErr string
+	}{
+		{
+			generator: db.DefaultGenerator(),
+		},
+		{
+			generator:   &db.Generator{Alphabet: "a", Length: 6},
+			expectedErr: "the generator alphabet needs to have at least two characters",
+		},
+		{
+			generator:   &db.Generator{Alphabet: "ab", Length: 0},
+			expectedErr: "the generator length needs to be at least one",
+		},
+		{
+			generator:   &db.Generator{Alphabet: "ab", Length: 6, Retries: -1},
+			expectedErr: "the generator retries can't be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.generator.Validate()
+		if tt.expectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error validating the generator: %v", err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != tt.expectedErr {
+			t.Errorf("expecting %s, but got %v", tt.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// testHistory checks that the previous targets of the links are kept when they are updated or overwritten, and that
+// they are removed with the links
+func testHistory(t *testing.T, s db.Store) {
+	if err := s.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	history, err := s.History("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the history: %v", err)
+	}
+
+	if len(history) != 0 {
+		t.Errorf("expecting %d, but got %d", 0, len(history))
+	}
+
+	if err := s.UpdateURL("blog", "https://blog.nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error updating the URL: %v", err)
+	}
+
+	// Updating to the same target shouldn't add anything to the history
+	if err := s.UpdateURL("blog", "https://blog.nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error updating the URL: %v", err)
+	}
+
+	if _, err := s.ImportLinks([]db.Link{{ShortURL: "blog", LongURL: "https://golang.org"}}, db.ImportOptions{Conflict: db.ConflictOverwrite}); err != nil {
+		t.Fatalf("unexpected error importing the URL: %v", err)
+	}
+
+	history, err = s.History("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the history: %v", err)
+	}
+
+	expected := []string{"https://nefixestrada.com", "https://blog.nefixestrada.com"}
+	if len(history) != len(expected) {
+		t.Fatalf("expecting %v, but got %v", expected, history)
+	}
+
+	for i, c := range history {
+		if c.LongURL != expected[i] {
+			t.Errorf("expecting %s, but got %s", expected[i], c.LongURL)
+		}
+
+		if c.ReplacedAt.IsZero() {
+			t.Errorf("expecting the replacement time to be set")
+		}
+	}
+
+	if history[1].ReplacedAt.Before(history[0].ReplacedAt) {
+		t.Errorf("expecting %v to be before %v", history[0].ReplacedAt, history[1].ReplacedAt)
+	}
+
+	if err := s.DeleteURL("blog"); err != nil {
+		t.Fatalf("unexpected error deleting the URL: %v", err)
+	}
+
+	if err := s.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	history, err = s.History("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the history: %v", err)
+	}
+
+	if len(history) != 0 {
+		t.Errorf("expecting %d, but got %d", 0, len(history))
+	}
+
+	if _, err := s.History("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+}
+
+// Should work as expected
+func TestHistory(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testHistory(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryHistory(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testHistory(t, m)
+}
+
+// Should work as expected
+func TestSQLHistory(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testHistory(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
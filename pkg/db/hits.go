@@ -0,0 +1,145 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// maxTopReferrers is the maximum number of referrers returned in the click statistics
+	maxTopReferrers = 10
+	// maxTopCountries is the maximum number of countries returned in the click statistics
+	maxTopCountries = 10
+)
+
+// Hit is a visit to a shortened URL
+type Hit struct {
+	ShortURL  string    `json:"-"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	// Counted is whether the click has already been counted when following the shortened URL (see FollowLink), so
+	// recording the hit doesn't count it again
+	Counted bool `json:"-"`
+}
+
+// ClickStats are the click statistics of a shortened URL
+type ClickStats struct {
+	ShortURL     string           `json:"shortURL"`
+	Total        int              `json:"total"`
+	PerDay       []DayClicks      `json:"perDay"`
+	TopReferrers []ReferrerClicks `json:"topReferrers"`
+	TopCountries []CountryClicks  `json:"topCountries"`
+}
+
+// DayClicks are the clicks that a shortened URL had in a day
+type DayClicks struct {
+	Day    string `json:"day"`
+	Clicks int    `json:"clicks"`
+}
+
+// ReferrerClicks are the clicks that a shortened URL had from a referrer
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"`
+	Clicks   int    `json:"clicks"`
+}
+
+// CountryClicks are the clicks that a shortened URL had from a country
+type CountryClicks struct {
+	Country string `json:"country"`
+	Clicks  int    `json:"clicks"`
+}
+
+// clickCounts are the clicks of a shortened URL counted by day (in UTC), referrer and country. They are updated when
+// the hits are recorded, so the statistics don't need to read every hit of the shortened URL
+type clickCounts struct {
+	days      map[string]int
+	referrers map[string]int
+	countries map[string]int
+}
+
+// newClickCounts returns empty click counts
+func newClickCounts() *clickCounts {
+	return &clickCounts{
+		days:      map[string]int{},
+		referrers: map[string]int{},
+		countries: map[string]int{},
+	}
+}
+
+// hitDay returns the day of a hit, in UTC
+func hitDay(h Hit) string {
+	return h.Time.UTC().Format("2006-01-02")
+}
+
+// add counts a hit. The hits without referrer or country aren't counted in the referrers or the countries
+func (c *clickCounts) add(h Hit) {
+	c.days[hitDay(h)]++
+
+	if h.Referrer != "" {
+		c.referrers[h.Referrer]++
+	}
+
+	if h.Country != "" {
+		c.countries[h.Country]++
+	}
+}
+
+// newClickStats returns the click statistics of a shortened URL from its click counts. The days are sorted
+// chronologically, and the referrers and the countries are sorted by number of clicks
+func newClickStats(shortURL string, total int, counts *clickCounts) *ClickStats {
+	if counts == nil {
+		counts = newClickCounts()
+	}
+
+	stats := &ClickStats{
+		ShortURL:     shortURL,
+		Total:        total,
+		PerDay:       []DayClicks{},
+		TopReferrers: []ReferrerClicks{},
+		TopCountries: []CountryClicks{},
+	}
+
+	for day, clicks := range counts.days {
+		stats.PerDay = append(stats.PerDay, DayClicks{Day: day, Clicks: clicks})
+	}
+
+	sort.Slice(stats.PerDay, func(i, j int) bool {
+		return stats.PerDay[i].Day < stats.PerDay[j].Day
+	})
+
+	for referrer, clicks := range counts.referrers {
+		stats.TopReferrers = append(stats.TopReferrers, ReferrerClicks{Referrer: referrer, Clicks: clicks})
+	}
+
+	sort.Slice(stats.TopReferrers, func(i, j int) bool {
+		if stats.TopReferrers[i].Clicks == stats.TopReferrers[j].Clicks {
+			return stats.TopReferrers[i].Referrer < stats.TopReferrers[j].Referrer
+		}
+
+		return stats.TopReferrers[i].Clicks > stats.TopReferrers[j].Clicks
+	})
+
+	if len(stats.TopReferrers) > maxTopReferrers {
+		stats.TopReferrers = stats.TopReferrers[:maxTopReferrers]
+	}
+
+	for country, clicks := range counts.countries {
+		stats.TopCountries = append(stats.TopCountries, CountryClicks{Country: country, Clicks: clicks})
+	}
+
+	sort.Slice(stats.TopCountries, func(i, j int) bool {
+		if stats.TopCountries[i].Clicks == stats.TopCountries[j].Clicks {
+			return stats.TopCountries[i].Country < stats.TopCountries[j].Country
+		}
+
+		return stats.TopCountries[i].Clicks > stats.TopCountries[j].Clicks
+	})
+
+	if len(stats.TopCountries) > maxTopCountries {
+		stats.TopCountries = stats.TopCountries[:maxTopCountries]
+	}
+
+	return stats
+}
@@ -0,0 +1,204 @@
+package db_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// testHits are the hits used when testing the click statistics of the stores
+var testHits = []db.Hit{
+	{ShortURL: "git", Time: time.Date(2018, 10, 1, 10, 0, 0, 0, time.UTC), Referrer: "https://nefixestrada.com", UserAgent: "curl", Country: "ES"},
+	{ShortURL: "git", Time: time.Date(2018, 10, 1, 23, 0, 0, 0, time.UTC), Referrer: "https://golang.org"},
+	{ShortURL: "git", Time: time.Date(2018, 10, 3, 12, 0, 0, 0, time.UTC), Referrer: "https://nefixestrada.com"},
+	{ShortURL: "git", Time: time.Date(2018, 10, 3, 13, 0, 0, 0, time.UTC)},
+	{ShortURL: "notfound", Time: time.Date(2018, 10, 3, 13, 0, 0, 0, time.UTC)},
+}
+
+// expectedClickStats are the click statistics expected after recording testHits
+var expectedClickStats = &db.ClickStats{
+	ShortURL: "git",
+	Total:    4,
+	PerDay: []db.DayClicks{
+		{Day: "2018-10-01", Clicks: 2},
+		{Day: "2018-10-03", Clicks: 2},
+	},
+	TopReferrers: []db.ReferrerClicks{
+		{Referrer: "https://nefixestrada.com", Clicks: 2},
+		{Referrer: "https://golang.org", Clicks: 1},
+	},
+	TopCountries: []db.CountryClicks{
+		{Country: "ES", Clicks: 1},
+	},
+}
+
+// testClicks records testHits in the store and checks the click statistics
+func testClicks(t *testing.T, s db.Store) {
+	if err := s.AddURL("git", "https://gitea.nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	stats, err := s.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if stats.Total != 0 || len(stats.PerDay) != 0 || len(stats.TopReferrers) != 0 {
+		t.Errorf("expecting no clicks, but got %v", stats)
+	}
+
+	if err = s.RecordHits(testHits[:2]); err != nil {
+		t.Errorf("unexpected error recording the hits: %v", err)
+	}
+
+	if err = s.RecordHits(testHits[2:]); err != nil {
+		t.Errorf("unexpected error recording the hits: %v", err)
+	}
+
+	stats, err = s.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if !reflect.DeepEqual(stats, expectedClickStats) {
+		t.Errorf("expecting %v, but got %v", expectedClickStats, stats)
+	}
+
+	if _, err = s.Clicks("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	// The hits are deleted with the shortened URL
+	if err = s.DeleteURL("git"); err != nil {
+		t.Errorf("unexpected error deleting the URL: %v", err)
+	}
+
+	if err := s.AddURL("git", "https://gitea.nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	stats, err = s.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if stats.Total != 0 || len(stats.PerDay) != 0 {
+		t.Errorf("expecting no clicks, but got %v", stats)
+	}
+}
+
+// Should work as expected
+func TestClicks(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testClicks(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should count the hits stored by older versions, which didn't keep the click counts
+func TestClicksMigration(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("git", "https://gitea.nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err = d.RecordHits(testHits); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err = boltDB.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("counts"))
+	}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Errorf("unexpected error initializing the DB: %v", err)
+	}
+
+	stats, err := d.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if !reflect.DeepEqual(stats, expectedClickStats) {
+		t.Errorf("expecting %v, but got %v", expectedClickStats, stats)
+	}
+
+	// Initializing it again doesn't count the hits twice
+	if err = d.Initialize(); err != nil {
+		t.Errorf("unexpected error initializing the DB: %v", err)
+	}
+
+	stats, err = d.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if !reflect.DeepEqual(stats, expectedClickStats) {
+		t.Errorf("expecting %v, but got %v", expectedClickStats, stats)
+	}
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryClicks(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testClicks(t, m)
+}
+
+// Should work as expected
+func TestSQLClicks(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testClicks(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package db
+
+// ConflictPolicy is what to do when importing a shortened URL that already exists
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing shortened URL and skips the imported one
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing shortened URL with the imported one. The clicks are kept
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail stops the import, without importing any of the shortened URLs of the batch
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ErrConflictPolicyInvalid is returned when the conflict policy of an import doesn't exist
+var ErrConflictPolicyInvalid = &ValidationError{"the conflict policy needs to be skip, overwrite or fail"}
+
+// Validate checks that the conflict policy exists. The empty one is valid, and it skips the shortened URLs
+func (c ConflictPolicy) Validate() error {
+	switch c {
+	case "", ConflictSkip, ConflictOverwrite, ConflictFail:
+		return nil
+
+	default:
+		return ErrConflictPolicyInvalid
+	}
+}
+
+// ImportOptions are the options of an import of shortened URLs
+type ImportOptions struct {
+	// Conflict is what to do with the shortened URLs that already exist. If it's empty, they are skipped
+	Conflict ConflictPolicy
+	// DryRun validates the shortened URLs and checks the conflicts without importing them
+	DryRun bool
+}
+
+// ImportStatus is the result of importing a shortened URL
+type ImportStatus string
+
+const (
+	// ImportCreated is the status of the shortened URLs that didn't exist
+	ImportCreated ImportStatus = "created"
+	// ImportOverwritten is the status of the shortened URLs that existed and have been replaced
+	ImportOverwritten ImportStatus = "overwritten"
+	// ImportSkipped is the status of the shortened URLs that existed and have been kept
+	ImportSkipped ImportStatus = "skipped"
+	// ImportInvalid is the status of the shortened URLs that aren't valid
+	ImportInvalid ImportStatus = "invalid"
+	// ImportConflict is the status of the shortened URL that existed and stopped the import
+	ImportConflict ImportStatus = "conflict"
+)
+
+// ImportResult is the result of importing a shortened URL. In a dry run, it's what would happen when importing it
+type ImportResult struct {
+	ShortURL string       `json:"shortURL"`
+	Status   ImportStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// importer imports a batch of shortened URLs into a store. The shortened URLs are validated and their conflicts are
+// checked first, and they are only written if none of them stops the import, so each store can write a batch at once
+type importer struct {
+	generator *Generator
+	policy    *CodePolicy
+	// exists returns whether a short URL is already in the store
+	exists func(shortURL string) (bool, error)
+	// write writes a shortened URL into the store, replacing the existing one if overwrite is true
+	write func(l *Link, overwrite bool) error
+}
+
+// importWrite is a shortened URL that is going to be written by an importer
+type importWrite struct {
+	link      *Link
+	overwrite bool
+}
+
+// run imports the shortened URLs and returns the result of each one of them, in the same order. If the conflict
+// policy is ConflictFail and a shortened URL already exists, the results until it are returned with ErrAlreadyExists
+// and none of the shortened URLs is written. The owners of the shortened URLs aren't checked
+func (im *importer) run(links []Link, opts ImportOptions) ([]ImportResult, error) {
+	if err := opts.Conflict.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+
+	results := make([]ImportResult, 0, len(links))
+	pending := map[string]bool{}
+	writes := []importWrite{}
+
+	for i := range links {
+		l := &links[i]
+
+		if err := prepareLink(l, policyOrDefault(im.policy)); err != nil {
+			results = append(results, ImportResult{ShortURL: l.ShortURL, Status: ImportInvalid, Error: err.Error()})
+			continue
+		}
+
+		status := ImportCreated
+
+		if l.ShortURL == "" {
+			var existsErr error
+			shortURL, err := generateUnused(generatorOrDefault(im.generator), policyOrDefault(im.policy), "", func(shortURL string) bool {
+				exists, err := im.exists(shortURL)
+				if err != nil {
+					existsErr = err
+				}
+
+				return pending[shortURL] || exists || err != nil
+			})
+			if existsErr != nil {
+				return results, existsErr
+			}
+
+			if err != nil {
+				return results, err
+			}
+
+			l.ShortURL = shortURL
+
+		} else {
+			exists, err := im.exists(l.ShortURL)
+			if err != nil {
+				return results, err
+			}
+
+			if exists || pending[l.ShortURL] {
+				switch opts.Conflict {
+				case ConflictSkip:
+					results = append(results, ImportResult{ShortURL: l.ShortURL, Status: ImportSkipped})
+					continue
+
+				case ConflictFail:
+					results = append(results, ImportResult{ShortURL: l.ShortURL, Status: ImportConflict, Error: ErrAlreadyExists.Error()})
+					return results, ErrAlreadyExists
+				}
+
+				status = ImportOverwritten
+			}
+		}
+
+		pending[l.ShortURL] = true
+		writes = append(writes, importWrite{link: l, overwrite: status == ImportOverwritten})
+		results = append(results, ImportResult{ShortURL: l.ShortURL, Status: status})
+	}
+
+	if opts.DryRun {
+		return results, nil
+	}
+
+	for _, w := range writes {
+		if err := im.write(w.link, w.overwrite); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
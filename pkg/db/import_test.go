@@ -0,0 +1,176 @@
+package db_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// testImport checks the conflict policies, the dry runs and the validation of the imports
+func testImport(t *testing.T, s db.Store) {
+	if err := s.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := s.RecordHits([]db.Hit{{ShortURL: "blog", Time: time.Now()}}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	links := func() []db.Link {
+		return []db.Link{
+			{ShortURL: "blog", LongURL: "https://blog.nefixestrada.com"},
+			{ShortURL: "go", LongURL: "https://golang.org", CreatedAt: createdAt},
+			{ShortURL: "bad", LongURL: "notanurl"},
+		}
+	}
+
+	// Dry run
+	results, err := s.ImportLinks(links(), db.ImportOptions{Conflict: db.ConflictOverwrite, DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	expected := []db.ImportResult{
+		{ShortURL: "blog", Status: db.ImportOverwritten},
+		{ShortURL: "go", Status: db.ImportCreated},
+		{ShortURL: "bad", Status: db.ImportInvalid, Error: db.ErrLongURLInvalid.Error()},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expecting %v, but got %v", expected, results)
+	}
+
+	if _, err := s.ReadLink("go"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	// Fail
+	results, err = s.ImportLinks(links(), db.ImportOptions{Conflict: db.ConflictFail})
+	if err != db.ErrAlreadyExists {
+		t.Errorf("expecting %v, but got %v", db.ErrAlreadyExists, err)
+	}
+
+	expected = []db.ImportResult{
+		{ShortURL: "blog", Status: db.ImportConflict, Error: db.ErrAlreadyExists.Error()},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expecting %v, but got %v", expected, results)
+	}
+
+	// Skip
+	results, err = s.ImportLinks(links(), db.ImportOptions{Conflict: db.ConflictSkip})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	if results[0].Status != db.ImportSkipped {
+		t.Errorf("expecting %v, but got %v", db.ImportSkipped, results[0].Status)
+	}
+
+	l, err := s.ReadLink("go")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if !l.CreatedAt.Equal(createdAt) {
+		t.Errorf("expecting %v, but got %v", createdAt, l.CreatedAt)
+	}
+
+	// Overwrite
+	if _, err := s.ImportLinks(links(), db.ImportOptions{Conflict: db.ConflictOverwrite}); err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	l, err = s.ReadLink("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if l.LongURL != "https://blog.nefixestrada.com" {
+		t.Errorf("expecting %s, but got %s", "https://blog.nefixestrada.com", l.LongURL)
+	}
+
+	if l.Clicks != 1 {
+		t.Errorf("expecting %d, but got %d", 1, l.Clicks)
+	}
+
+	// Generated
+	generated := []db.Link{{LongURL: "https://golang.org"}}
+	results, err = s.ImportLinks(generated, db.ImportOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	if results[0].ShortURL == "" || results[0].Status != db.ImportCreated {
+		t.Errorf("expecting a created link with a generated short URL, but got %v", results[0])
+	}
+
+	// Invalid policy
+	if _, err := s.ImportLinks(links(), db.ImportOptions{Conflict: "merge"}); err != db.ErrConflictPolicyInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrConflictPolicyInvalid, err)
+	}
+
+	walked := []string{}
+	if err := s.WalkURLs(func(l db.Link) error {
+		walked = append(walked, l.ShortURL)
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error walking the links: %v", err)
+	}
+
+	if len(walked) != 3 || walked[0] > walked[1] || walked[1] > walked[2] {
+		t.Errorf("expecting 3 links sorted by short URL, but got %v", walked)
+	}
+}
+
+// Should work as expected
+func TestImport(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testImport(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryImport(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testImport(t, m)
+}
+
+// Should work as expected
+func TestSQLImport(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testImport(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
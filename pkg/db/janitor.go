@@ -0,0 +1,68 @@
+package db
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Janitor removes the expired shortened URLs of a store periodically in the background
+type Janitor struct {
+	store    Store
+	interval time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewJanitor creates a new janitor and starts removing the expired shortened URLs every interval. It needs to be
+// closed in order to stop it
+func NewJanitor(store Store, interval time.Duration) *Janitor {
+	j := &Janitor{
+		store:    store,
+		interval: interval,
+
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go j.run()
+
+	return j
+}
+
+// Close stops the janitor, waiting for the current purge to finish
+func (j *Janitor) Close() {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+
+	<-j.done
+}
+
+// run removes the expired shortened URLs every interval until the janitor is closed
+func (j *Janitor) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+
+		case now := <-ticker.C:
+			deleted, err := j.store.DeleteExpired(now)
+			if err != nil {
+				slog.Error("error removing the expired shortened URLs", "err", err)
+				continue
+			}
+
+			if deleted > 0 {
+				slog.Info("Removed the expired shortened URLs", "deleted", deleted)
+			}
+		}
+	}
+}
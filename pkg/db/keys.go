@@ -0,0 +1,74 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrKeyInvalid is returned when checking an API key that doesn't exist
+	ErrKeyInvalid = errors.New("the API key isn't valid")
+
+	// ErrKeyNotFound is returned when the API key with the name provided doesn't exist
+	ErrKeyNotFound = errors.New("the API key wasn't found in the DB")
+
+	// ErrKeyAlreadyExists is returned when adding an API key with a name that is already in use
+	ErrKeyAlreadyExists = errors.New("there's already an API key with that name")
+
+	// ErrKeyNameEmpty is returned when the name of an API key is empty
+	ErrKeyNameEmpty = &ValidationError{"the API key name can't be empty"}
+)
+
+// keyPrefixLength is the number of characters of the API keys that are stored in clear, so they can be identified
+const keyPrefixLength = 8
+
+// KeyStore is the interface that needs to be implemented by the storage backends that store the API keys. The keys
+// are only returned when they are created, since only their hash is stored
+type KeyStore interface {
+	// AddKey creates a new API key with the name provided and returns it
+	AddKey(name string) (string, error)
+	// CheckKey returns the API key if it's valid. If it isn't, it returns ErrKeyInvalid
+	CheckKey(key string) (*APIKey, error)
+	// ListKeys returns all the API keys, sorted by name
+	ListKeys() ([]APIKey, error)
+	// DeleteKey removes the API key with the name provided
+	DeleteKey(name string) error
+}
+
+// APIKey is an API key, without the key itself
+type APIKey struct {
+	Name string `json:"name"`
+	// Prefix are the first characters of the key, used to identify it
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// newKey generates a new API key. It returns the key, its hash and the API key to be stored
+func newKey(name string) (string, string, *APIKey, error) {
+	if name == "" {
+		return "", "", nil, ErrKeyNameEmpty
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", nil, err
+	}
+
+	key := hex.EncodeToString(b)
+
+	return key, hashKey(key), &APIKey{
+		Name:      name,
+		Prefix:    key[:keyPrefixLength],
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// hashKey returns the hash of an API key. The keys are random, so they don't need a slow hash or a salt
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+func testKeys(t *testing.T, s db.KeyStore) {
+	key, err := s.AddKey("ci")
+	if err != nil {
+		t.Fatalf("unexpected error adding the API key: %v", err)
+	}
+
+	if _, err = s.AddKey("ci"); err != db.ErrKeyAlreadyExists {
+		t.Errorf("expecting %v, but got %v", db.ErrKeyAlreadyExists, err)
+	}
+
+	if _, err = s.AddKey(""); err != db.ErrKeyNameEmpty {
+		t.Errorf("expecting %v, but got %v", db.ErrKeyNameEmpty, err)
+	}
+
+	if _, err = s.AddKey("admin"); err != nil {
+		t.Errorf("unexpected error adding the API key: %v", err)
+	}
+
+	k, err := s.CheckKey(key)
+	if err != nil {
+		t.Errorf("unexpected error checking the API key: %v", err)
+	}
+
+	if k.Name != "ci" || k.Prefix != key[:8] || k.CreatedAt.IsZero() {
+		t.Errorf("unexpected API key: %v", k)
+	}
+
+	if _, err = s.CheckKey("invalid"); err != db.ErrKeyInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrKeyInvalid, err)
+	}
+
+	keys, err := s.ListKeys()
+	if err != nil {
+		t.Errorf("unexpected error listing the API keys: %v", err)
+	}
+
+	if len(keys) != 2 || keys[0].Name != "admin" || keys[1].Name != "ci" {
+		t.Errorf("expecting the keys admin and ci, but got %v", keys)
+	}
+
+	if err = s.DeleteKey("ci"); err != nil {
+		t.Errorf("unexpected error deleting the API key: %v", err)
+	}
+
+	if _, err = s.CheckKey(key); err != db.ErrKeyInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrKeyInvalid, err)
+	}
+
+	if err = s.DeleteKey("ci"); err != db.ErrKeyNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrKeyNotFound, err)
+	}
+}
+
+// Should work as expected
+func TestKeys(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testKeys(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryKeys(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testKeys(t, m)
+}
+
+// Should work as expected
+func TestSQLKeys(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testKeys(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
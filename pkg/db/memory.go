@@ -0,0 +1,781 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory needs to implement the Store, KeyStore, UserStore, AuditLog and AuditStore interfaces
+var _ Store = &Memory{}
+var _ KeyStore = &Memory{}
+var _ UserStore = &Memory{}
+var _ AuditLog = &Memory{}
+var _ AuditStore = &Memory{}
+
+// Memory is a Store that keeps all the shortened URLs in memory. It's useful for testing and ephemeral runs, since
+// all the data is lost when the program finishes
+type Memory struct {
+	// Generator is used to generate the short URLs when they aren't provided. If it's nil, the default one is used
+	Generator *Generator
+
+	// Policy are the rules that the short URLs need to follow. If it's nil, the default one is used
+	Policy *CodePolicy
+
+	mux    sync.RWMutex
+	urls   map[string]Link
+	clicks map[string]int
+	// counts are the clicks of the shortened URLs by day, referrer and country. The hits themselves aren't kept
+	counts map[string]*clickCounts
+	// history are the previous targets of the shortened URLs
+	history map[string][]TargetChange
+	keys    map[string]APIKey
+	users   map[string]userRecord
+	audit   []AuditEntry
+}
+
+// errMemoryNotInitialized is returned when the memory store is used before being initialized
+var errMemoryNotInitialized = errors.New("the memory store isn't initialized")
+
+// canonical returns the short URL as it's stored, following the code policy
+func (m *Memory) canonical(shortURL string) string {
+	return policyOrDefault(m.Policy).Canonical(shortURL)
+}
+
+// Initialize prepares the memory store to be used. Calling it again doesn't remove the existing URLs
+func (m *Memory) Initialize() error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		m.urls = map[string]Link{}
+		m.clicks = map[string]int{}
+		m.counts = map[string]*clickCounts{}
+		m.history = map[string][]TargetChange{}
+		m.keys = map[string]APIKey{}
+		m.users = map[string]userRecord{}
+		m.audit = []AuditEntry{}
+	}
+
+	return nil
+}
+
+// Ping checks that the store has been initialized
+func (m *Memory) Ping() error {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	return nil
+}
+
+// ReadURL returns the target URL of a shortened URL. If the shortened URL has expired, it returns ErrExpired
+func (m *Memory) ReadURL(shortURL string) (string, error) {
+	longURL, _, err := m.ReadRedirect(shortURL)
+
+	return longURL, err
+}
+
+// ReadRedirect returns the target URL of a shortened URL and the status code of its redirect. If the shortened URL
+// has expired, it returns ErrExpired
+func (m *Memory) ReadRedirect(shortURL string) (string, int, error) {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return "", 0, errMemoryNotInitialized
+	}
+
+	l, ok := m.urls[shortURL]
+	if !ok {
+		return "", 0, ErrNotFound
+	}
+
+	l.Clicks = m.clicks[shortURL]
+	if err := l.Available(time.Now()); err != nil {
+		return "", 0, err
+	}
+
+	return l.LongURL, l.RedirectStatus, nil
+}
+
+// FollowLink returns a shortened URL that is going to redirect. The links without maximum number of clicks are read
+// with the read lock, so the redirects don't wait for each other, and the ones with a maximum count the click with the
+// write lock, checking again that they're available
+func (m *Memory) FollowLink(shortURL string) (*Link, error) {
+	l, err := m.ReadLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Available(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if l.MaxClicks == 0 {
+		return l, nil
+	}
+
+	shortURL = l.ShortURL
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	limited, ok := m.urls[shortURL]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	limited.Clicks = m.clicks[shortURL]
+	if err := limited.Available(time.Now()); err != nil {
+		return nil, err
+	}
+
+	m.clicks[shortURL]++
+	limited.Clicks++
+
+	return &limited, nil
+}
+
+// ReadLink returns a shortened URL, even if it has expired
+func (m *Memory) ReadLink(shortURL string) (*Link, error) {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	l, ok := m.urls[shortURL]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	l.Clicks = m.clicks[shortURL]
+
+	return &l, nil
+}
+
+// ListURLs returns all the shortened URLs, sorted by the short URL
+func (m *Memory) ListURLs() ([]Link, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	links := []Link{}
+	for shortURL, l := range m.urls {
+		l.Clicks = m.clicks[shortURL]
+		links = append(links, l)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ShortURL < links[j].ShortURL
+	})
+
+	return links, nil
+}
+
+// AddURL adds a new shortened URL that never expires
+func (m *Memory) AddURL(shortURL string, longURL string) error {
+	if shortURL == "" {
+		return ErrShortURLEmpty
+	}
+
+	return m.AddLink(&Link{
+		ShortURL: shortURL,
+		LongURL:  longURL,
+	})
+}
+
+// AddLink adds a new shortened URL. If the short URL is empty, a new one is generated and set in the link
+func (m *Memory) AddLink(l *Link) error {
+	if err := prepareLink(l, policyOrDefault(m.Policy)); err != nil {
+		return err
+	}
+
+	g := generatorOrDefault(m.Generator)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	var owner *User
+	if l.Owner != "" {
+		u, ok := m.users[l.Owner]
+		if !ok {
+			return ErrUserNotFound
+		}
+
+		owner = &u.User
+	}
+
+	if err := checkNamespace(owner, l.ShortURL); err != nil {
+		return err
+	}
+
+	if l.ShortURL == "" {
+		shortURL, err := generateUnused(g, policyOrDefault(m.Policy), ownerPrefix(owner), func(shortURL string) bool {
+			_, ok := m.urls[shortURL]
+			return ok
+		})
+		if err != nil {
+			return err
+		}
+
+		l.ShortURL = shortURL
+
+	} else if _, ok := m.urls[l.ShortURL]; ok {
+		return ErrAlreadyExists
+	}
+
+	m.urls[l.ShortURL] = *l
+
+	return nil
+}
+
+// ImportLinks imports a batch of shortened URLs at once
+func (m *Memory) ImportLinks(links []Link, opts ImportOptions) ([]ImportResult, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	im := &importer{
+		generator: m.Generator,
+		policy:    m.Policy,
+		exists: func(shortURL string) (bool, error) {
+			_, ok := m.urls[shortURL]
+			return ok, nil
+		},
+		write: func(l *Link, overwrite bool) error {
+			if overwrite {
+				m.replaceTarget(l.ShortURL, l.LongURL)
+			}
+
+			m.urls[l.ShortURL] = *l
+			return nil
+		},
+	}
+
+	return im.run(links, opts)
+}
+
+// WalkURLs calls the function provided with each shortened URL, sorted by the short URL, until it returns an error
+func (m *Memory) WalkURLs(fn func(l Link) error) error {
+	links, err := m.ListURLs()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range links {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateURL changes the target URL of an existing shortened URL. The previous target is added to its history
+func (m *Memory) UpdateURL(shortURL string, longURL string) error {
+	return m.UpdateLink(shortURL, LinkUpdate{LongURL: longURL})
+}
+
+// UpdateLink changes the target URL and the redirect status of an existing shortened URL at once
+func (m *Memory) UpdateLink(shortURL string, u LinkUpdate) error {
+	return m.UpdateLinkAudit(shortURL, u, nil)
+}
+
+// UpdateLinkAudit changes the target URL and the redirect status of an existing shortened URL and records the change
+// in the audit log at once
+func (m *Memory) UpdateLinkAudit(shortURL string, u LinkUpdate, audit AuditFunc) error {
+	shortURL = m.canonical(shortURL)
+
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	l, ok := m.urls[shortURL]
+	if !ok {
+		return ErrNotFound
+	}
+
+	old := m.link(shortURL)
+
+	if u.LongURL != "" {
+		m.replaceTarget(shortURL, u.LongURL)
+		l.LongURL = u.LongURL
+	}
+
+	if u.RedirectStatus != nil {
+		l.RedirectStatus = *u.RedirectStatus
+	}
+
+	m.urls[shortURL] = l
+	m.appendAudit(audit, old, m.link(shortURL))
+
+	return nil
+}
+
+// History returns the previous targets of a shortened URL, from the oldest to the newest
+func (m *Memory) History(shortURL string) ([]TargetChange, error) {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	if _, ok := m.urls[shortURL]; !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]TargetChange{}, m.history[shortURL]...), nil
+}
+
+// SetDisabled disables or enables an existing shortened URL. The disabled shortened URLs don't redirect
+func (m *Memory) SetDisabled(shortURL string, disabled bool) error {
+	return m.SetDisabledAudit(shortURL, disabled, nil)
+}
+
+// SetDisabledAudit disables or enables an existing shortened URL and records the change in the audit log at once
+func (m *Memory) SetDisabledAudit(shortURL string, disabled bool, audit AuditFunc) error {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	l, ok := m.urls[shortURL]
+	if !ok {
+		return ErrNotFound
+	}
+
+	old := m.link(shortURL)
+
+	l.Disabled = disabled
+	m.urls[shortURL] = l
+	m.appendAudit(audit, old, m.link(shortURL))
+
+	return nil
+}
+
+// SetRedirectStatus changes the status code of the redirects of an existing shortened URL
+func (m *Memory) SetRedirectStatus(shortURL string, status int) error {
+	return m.UpdateLink(shortURL, LinkUpdate{RedirectStatus: &status})
+}
+
+// DeleteURL removes a shortened URL
+func (m *Memory) DeleteURL(shortURL string) error {
+	return m.DeleteURLAudit(shortURL, nil)
+}
+
+// DeleteURLAudit removes a shortened URL and records its removal in the audit log at once
+func (m *Memory) DeleteURLAudit(shortURL string, audit AuditFunc) error {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	if _, ok := m.urls[shortURL]; !ok {
+		return ErrNotFound
+	}
+
+	old := m.link(shortURL)
+
+	m.delete(shortURL)
+	m.appendAudit(audit, old, nil)
+
+	return nil
+}
+
+// DeleteExpired removes all the shortened URLs that have expired at the time provided. It returns the number of
+// shortened URLs removed
+func (m *Memory) DeleteExpired(now time.Time) (int, error) {
+	return m.DeleteExpiredAudit(now, nil)
+}
+
+// DeleteExpiredAudit removes all the shortened URLs that have expired at the time provided and records the removal of
+// each one in the audit log at once. It returns the number of shortened URLs removed
+func (m *Memory) DeleteExpiredAudit(now time.Time, audit AuditFunc) (int, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return 0, errMemoryNotInitialized
+	}
+
+	deleted := 0
+	for shortURL, l := range m.urls {
+		if l.Expired(now, m.clicks[shortURL]) {
+			old := m.link(shortURL)
+
+			m.delete(shortURL)
+			m.appendAudit(audit, old, nil)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Stats returns the statistics of the memory store
+func (m *Memory) Stats() (*Stats, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	return &Stats{
+		Links: len(m.urls),
+	}, nil
+}
+
+// RecordHits counts the hits of shortened URLs by day, referrer and country and increments their click counters. The
+// hits of shortened URLs that don't exist are ignored
+func (m *Memory) RecordHits(hits []Hit) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	for _, h := range hits {
+		h.ShortURL = m.canonical(h.ShortURL)
+
+		if _, ok := m.urls[h.ShortURL]; !ok {
+			continue
+		}
+
+		if !h.Counted {
+			m.clicks[h.ShortURL]++
+		}
+
+		counts, ok := m.counts[h.ShortURL]
+		if !ok {
+			counts = newClickCounts()
+			m.counts[h.ShortURL] = counts
+		}
+
+		counts.add(h)
+	}
+
+	return nil
+}
+
+// Clicks returns the click statistics of a shortened URL
+func (m *Memory) Clicks(shortURL string) (*ClickStats, error) {
+	shortURL = m.canonical(shortURL)
+
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	if _, ok := m.urls[shortURL]; !ok {
+		return nil, ErrNotFound
+	}
+
+	return newClickStats(shortURL, m.clicks[shortURL], m.counts[shortURL]), nil
+}
+
+// AddKey creates a new API key with the name provided and returns it. Only the hash of the key is stored
+func (m *Memory) AddKey(name string) (string, error) {
+	key, hash, k, err := newKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return "", errMemoryNotInitialized
+	}
+
+	for _, existing := range m.keys {
+		if existing.Name == name {
+			return "", ErrKeyAlreadyExists
+		}
+	}
+
+	m.keys[hash] = *k
+
+	return key, nil
+}
+
+// CheckKey returns the API key if it's valid. If it isn't, it returns ErrKeyInvalid
+func (m *Memory) CheckKey(key string) (*APIKey, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	k, ok := m.keys[hashKey(key)]
+	if !ok {
+		return nil, ErrKeyInvalid
+	}
+
+	return &k, nil
+}
+
+// ListKeys returns all the API keys, sorted by name
+func (m *Memory) ListKeys() ([]APIKey, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	keys := []APIKey{}
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+
+	return keys, nil
+}
+
+// DeleteKey removes the API key with the name provided
+func (m *Memory) DeleteKey(name string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	for hash, k := range m.keys {
+		if k.Name == name {
+			delete(m.keys, hash)
+			return nil
+		}
+	}
+
+	return ErrKeyNotFound
+}
+
+// AddUser adds a new user with the password provided. Only the hash of the password is stored
+func (m *Memory) AddUser(u *User, password string) error {
+	hash, err := newUser(u, password)
+	if err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	if _, ok := m.users[u.Username]; ok {
+		return ErrUserAlreadyExists
+	}
+
+	m.users[u.Username] = userRecord{
+		User:         *u,
+		PasswordHash: hash,
+	}
+
+	return nil
+}
+
+// Authenticate returns the user if the password is valid. If it isn't, it returns ErrUserInvalid
+func (m *Memory) Authenticate(username, password string) (*User, error) {
+	m.mux.RLock()
+	u, ok := m.users[username]
+	initialized := m.urls != nil
+	m.mux.RUnlock()
+
+	if !initialized {
+		return nil, errMemoryNotInitialized
+	}
+
+	if !ok {
+		return nil, ErrUserInvalid
+	}
+
+	if err := checkPassword(u.PasswordHash, password); err != nil {
+		return nil, err
+	}
+
+	return &u.User, nil
+}
+
+// ReadUser returns an user
+func (m *Memory) ReadUser(username string) (*User, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	u, ok := m.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &u.User, nil
+}
+
+// ListUsers returns all the users, sorted by username
+func (m *Memory) ListUsers() ([]User, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	if m.urls == nil {
+		return nil, errMemoryNotInitialized
+	}
+
+	users := []User{}
+	for _, u := range m.users {
+		users = append(users, u.User)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users, nil
+}
+
+// DeleteUser removes an user. Its links aren't removed
+func (m *Memory) DeleteUser(username string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	if _, ok := m.users[username]; !ok {
+		return ErrUserNotFound
+	}
+
+	delete(m.users, username)
+
+	return nil
+}
+
+// delete removes a shortened URL with its clicks and hits. The lock needs to be held when calling it
+func (m *Memory) delete(shortURL string) {
+	delete(m.urls, shortURL)
+	delete(m.clicks, shortURL)
+	delete(m.counts, shortURL)
+	delete(m.history, shortURL)
+}
+
+// replaceTarget adds the current target of a shortened URL to its history if it's different from the new one. The
+// mutex needs to be locked
+func (m *Memory) replaceTarget(shortURL, longURL string) {
+	if old := m.urls[shortURL].LongURL; old != longURL {
+		m.history[shortURL] = append(m.history[shortURL], TargetChange{LongURL: old, ReplacedAt: time.Now().UTC()})
+	}
+}
+
+// link returns a copy of a shortened URL with its clicks. The mutex needs to be locked
+func (m *Memory) link(shortURL string) *Link {
+	l := m.urls[shortURL]
+	l.Clicks = m.clicks[shortURL]
+
+	return &l
+}
+
+// appendAudit adds the entry of a change of a shortened URL to the audit log. If the audit function is nil, the change
+// isn't recorded. The mutex needs to be locked
+func (m *Memory) appendAudit(audit AuditFunc, old, new *Link) {
+	if audit != nil {
+		m.audit = append(m.audit, audit(old, new))
+	}
+}
+
+// AppendAudit adds entries at the end of the audit log
+func (m *Memory) AppendAudit(entries ...AuditEntry) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.urls == nil {
+		return errMemoryNotInitialized
+	}
+
+	m.audit = append(m.audit, entries...)
+
+	return nil
+}
+
+// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest to
+// the newest, until it returns an error
+func (m *Memory) WalkAudit(f AuditFilter, fn func(e AuditEntry) error) error {
+	m.mux.RLock()
+	if m.urls == nil {
+		m.mux.RUnlock()
+		return errMemoryNotInitialized
+	}
+
+	// The entries are copied, so the function can use the store
+	entries := append([]AuditEntry{}, m.audit...)
+	m.mux.RUnlock()
+
+	n := 0
+	for _, e := range entries {
+		if !f.Match(e) {
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+
+		n++
+		if f.Limit > 0 && n == f.Limit {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// Should follow the links without maximum number of clicks with the read lock, so the concurrent redirects don't wait
+// for each other
+func TestMemoryFollowLinkUnlimited(t *testing.T) {
+	m := &Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	if err := m.AddURL("forever", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := m.AddLink(&Link{ShortURL: "limited", LongURL: "https://nefixestrada.com", MaxClicks: 5}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	// Another redirect is holding the read lock
+	m.mux.RLock()
+
+	unlimited := make(chan error)
+	go func() {
+		_, err := m.FollowLink("forever")
+		unlimited <- err
+	}()
+
+	select {
+	case err := <-unlimited:
+		if err != nil {
+			t.Errorf("unexpected error following the link: %v", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Errorf("expecting the redirect to finish, but it's waiting for the other redirect")
+	}
+
+	limited := make(chan error)
+	go func() {
+		_, err := m.FollowLink("limited")
+		limited <- err
+	}()
+
+	select {
+	case err := <-limited:
+		t.Errorf("expecting the redirect to wait for the write lock, but it has finished with %v", err)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	m.mux.RUnlock()
+
+	if err := <-limited; err != nil {
+		t.Errorf("unexpected error following the link: %v", err)
+	}
+}
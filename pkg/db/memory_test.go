@@ -0,0 +1,122 @@
+package db_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestMemory(t *testing.T) {
+	for _, tt := range tests {
+		m := &db.Memory{}
+		if err := m.Initialize(); err != nil {
+			t.Fatalf("unexpected error initializing the memory store: %v", err)
+		}
+
+		if err := m.AddURL(tt.shortURL, tt.longURL); err != nil {
+			t.Errorf("unexpected error adding the URL: %v", err)
+		}
+
+		if err := m.AddURL(tt.shortURL, tt.longURL); err != db.ErrAlreadyExists {
+			t.Errorf("expecting %v, but got %v", db.ErrAlreadyExists, err)
+		}
+
+		rsp, err := m.ReadURL(tt.shortURL)
+		if err != nil {
+			t.Errorf("unexpected error when reading the URL: %v", err)
+		}
+
+		if rsp != tt.longURL {
+			t.Errorf("expecting %s, but got %s", tt.longURL, rsp)
+		}
+
+		generated := &db.Link{LongURL: tt.longURL}
+		if err := m.AddLink(generated); err != nil {
+			t.Errorf("unexpected error adding the generated URL: %v", err)
+		}
+
+		if err = m.UpdateURL(generated.ShortURL, "https://nefixestrada.com"); err != nil {
+			t.Errorf("unexpected error updating the URL: %v", err)
+		}
+
+		expected := []db.Link{
+			{ShortURL: generated.ShortURL, LongURL: "https://nefixestrada.com"},
+			{ShortURL: tt.shortURL, LongURL: tt.longURL},
+		}
+		if expected[0].ShortURL > expected[1].ShortURL {
+			expected[0], expected[1] = expected[1], expected[0]
+		}
+
+		links, err := m.ListURLs()
+		if err != nil {
+			t.Errorf("unexpected error listing the URLs: %v", err)
+		}
+
+		for i := range links {
+			if links[i].CreatedAt.IsZero() {
+				t.Errorf("expecting the creation time of %s to be set", links[i].ShortURL)
+			}
+
+			links[i].CreatedAt = time.Time{}
+		}
+
+		if !reflect.DeepEqual(links, expected) {
+			t.Errorf("expecting %v, but got %v", expected, links)
+		}
+
+		stats, err := m.Stats()
+		if err != nil {
+			t.Errorf("unexpected error getting the stats: %v", err)
+		}
+
+		if stats.Links != 2 {
+			t.Errorf("expecting %d, but got %d", 2, stats.Links)
+		}
+
+		if err = m.DeleteURL(tt.shortURL); err != nil {
+			t.Errorf("unexpected error deleting the URL: %v", err)
+		}
+
+		if _, err = m.ReadURL(tt.shortURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err = m.DeleteURL(tt.shortURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+	}
+}
+
+// The long URL needs to be an URL
+func TestMemoryAddURLLongIsURL(t *testing.T) {
+	for _, tt := range tests {
+		m := &db.Memory{}
+		if err := m.Initialize(); err != nil {
+			t.Fatalf("unexpected error initializing the memory store: %v", err)
+		}
+
+		if err := m.AddURL(tt.shortURL, "https://notanurl!"); err != db.ErrLongURLInvalid {
+			t.Errorf("expecting %v, but got %v", db.ErrLongURLInvalid, err)
+		}
+	}
+}
+
+// Should return an error when it's not initialized
+func TestMemoryNotInitialized(t *testing.T) {
+	for _, tt := range tests {
+		m := &db.Memory{}
+
+		expectedErr := "the memory store isn't initialized"
+
+		if _, err := m.ReadURL(tt.shortURL); err == nil || err.Error() != expectedErr {
+			t.Errorf("expecting %s, but got %v", expectedErr, err)
+		}
+
+		if err := m.AddURL(tt.shortURL, tt.longURL); err == nil || err.Error() != expectedErr {
+			t.Errorf("expecting %s, but got %v", expectedErr, err)
+		}
+	}
+}
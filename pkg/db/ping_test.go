@@ -0,0 +1,59 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// testPing checks that the store isn't ready until it has been initialized. The store provided can't be initialized
+func testPing(t *testing.T, s db.Store) {
+	if err := s.Ping(); err == nil {
+		t.Errorf("expecting an error, but got %v", err)
+	}
+
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("error initializing the store: %v", err)
+	}
+
+	if err := s.Ping(); err != nil {
+		t.Errorf("unexpected error checking the store: %v", err)
+	}
+}
+
+// Should work as expected
+func TestPing(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	testPing(t, &db.DB{DB: boltDB})
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryPing(t *testing.T) {
+	testPing(t, &db.Memory{})
+}
+
+// Should work as expected
+func TestSQLPing(t *testing.T) {
+	s := newSQLite(t)
+
+	testPing(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
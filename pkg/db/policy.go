@@ -0,0 +1,311 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// DefaultSymbols are the characters allowed by default in the short URLs besides the letters and the digits
+	DefaultSymbols = "-_."
+	// DefaultMinLength is the minimum length of the short URLs by default
+	DefaultMinLength = 1
+	// DefaultMaxLength is the maximum length of the short URLs by default
+	DefaultMaxLength = 64
+)
+
+var (
+	// ErrShortURLShort is returned when the short URL is shorter than the minimum length of the policy
+	ErrShortURLShort = &ValidationError{"the short URL is too short"}
+
+	// ErrShortURLLong is returned when the short URL is longer than the maximum length of the policy
+	ErrShortURLLong = &ValidationError{"the short URL is too long"}
+
+	// ErrShortURLCharset is returned when the short URL has characters that aren't allowed by the policy
+	ErrShortURLCharset = &ValidationError{"the short URL has characters that aren't allowed"}
+
+	// ErrShortURLSegment is returned when the short URL has empty, '.' or '..' segments (e.g. team-a/ or team-a/..)
+	ErrShortURLSegment = &ValidationError{"the short URL can't have empty, '.' or '..' segments"}
+
+	// ErrShortURLConfusable is returned when the short URL has characters that can be confused with other ones
+	ErrShortURLConfusable = &ValidationError{"the short URL has characters that can be confused with other ones"}
+)
+
+// forbiddenSymbols are the characters that can never be allowed in the short URLs, since they have a meaning in the
+// paths: '/' separates the namespaces, '+' shows the statistics and the rest are part of the URLs syntax
+const forbiddenSymbols = "/+?#%&=\\\"<>`{}|^[]"
+
+// CodePolicy are the rules that the short URLs need to follow. The short URLs are normalized to NFC, and also to
+// lower case if they are case insensitive, both when they are created and when they are looked up. The '/' is always
+// allowed between the segments of the namespaces
+type CodePolicy struct {
+	// Symbols are the characters allowed besides the letters and the digits
+	Symbols string
+	// Unicode is whether the letters and the digits of all the scripts are allowed. Otherwise, only the ASCII ones are
+	Unicode bool
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MaxLength is the maximum number of characters
+	MaxLength int
+	// CaseInsensitive is whether the short URLs are matched without case. They are stored in lower case
+	CaseInsensitive bool
+	// AllowConfusables is whether the characters that can be confused with other ones are allowed. Otherwise, the
+	// short URLs can't mix scripts (e.g. Latin and Cyrillic), be written only with letters that look like the ASCII ones
+	// (e.g. the Cyrillic 'сор') or have characters with compatibility forms (e.g. the fullwidth 'ａ')
+	AllowConfusables bool
+}
+
+// DefaultCodePolicy returns a code policy with the default configuration
+func DefaultCodePolicy() *CodePolicy {
+	return &CodePolicy{
+		Symbols:   DefaultSymbols,
+		Unicode:   true,
+		MinLength: DefaultMinLength,
+		MaxLength: DefaultMaxLength,
+	}
+}
+
+// policyOrDefault returns the code policy provided or the default one if it's nil
+func policyOrDefault(p *CodePolicy) *CodePolicy {
+	if p == nil {
+		return DefaultCodePolicy()
+	}
+
+	return p
+}
+
+// Validate checks that the configuration of the code policy is valid
+func (p *CodePolicy) Validate() error {
+	if p.MinLength < 1 {
+		return errors.New("the minimum length of the short URLs needs to be at least one")
+	}
+
+	if p.MaxLength < p.MinLength {
+		return errors.New("the maximum length of the short URLs can't be less than the minimum length")
+	}
+
+	for _, r := range p.Symbols {
+		if strings.ContainsRune(forbiddenSymbols, r) || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("the character %q can't be allowed in the short URLs", r)
+		}
+	}
+
+	return nil
+}
+
+// ValidateGenerator checks that the short URLs generated by the generator follow the policy
+func (p *CodePolicy) ValidateGenerator(g *Generator) error {
+	if g.Length < p.MinLength || g.Length > p.MaxLength {
+		return fmt.Errorf("the generator length needs to be between %d and %d", p.MinLength, p.MaxLength)
+	}
+
+	for _, r := range g.Alphabet {
+		if !p.allowed(r) {
+			return fmt.Errorf("the character %q of the generator alphabet isn't allowed in the short URLs", r)
+		}
+
+		if p.CaseInsensitive && unicode.IsUpper(r) {
+			return errors.New("the generator alphabet can't have upper case letters when the short URLs are case insensitive")
+		}
+	}
+
+	return nil
+}
+
+// Canonical returns the short URL normalized to NFC, and to lower case if the short URLs are case insensitive
+func (p *CodePolicy) Canonical(shortURL string) string {
+	shortURL = norm.NFC.String(shortURL)
+
+	if p.CaseInsensitive {
+		shortURL = strings.ToLower(shortURL)
+	}
+
+	return shortURL
+}
+
+// canonicalRenames returns the canonical short URL of each stored short URL that isn't canonical, e.g. the ones with
+// upper case letters stored before the short URLs were case insensitive, since they can't be looked up anymore. It
+// fails if two stored short URLs have the same canonical short URL, since one of them needs to be removed first
+func (p *CodePolicy) canonicalRenames(shortURLs []string) (map[string]string, error) {
+	stored := map[string]bool{}
+	for _, shortURL := range shortURLs {
+		stored[shortURL] = true
+	}
+
+	sorted := append([]string{}, shortURLs...)
+	sort.Strings(sorted)
+
+	renames := map[string]string{}
+	renamedFrom := map[string]string{}
+	for _, shortURL := range sorted {
+		canonical := p.Canonical(shortURL)
+		if canonical == shortURL {
+			continue
+		}
+
+		other, ok := renamedFrom[canonical]
+		if stored[canonical] {
+			other, ok = canonical, true
+		}
+
+		if ok {
+			return nil, fmt.Errorf("the short URLs %q and %q are the same with the code policy, one of them needs to be deleted before using it", other, shortURL)
+		}
+
+		renames[shortURL] = canonical
+		renamedFrom[canonical] = shortURL
+	}
+
+	return renames, nil
+}
+
+// Check checks that a canonical short URL follows the policy
+func (p *CodePolicy) Check(shortURL string) error {
+	if shortURL == "" {
+		return ErrShortURLEmpty
+	}
+
+	length := utf8.RuneCountInString(shortURL)
+	if length < p.MinLength {
+		return ErrShortURLShort
+	}
+
+	if length > p.MaxLength {
+		return ErrShortURLLong
+	}
+
+	for _, segment := range strings.Split(shortURL, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrShortURLSegment
+		}
+
+		for i, r := range segment {
+			// The combining marks can't start a segment, since they would be combined with the '/'
+			if r == utf8.RuneError || !(p.allowed(r) || (i > 0 && p.Unicode && unicode.IsMark(r))) {
+				return ErrShortURLCharset
+			}
+		}
+	}
+
+	if !p.AllowConfusables && confusable(shortURL) {
+		return ErrShortURLConfusable
+	}
+
+	return nil
+}
+
+// allowed returns whether a character is allowed by the policy, without taking into account the marks
+func (p *CodePolicy) allowed(r rune) bool {
+	if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return true
+	}
+
+	if p.Unicode && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return true
+	}
+
+	return strings.ContainsRune(p.Symbols, r)
+}
+
+// latinConfusables are the Latin letters that look like ASCII letters (e.g. the dotless 'ı'). They are never allowed,
+// since they can be mixed with the ASCII letters
+var latinConfusables = map[rune]bool{
+	'ı': true, 'ȷ': true, 'ɑ': true, 'ɡ': true, 'ɩ': true, 'ʟ': true,
+}
+
+// confusables are the letters of other scripts that look like ASCII letters (e.g. the Cyrillic 'а'). They are only
+// confusable when all the letters of the short URL are like this (e.g. the Cyrillic 'сор' looks like 'cop'), since
+// the scripts can't be mixed
+var confusables = map[rune]bool{
+	// Cyrillic
+	'а': true, 'е': true, 'к': true, 'о': true, 'р': true, 'с': true, 'у': true, 'х': true, 'ѕ': true, 'і': true,
+	'ј': true, 'һ': true, 'ԁ': true, 'ԛ': true, 'ԝ': true, 'ӏ': true, 'ү': true,
+	'А': true, 'В': true, 'Е': true, 'К': true, 'М': true, 'Н': true, 'О': true, 'Р': true, 'С': true, 'Т': true,
+	'Х': true, 'Ѕ': true, 'І': true, 'Ј': true,
+	// Greek
+	'α': true, 'ι': true, 'ν': true, 'ο': true, 'ρ': true, 'υ': true,
+	'Α': true, 'Β': true, 'Ε': true, 'Ζ': true, 'Η': true, 'Ι': true, 'Κ': true, 'Μ': true, 'Ν': true, 'Ο': true,
+	'Ρ': true, 'Τ': true, 'Υ': true, 'Χ': true,
+	// Armenian
+	'հ': true, 'ո': true, 'ս': true, 'օ': true,
+}
+
+// scriptSets are the sets of scripts that can be mixed in a short URL, since they are used together (e.g. Japanese
+// mixes Han, Hiragana and Katakana). These are the sets allowed by the highly restrictive level of Unicode TS #39
+var scriptSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Hangul"},
+	{"Latin", "Han", "Bopomofo"},
+}
+
+// confusable returns whether a short URL has characters that can be confused with other ones: characters with
+// compatibility forms, Latin letters that look like ASCII ones, scripts that aren't used together or only letters of
+// other scripts that look like ASCII ones
+func confusable(shortURL string) bool {
+	scripts := map[string]bool{}
+	letters := 0
+	lookalikes := 0
+
+	for _, r := range shortURL {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+
+		if r < utf8.RuneSelf {
+			if unicode.IsLetter(r) {
+				scripts["Latin"] = true
+			}
+
+			continue
+		}
+
+		if latinConfusables[r] || norm.NFKC.String(string(r)) != string(r) {
+			return true
+		}
+
+		if confusables[r] {
+			lookalikes++
+		}
+
+		if s := script(r); s != "" {
+			scripts[s] = true
+		}
+	}
+
+	if len(scripts) <= 1 {
+		return letters > 0 && lookalikes == letters
+	}
+
+	for _, set := range scriptSets {
+		mixed := 0
+		for _, s := range set {
+			if scripts[s] {
+				mixed++
+			}
+		}
+
+		if mixed == len(scripts) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// script returns the script of a character. The characters used by many scripts (e.g. the digits) or that inherit
+// the script of the previous character (e.g. the combining marks) don't have script
+func script(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,365 @@
+package db_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestCodePolicyCheck(t *testing.T) {
+	asciiOnly := db.DefaultCodePolicy()
+	asciiOnly.Unicode = false
+
+	confusables := db.DefaultCodePolicy()
+	confusables.AllowConfusables = true
+
+	short := db.DefaultCodePolicy()
+	short.MinLength = 2
+	short.MaxLength = 4
+
+	tests := []struct {
+		policy      *db.CodePolicy
+		shortURL    string
+		expectedErr error
+	}{
+		{db.DefaultCodePolicy(), "go", nil},
+		{db.DefaultCodePolicy(), "team-a/go_1.2", nil},
+		{db.DefaultCodePolicy(), "café", nil},
+		{db.DefaultCodePolicy(), "東京タワー", nil},
+		{db.DefaultCodePolicy(), "tokyo東京", nil},
+		{db.DefaultCodePolicy(), "Москва", nil},
+		{db.DefaultCodePolicy(), "", db.ErrShortURLEmpty},
+		{db.DefaultCodePolicy(), "go go", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "go?q=1", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "go#top", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "go%20", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "go+", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "́go", db.ErrShortURLCharset},
+		{db.DefaultCodePolicy(), "team-a/", db.ErrShortURLSegment},
+		{db.DefaultCodePolicy(), "/go", db.ErrShortURLSegment},
+		{db.DefaultCodePolicy(), "team-a//go", db.ErrShortURLSegment},
+		{db.DefaultCodePolicy(), "team-a/../go", db.ErrShortURLSegment},
+		{db.DefaultCodePolicy(), "./go", db.ErrShortURLSegment},
+		{db.DefaultCodePolicy(), "раураl", db.ErrShortURLConfusable},
+		{db.DefaultCodePolicy(), "сор", db.ErrShortURLConfusable},
+		{db.DefaultCodePolicy(), "ｇｏ", db.ErrShortURLConfusable},
+		{db.DefaultCodePolicy(), "lınk", db.ErrShortURLConfusable},
+		{db.DefaultCodePolicy(), "goМосква", db.ErrShortURLConfusable},
+		{confusables, "сор", nil},
+		{asciiOnly, "café", db.ErrShortURLCharset},
+		{asciiOnly, "go-1", nil},
+		{short, "g", db.ErrShortURLShort},
+		{short, "gogo", nil},
+		{short, "gogog", db.ErrShortURLLong},
+		{short, "東京", nil},
+	}
+
+	for _, tt := range tests {
+		if err := tt.policy.Check(tt.policy.Canonical(tt.shortURL)); err != tt.expectedErr {
+			t.Errorf("expecting %v for %q, but got %v", tt.expectedErr, tt.shortURL, err)
+		}
+	}
+}
+
+// Should work as expected
+func TestCodePolicyCanonical(t *testing.T) {
+	insensitive := db.DefaultCodePolicy()
+	insensitive.CaseInsensitive = true
+
+	tests := []struct {
+		policy   *db.CodePolicy
+		shortURL string
+		expected string
+	}{
+		{db.DefaultCodePolicy(), "Go", "Go"},
+		{db.DefaultCodePolicy(), "café", "café"},
+		{insensitive, "Team-A/Go", "team-a/go"},
+		{insensitive, "CAFÉ", "café"},
+	}
+
+	for _, tt := range tests {
+		if canonical := tt.policy.Canonical(tt.shortURL); canonical != tt.expected {
+			t.Errorf("expecting %q, but got %q", tt.expected, canonical)
+		}
+	}
+}
+
+// Should return an error when the configuration isn't valid
+func TestCodePolicyValidateErr(t *testing.T) {
+	tests := []struct {
+		policy      *db.CodePolicy
+		expectedErr string
+	}{
+		{&db.CodePolicy{MinLength: 0, MaxLength: 10}, "the minimum length of the short URLs needs to be at least one"},
+		{&db.CodePolicy{MinLength: 5, MaxLength: 4}, "the maximum length of the short URLs can't be less than the minimum length"},
+		{&db.CodePolicy{Symbols: "-/", MinLength: 1, MaxLength: 10}, "the character '/' can't be allowed in the short URLs"},
+		{&db.CodePolicy{Symbols: " ", MinLength: 1, MaxLength: 10}, "the character ' ' can't be allowed in the short URLs"},
+	}
+
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); err == nil || err.Error() != tt.expectedErr {
+			t.Errorf("expecting %s, but got %v", tt.expectedErr, err)
+		}
+	}
+
+	if err := db.DefaultCodePolicy().Validate(); err != nil {
+		t.Errorf("unexpected error validating the default policy: %v", err)
+	}
+
+	if err := db.DefaultCodePolicy().ValidateGenerator(db.DefaultGenerator()); err != nil {
+		t.Errorf("unexpected error validating the default generator: %v", err)
+	}
+
+	asciiOnly := db.DefaultCodePolicy()
+	asciiOnly.Unicode = false
+
+	expectedErr := "the character 'ñ' of the generator alphabet isn't allowed in the short URLs"
+	if err := asciiOnly.ValidateGenerator(&db.Generator{Alphabet: "abcñ", Length: 6}); err == nil || err.Error() != expectedErr {
+		t.Errorf("expecting %s, but got %v", expectedErr, err)
+	}
+}
+
+// testPolicy checks that the short URLs are made canonical when they are created and when they are looked up. The
+// store provided needs to have case insensitive short URLs
+func testPolicy(t *testing.T, s db.Store) {
+	if err := s.AddURL("Blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := s.AddURL("café", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := s.AddURL("BLOG", "https://golang.org"); err != db.ErrAlreadyExists {
+		t.Errorf("expecting %v, but got %v", db.ErrAlreadyExists, err)
+	}
+
+	for _, shortURL := range []string{"blog", "BLOG", "bLoG"} {
+		if _, err := s.ReadURL(shortURL); err != nil {
+			t.Errorf("unexpected error reading %s: %v", shortURL, err)
+		}
+	}
+
+	l, err := s.ReadLink("Café")
+	if err != nil {
+		t.Fatalf("unexpected error reading the URL: %v", err)
+	}
+
+	if l.ShortURL != "café" {
+		t.Errorf("expecting %q, but got %q", "café", l.ShortURL)
+	}
+
+	if err := s.UpdateURL("BLOG", "https://blog.nefixestrada.com"); err != nil {
+		t.Errorf("unexpected error updating the URL: %v", err)
+	}
+
+	if err := s.RecordHits([]db.Hit{{ShortURL: "BLOG"}}); err != nil {
+		t.Fatalf("unexpected error recording the hits: %v", err)
+	}
+
+	stats, err := s.Clicks("Blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the clicks: %v", err)
+	}
+
+	if stats.Total != 1 {
+		t.Errorf("expecting %d, but got %d", 1, stats.Total)
+	}
+
+	if err := s.AddURL("go go", "https://golang.org"); err != db.ErrShortURLCharset {
+		t.Errorf("expecting %v, but got %v", db.ErrShortURLCharset, err)
+	}
+
+	if err := s.DeleteURL("BLOG"); err != nil {
+		t.Errorf("unexpected error deleting the URL: %v", err)
+	}
+
+	if _, err := s.ReadURL("blog"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+}
+
+// insensitivePolicy returns the default policy with case insensitive short URLs
+func insensitivePolicy() *db.CodePolicy {
+	p := db.DefaultCodePolicy()
+	p.CaseInsensitive = true
+
+	return p
+}
+
+// Should work as expected
+func TestPolicy(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB:     boltDB,
+		Policy: insensitivePolicy(),
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testPolicy(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryPolicy(t *testing.T) {
+	m := &db.Memory{Policy: insensitivePolicy()}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testPolicy(t, m)
+}
+
+// Should work as expected
+func TestSQLPolicy(t *testing.T) {
+	s := newSQLite(t)
+	s.Policy = insensitivePolicy()
+
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testPolicy(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// testMigrateCanonical checks that the short URLs stored before they were case insensitive are renamed when the store
+// is initialized, unless some of them are the same without case. The store provided needs to have case sensitive
+// short URLs, and setPolicy changes its code policy
+func testMigrateCanonical(t *testing.T, s db.Store, setPolicy func(p *db.CodePolicy)) {
+	for _, l := range []struct{ shortURL, longURL string }{
+		{"GitHub", "https://github.com"},
+		{"Go", "https://golang.org"},
+		{"go", "https://go.dev"},
+	} {
+		if err := s.AddURL(l.shortURL, l.longURL); err != nil {
+			t.Fatalf("error inserting test data to the DB: %v", err)
+		}
+	}
+
+	if err := s.UpdateURL("GitHub", "https://github.com/nefix"); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	if err := s.RecordHits([]db.Hit{{ShortURL: "GitHub", Time: time.Date(2018, 10, 1, 10, 0, 0, 0, time.UTC), Referrer: "https://golang.org"}}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	setPolicy(insensitivePolicy())
+
+	expectedErr := `the short URLs "go" and "Go" are the same with the code policy, one of them needs to be deleted before using it`
+	if err := s.Initialize(); err == nil || err.Error() != expectedErr {
+		t.Errorf("expecting %s, but got %v", expectedErr, err)
+	}
+
+	// None of the short URLs has been renamed
+	setPolicy(db.DefaultCodePolicy())
+
+	if longURL, err := s.ReadURL("GitHub"); err != nil || longURL != "https://github.com/nefix" {
+		t.Errorf("expecting %s, but got %s and %v", "https://github.com/nefix", longURL, err)
+	}
+
+	if err := s.DeleteURL("Go"); err != nil {
+		t.Fatalf("unexpected error deleting the URL: %v", err)
+	}
+
+	setPolicy(insensitivePolicy())
+
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the store: %v", err)
+	}
+
+	for shortURL, expected := range map[string]string{"github": "https://github.com/nefix", "GITHUB": "https://github.com/nefix", "Go": "https://go.dev"} {
+		if longURL, err := s.ReadURL(shortURL); err != nil || longURL != expected {
+			t.Errorf("expecting %s, but got %s and %v", expected, longURL, err)
+		}
+	}
+
+	stats, err := s.Clicks("github")
+	if err != nil {
+		t.Fatalf("unexpected error reading the clicks: %v", err)
+	}
+
+	expectedStats := &db.ClickStats{
+		ShortURL:     "github",
+		Total:        1,
+		PerDay:       []db.DayClicks{{Day: "2018-10-01", Clicks: 1}},
+		TopReferrers: []db.ReferrerClicks{{Referrer: "https://golang.org", Clicks: 1}},
+		TopCountries: []db.CountryClicks{},
+	}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("expecting %v, but got %v", expectedStats, stats)
+	}
+
+	history, err := s.History("github")
+	if err != nil {
+		t.Fatalf("unexpected error reading the history: %v", err)
+	}
+
+	if len(history) != 1 || history[0].LongURL != "https://github.com" {
+		t.Errorf("expecting the previous target %s, but got %v", "https://github.com", history)
+	}
+}
+
+// Should rename the short URLs that aren't canonical when initializing the DB
+func TestMigrateCanonical(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testMigrateCanonical(t, d, func(p *db.CodePolicy) { d.Policy = p })
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should rename the short URLs that aren't canonical when initializing the DB
+func TestSQLMigrateCanonical(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testMigrateCanonical(t, s, func(p *db.CodePolicy) { s.Policy = p })
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// recordVersion is the current version of the encoding of the records. It needs to be increased when the record
+// changes in a way that older versions can't read, and decodeRecord needs to be able to read all the versions
+const recordVersion = 1
+
+// record is the value stored in the urls bucket for each shortened URL
+type record struct {
+	Version   int        `json:"v"`
+	LongURL   string     `json:"longURL"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	MaxClicks int        `json:"maxClicks,omitempty"`
+	Clicks    int        `json:"clicks,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	Disabled  bool       `json:"disabled,omitempty"`
+	// RedirectStatus is the status code of the redirects. If it's 0, the default one is used
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+	// History are the previous targets of the shortened URL, from the oldest to the newest
+	History []TargetChange `json:"history,omitempty"`
+}
+
+// newRecord returns the record of a new shortened URL
+func newRecord(l *Link) *record {
+	return &record{
+		Version:   recordVersion,
+		LongURL:   l.LongURL,
+		CreatedAt: l.CreatedAt,
+		ExpiresAt: l.ExpiresAt,
+		MaxClicks: l.MaxClicks,
+		Owner:     l.Owner,
+		Disabled:  l.Disabled,
+
+		RedirectStatus: l.RedirectStatus,
+	}
+}
+
+// link returns the shortened URL of the record
+func (r *record) link(shortURL string) *Link {
+	return &Link{
+		ShortURL:  shortURL,
+		LongURL:   r.LongURL,
+		ExpiresAt: r.ExpiresAt,
+		MaxClicks: r.MaxClicks,
+		Owner:     r.Owner,
+		Disabled:  r.Disabled,
+		CreatedAt: r.CreatedAt,
+		Clicks:    r.Clicks,
+
+		RedirectStatus: r.RedirectStatus,
+	}
+}
+
+// replaceTarget changes the target of the record, adding the previous one to its history if it's different
+func (r *record) replaceTarget(longURL string, now time.Time) {
+	if r.LongURL == longURL {
+		return
+	}
+
+	r.History = append(r.History, TargetChange{LongURL: r.LongURL, ReplacedAt: now.UTC()})
+	r.LongURL = longURL
+}
+
+// expired returns whether the shortened URL of the record has expired at the time provided
+func (r *record) expired(now time.Time) bool {
+	return r.link("").Expired(now, r.Clicks)
+}
+
+// encodeRecord encodes a record to be stored in the urls bucket
+func encodeRecord(r *record) ([]byte, error) {
+	r.Version = recordVersion
+
+	return json.Marshal(r)
+}
+
+// decodeRecord decodes a value of the urls bucket. Before the records were introduced, the value was the raw long
+// URL, which can't start with '{' since it has to be a valid URL. Those values are decoded as records without
+// creation time, so they can be read before being migrated
+func decodeRecord(b []byte) (*record, error) {
+	if !isRecord(b) {
+		return &record{
+			LongURL: string(b),
+		}, nil
+	}
+
+	r := &record{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("error decoding the record: %v", err)
+	}
+
+	if r.Version > recordVersion {
+		return nil, fmt.Errorf("unknown record version %d", r.Version)
+	}
+
+	return r, nil
+}
+
+// isRecord returns whether a value of the urls bucket is an encoded record and not a raw long URL
+func isRecord(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("{"))
+}
+
+// readRecord reads the record of a shortened URL inside a transaction
+func readRecord(tx *bolt.Tx, shortURL string) (*record, error) {
+	b := tx.Bucket([]byte("urls"))
+	if b == nil {
+		return nil, errors.New("the bucket urls doesn't exist")
+	}
+
+	content := b.Get([]byte(shortURL))
+	if content == nil {
+		return nil, ErrNotFound
+	}
+
+	return decodeRecord(content)
+}
+
+// writeRecord writes the record of a shortened URL inside a transaction
+func writeRecord(tx *bolt.Tx, shortURL string, r *record) error {
+	b := tx.Bucket([]byte("urls"))
+	if b == nil {
+		return errors.New("the bucket urls doesn't exist")
+	}
+
+	val, err := encodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(shortURL), val)
+}
+
+// migrateRecords converts the raw long URLs of the urls bucket to records. The expirations and the click counters,
+// that were stored in their own buckets, are moved to the records and their buckets are removed
+func migrateRecords(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte("urls"))
+	if b == nil {
+		return errors.New("the bucket urls doesn't exist")
+	}
+
+	expirations := tx.Bucket([]byte("expirations"))
+	clicks := tx.Bucket([]byte("clicks"))
+
+	records := map[string]*record{}
+	if err := b.ForEach(func(k, v []byte) error {
+		if isRecord(v) && expirations == nil && clicks == nil {
+			return nil
+		}
+
+		r, err := decodeRecord(v)
+		if err != nil {
+			return fmt.Errorf("error migrating %s: %v", k, err)
+		}
+
+		if expirations != nil {
+			if content := expirations.Get(k); content != nil {
+				if err := json.Unmarshal(content, r); err != nil {
+					return fmt.Errorf("error migrating the expiration of %s: %v", k, err)
+				}
+			}
+		}
+
+		if clicks != nil {
+			if content := clicks.Get(k); content != nil {
+				r.Clicks = int(binary.BigEndian.Uint64(content))
+			}
+		}
+
+		records[string(k)] = r
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The keys can't be changed while iterating the bucket
+	for shortURL, r := range records {
+		if err := writeRecord(tx, shortURL, r); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{"expirations", "clicks"} {
+		if tx.Bucket([]byte(name)) != nil {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package db_test
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should migrate the shortened URLs stored by older versions without losing data
+func TestInitializeMigrate(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	if err = boltDB.Update(func(tx *bolt.Tx) error {
+		urls, err := tx.CreateBucket([]byte("urls"))
+		if err != nil {
+			return err
+		}
+
+		if err := urls.Put([]byte("git"), []byte("https://gitea.nefixestrada.com")); err != nil {
+			return err
+		}
+
+		if err := urls.Put([]byte("blog"), []byte("https://nefixestrada.com")); err != nil {
+			return err
+		}
+
+		expirations, err := tx.CreateBucket([]byte("expirations"))
+		if err != nil {
+			return err
+		}
+
+		if err := expirations.Put([]byte("blog"), []byte(`{"expiresAt":"`+expiresAt.Format(time.RFC3339)+`","maxClicks":10}`)); err != nil {
+			return err
+		}
+
+		clicks, err := tx.CreateBucket([]byte("clicks"))
+		if err != nil {
+			return err
+		}
+
+		total := make([]byte, 8)
+		binary.BigEndian.PutUint64(total, 3)
+
+		return clicks.Put([]byte("git"), total)
+	}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	// The migration can be applied multiple times
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB again: %v", err)
+	}
+
+	if err = boltDB.View(func(tx *bolt.Tx) error {
+		for _, b := range []string{"expirations", "clicks"} {
+			if tx.Bucket([]byte(b)) != nil {
+				t.Errorf("expecting the bucket %s to be removed", b)
+			}
+		}
+
+		return tx.Bucket([]byte("urls")).ForEach(func(k, v []byte) error {
+			if !strings.HasPrefix(string(v), "{") {
+				t.Errorf("expecting %s to be migrated, but got %s", k, v)
+			}
+
+			return nil
+		})
+	}); err != nil {
+		t.Fatalf("error reading the DB: %v", err)
+	}
+
+	rsp, err := d.ReadURL("git")
+	if err != nil {
+		t.Errorf("unexpected error when reading the URL in the DB: %v", err)
+	}
+
+	if rsp != "https://gitea.nefixestrada.com" {
+		t.Errorf("expecting %s, but got %s", "https://gitea.nefixestrada.com", rsp)
+	}
+
+	stats, err := d.Clicks("git")
+	if err != nil {
+		t.Errorf("unexpected error getting the clicks: %v", err)
+	}
+
+	if stats.Total != 3 {
+		t.Errorf("expecting %d, but got %d", 3, stats.Total)
+	}
+
+	l, err := d.ReadLink("blog")
+	if err != nil {
+		t.Errorf("unexpected error reading the link: %v", err)
+	}
+
+	if l.LongURL != "https://nefixestrada.com" || l.ExpiresAt == nil || !l.ExpiresAt.Equal(expiresAt) || l.MaxClicks != 10 {
+		t.Errorf("unexpected link migrated: %v", l)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should return an error when the record was stored by a newer version
+func TestReadURLRecordVersion(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	if err = boltDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("urls"))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte("git"), []byte(`{"v":1000,"longURL":"https://gitea.nefixestrada.com"}`))
+	}); err != nil {
+		t.Fatalf("error inserting test data to the DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	expectedErr := "unknown record version 1000"
+
+	if _, err = d.ReadURL("git"); err == nil || err.Error() != expectedErr {
+		t.Errorf("expecting %s, but got %v", expectedErr, err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package db_test
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestValidateRedirectStatus(t *testing.T) {
+	tests := []struct {
+		status      int
+		expectedErr error
+	}{
+		{0, nil},
+		{http.StatusMovedPermanently, nil},
+		{http.StatusFound, nil},
+		{http.StatusTemporaryRedirect, nil},
+		{http.StatusPermanentRedirect, nil},
+		{http.StatusSeeOther, db.ErrRedirectStatusInvalid},
+		{http.StatusOK, db.ErrRedirectStatusInvalid},
+		{-1, db.ErrRedirectStatusInvalid},
+	}
+
+	for _, tt := range tests {
+		if err := db.ValidateRedirectStatus(tt.status); err != tt.expectedErr {
+			t.Errorf("expecting %v for %d, but got %v", tt.expectedErr, tt.status, err)
+		}
+	}
+}
+
+// testRedirectStatus checks that the redirect status is stored with the links, that it can be changed and that the
+// links without redirect status use the default one
+func testRedirectStatus(t *testing.T, s db.Store) {
+	if err := s.AddLink(&db.Link{ShortURL: "blog", LongURL: "https://nefixestrada.com", RedirectStatus: http.StatusMovedPermanently}); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := s.AddURL("go", "https://golang.org"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := s.AddLink(&db.Link{ShortURL: "invalid", LongURL: "https://nefixestrada.com", RedirectStatus: http.StatusSeeOther}); err != db.ErrRedirectStatusInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrRedirectStatusInvalid, err)
+	}
+
+	longURL, status, err := s.ReadRedirect("blog")
+	if err != nil {
+		t.Fatalf("unexpected error reading the redirect: %v", err)
+	}
+
+	if longURL != "https://nefixestrada.com" || status != http.StatusMovedPermanently {
+		t.Errorf("expecting %s %d, but got %s %d", "https://nefixestrada.com", http.StatusMovedPermanently, longURL, status)
+	}
+
+	if _, status, err := s.ReadRedirect("go"); err != nil || status != 0 {
+		t.Errorf("expecting %d, but got %d and %v", 0, status, err)
+	}
+
+	if err := s.SetRedirectStatus("go", http.StatusPermanentRedirect); err != nil {
+		t.Fatalf("unexpected error setting the redirect status: %v", err)
+	}
+
+	l, err := s.ReadLink("go")
+	if err != nil {
+		t.Fatalf("unexpected error reading the link: %v", err)
+	}
+
+	if l.RedirectStatus != http.StatusPermanentRedirect {
+		t.Errorf("expecting %d, but got %d", http.StatusPermanentRedirect, l.RedirectStatus)
+	}
+
+	if err := s.SetRedirectStatus("blog", 0); err != nil {
+		t.Fatalf("unexpected error setting the redirect status: %v", err)
+	}
+
+	if _, status, err := s.ReadRedirect("blog"); err != nil || status != 0 {
+		t.Errorf("expecting %d, but got %d and %v", 0, status, err)
+	}
+
+	if err := s.SetRedirectStatus("go", http.StatusOK); err != db.ErrRedirectStatusInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrRedirectStatusInvalid, err)
+	}
+
+	if err := s.SetRedirectStatus("notfound", http.StatusFound); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	if _, _, err := s.ReadRedirect("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	temporary := http.StatusTemporaryRedirect
+	if err := s.UpdateLink("go", db.LinkUpdate{LongURL: "https://go.dev", RedirectStatus: &temporary}); err != nil {
+		t.Fatalf("unexpected error updating the link: %v", err)
+	}
+
+	if longURL, status, err := s.ReadRedirect("go"); err != nil || longURL != "https://go.dev" || status != http.StatusTemporaryRedirect {
+		t.Errorf("expecting %s %d, but got %s %d and %v", "https://go.dev", http.StatusTemporaryRedirect, longURL, status, err)
+	}
+
+	// None of the changes is made if one of them isn't valid
+	invalid := http.StatusSeeOther
+	if err := s.UpdateLink("go", db.LinkUpdate{LongURL: "https://golang.org", RedirectStatus: &invalid}); err != db.ErrRedirectStatusInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrRedirectStatusInvalid, err)
+	}
+
+	if longURL, status, err := s.ReadRedirect("go"); err != nil || longURL != "https://go.dev" || status != http.StatusTemporaryRedirect {
+		t.Errorf("expecting %s %d, but got %s %d and %v", "https://go.dev", http.StatusTemporaryRedirect, longURL, status, err)
+	}
+
+	if err := s.UpdateLink("go", db.LinkUpdate{}); err != db.ErrLongURLEmpty {
+		t.Errorf("expecting %v, but got %v", db.ErrLongURLEmpty, err)
+	}
+
+	if err := s.UpdateLink("notfound", db.LinkUpdate{LongURL: "https://golang.org", RedirectStatus: &temporary}); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	if err := s.SetDisabled("go", true); err != nil {
+		t.Fatalf("unexpected error disabling the URL: %v", err)
+	}
+
+	if _, _, err := s.ReadRedirect("go"); err != db.ErrDisabled {
+		t.Errorf("expecting %v, but got %v", db.ErrDisabled, err)
+	}
+
+	results, err := s.ImportLinks([]db.Link{
+		{ShortURL: "docs", LongURL: "https://golang.org/doc", RedirectStatus: http.StatusTemporaryRedirect},
+		{ShortURL: "wrong", LongURL: "https://golang.org", RedirectStatus: http.StatusNotModified},
+	}, db.ImportOptions{Conflict: db.ConflictFail})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	if len(results) != 2 || results[0].Status != db.ImportCreated || results[1].Status != db.ImportInvalid {
+		t.Errorf("expecting %v and %v, but got %v", db.ImportCreated, db.ImportInvalid, results)
+	}
+
+	if _, status, err := s.ReadRedirect("docs"); err != nil || status != http.StatusTemporaryRedirect {
+		t.Errorf("expecting %d, but got %d and %v", http.StatusTemporaryRedirect, status, err)
+	}
+}
+
+// Should work as expected
+func TestRedirectStatus(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testRedirectStatus(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryRedirectStatus(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testRedirectStatus(t, m)
+}
+
+// Should work as expected
+func TestSQLRedirectStatus(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testRedirectStatus(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
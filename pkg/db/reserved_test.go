@@ -0,0 +1,114 @@
+package db_test
+
+import (
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Should work as expected
+func TestIsReserved(t *testing.T) {
+	tests := []struct {
+		shortURL string
+		expected bool
+	}{
+		{"api", true},
+		{"api/go", true},
+		{"API", true},
+		{"healthz", true},
+		{"favicon.ico", true},
+		{"apis", false},
+		{"go/api", false},
+		{"blog", false},
+	}
+
+	for _, tt := range tests {
+		if reserved := db.IsReserved(tt.shortURL); reserved != tt.expected {
+			t.Errorf("expecting %v for %s, but got %v", tt.expected, tt.shortURL, reserved)
+		}
+	}
+}
+
+// testReserved checks that the reserved short URLs can't be added nor imported
+func testReserved(t *testing.T, s db.Store) {
+	for _, shortURL := range []string{"api", "Admin", "healthz/go"} {
+		if err := s.AddURL(shortURL, "https://nefixestrada.com"); err != db.ErrShortURLReserved {
+			t.Errorf("expecting %v, but got %v", db.ErrShortURLReserved, err)
+		}
+	}
+
+	if err := s.AddLink(&db.Link{ShortURL: "metrics", LongURL: "https://nefixestrada.com"}); err != db.ErrShortURLReserved {
+		t.Errorf("expecting %v, but got %v", db.ErrShortURLReserved, err)
+	}
+
+	results, err := s.ImportLinks([]db.Link{{ShortURL: "static/logo.png", LongURL: "https://nefixestrada.com"}}, db.ImportOptions{Conflict: db.ConflictSkip})
+	if err != nil {
+		t.Fatalf("unexpected error importing the links: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Status != db.ImportInvalid || results[0].Error != db.ErrShortURLReserved.Error() {
+		t.Errorf("expecting %v, but got %v", db.ImportInvalid, results)
+	}
+
+	links, err := s.ListURLs()
+	if err != nil {
+		t.Fatalf("unexpected error listing the URLs: %v", err)
+	}
+
+	if len(links) != 0 {
+		t.Errorf("expecting %d, but got %d", 0, len(links))
+	}
+}
+
+// Should work as expected
+func TestReserved(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testReserved(t, d)
+
+	if err := boltDB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryReserved(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testReserved(t, m)
+}
+
+// Should work as expected
+func TestSQLReserved(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testReserved(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
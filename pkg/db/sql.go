@@ -0,0 +1,1262 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DialectSQLite is the dialect used with the SQLite driver (modernc.org/sqlite)
+	DialectSQLite = "sqlite"
+
+	// DialectPostgres is the dialect used with the PostgreSQL driver (github.com/lib/pq)
+	DialectPostgres = "postgres"
+)
+
+// sqlMigrations are the migrations of the SQL schema. They are applied in order, and each migration is only applied
+// once. New migrations need to be appended at the end and the existing ones can't be changed
+var sqlMigrations = []string{
+	`CREATE TABLE urls (
+		short_url TEXT PRIMARY KEY,
+		long_url TEXT NOT NULL
+	)`,
+	`ALTER TABLE urls ADD COLUMN clicks INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE hits (
+		short_url TEXT NOT NULL,
+		time TIMESTAMP NOT NULL,
+		referrer TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		country TEXT NOT NULL
+	)`,
+	`CREATE INDEX hits_short_url ON hits (short_url, time)`,
+	`ALTER TABLE urls ADD COLUMN expires_at TIMESTAMP`,
+	`ALTER TABLE urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE api_keys (
+		hash TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE urls ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE users (
+		username TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		namespace TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE urls ADD COLUMN created_at TIMESTAMP`,
+	`ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE url_history (
+		short_url TEXT NOT NULL,
+		long_url TEXT NOT NULL,
+		replaced_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX url_history_short_url ON url_history (short_url, replaced_at)`,
+	`CREATE TABLE audit_log (
+		time TIMESTAMP NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		short_url TEXT NOT NULL,
+		old_link TEXT,
+		new_link TEXT
+	)`,
+	`CREATE INDEX audit_log_time ON audit_log (time)`,
+	`ALTER TABLE urls ADD COLUMN redirect_status INTEGER NOT NULL DEFAULT 0`,
+}
+
+// sqlMigrationsLock is the key of the PostgreSQL advisory lock held while applying the migrations
+const sqlMigrationsLock int64 = 0x75726c73686f7274
+
+// SQL needs to implement the Store, KeyStore, UserStore and AuditLog interfaces
+var _ Store = &SQL{}
+var _ KeyStore = &SQL{}
+var _ UserStore = &SQL{}
+var _ AuditLog = &SQL{}
+var _ AuditStore = &SQL{}
+
+// SQL is a Store that uses a SQL database. It supports SQLite and PostgreSQL, and allows running multiple instances
+// of the URL shortener against the same database
+type SQL struct {
+	DB *sql.DB
+
+	// Dialect is the SQL dialect of the database. It has to be DialectSQLite or DialectPostgres
+	Dialect string
+
+	// Generator is used to generate the short URLs when they aren't provided. If it's nil, the default one is used
+	Generator *Generator
+
+	// Policy are the rules that the short URLs need to follow. If it's nil, the default one is used
+	Policy *CodePolicy
+}
+
+// canonical returns the short URL as it's stored, following the code policy
+func (s *SQL) canonical(shortURL string) string {
+	return policyOrDefault(s.Policy).Canonical(shortURL)
+}
+
+// Initialize applies all the pending migrations of the schema and renames the shortened URLs that aren't canonical
+// with the code policy
+func (s *SQL) Initialize() error {
+	if s.Dialect != DialectSQLite && s.Dialect != DialectPostgres {
+		return fmt.Errorf("unknown SQL dialect %s", s.Dialect)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The instances started at the same time wait for the first one to apply the migrations instead of applying them
+	// concurrently. The lock is released when the transaction ends. SQLite doesn't have advisory locks
+	if s.Dialect == DialectPostgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, sqlMigrationsLock); err != nil {
+			return fmt.Errorf("error locking the migrations: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("error creating the migrations table: %v", err)
+	}
+
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("error reading the schema version: %v", err)
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		if _, err := tx.Exec(sqlMigrations[i]); err != nil {
+			return fmt.Errorf("error applying the migration %d: %v", i+1, err)
+		}
+
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			return fmt.Errorf("error applying the migration %d: %v", i+1, err)
+		}
+	}
+
+	if err := s.migrateCanonical(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateCanonical renames the shortened URLs that aren't canonical with the code policy, with their hits and
+// history, inside a transaction. If two of them have the same canonical short URL, none of them is renamed
+func (s *SQL) migrateCanonical(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT short_url FROM urls`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	shortURLs := []string{}
+	for rows.Next() {
+		var shortURL string
+		if err := rows.Scan(&shortURL); err != nil {
+			return err
+		}
+
+		shortURLs = append(shortURLs, shortURL)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	renames, err := policyOrDefault(s.Policy).canonicalRenames(shortURLs)
+	if err != nil {
+		return err
+	}
+
+	for shortURL, canonical := range renames {
+		for _, table := range []string{"urls", "hits", "url_history"} {
+			if _, err := tx.Exec(s.rebind(`UPDATE `+table+` SET short_url = ? WHERE short_url = ?`), canonical, shortURL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Ping checks that the connection with the database is alive and that the table urls can be read
+func (s *SQL) Ping() error {
+	if err := s.DB.Ping(); err != nil {
+		return err
+	}
+
+	rows, err := s.DB.Query(`SELECT short_url FROM urls LIMIT 1`)
+	if err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// ReadURL returns the target URL of a shortened URL. If the shortened URL has expired, it returns ErrExpired
+func (s *SQL) ReadURL(shortURL string) (string, error) {
+	longURL, _, err := s.ReadRedirect(shortURL)
+
+	return longURL, err
+}
+
+// ReadRedirect returns the target URL of a shortened URL and the status code of its redirect. If the shortened URL
+// has expired, it returns ErrExpired
+func (s *SQL) ReadRedirect(shortURL string) (string, int, error) {
+	shortURL = s.canonical(shortURL)
+
+	l, err := s.readLink(shortURL)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := l.Available(time.Now()); err != nil {
+		return "", 0, err
+	}
+
+	return l.LongURL, l.RedirectStatus, nil
+}
+
+// FollowLink returns a shortened URL that is going to redirect. The links without maximum number of clicks are only
+// read, and the ones with a maximum count the click in a single statement, only if the limit hasn't been reached, so
+// the concurrent redirects (even from other instances) can't exceed it
+func (s *SQL) FollowLink(shortURL string) (*Link, error) {
+	l, err := s.ReadLink(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Available(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if l.MaxClicks == 0 {
+		return l, nil
+	}
+
+	rsp, err := s.DB.Exec(s.rebind(`UPDATE urls SET clicks = clicks + 1 WHERE short_url = ? AND clicks < max_clicks`), l.ShortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// Another redirect has reached the limit since the link was read
+	if n == 0 {
+		return nil, ErrExpired
+	}
+
+	l.Clicks++
+
+	return l, nil
+}
+
+// ReadLink returns a shortened URL, even if it has expired or it's disabled
+func (s *SQL) ReadLink(shortURL string) (*Link, error) {
+	shortURL = s.canonical(shortURL)
+
+	return s.readLink(shortURL)
+}
+
+// ListURLs returns all the shortened URLs, sorted by the short URL
+func (s *SQL) ListURLs() ([]Link, error) {
+	links := []Link{}
+
+	if err := s.WalkURLs(func(l Link) error {
+		links = append(links, l)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// WalkURLs calls the function provided with each shortened URL, sorted by the short URL, until it returns an error.
+// The shortened URLs are read while they are walked, so they aren't loaded in memory at once
+func (s *SQL) WalkURLs(fn func(l Link) error) error {
+	rows, err := s.DB.Query(`SELECT ` + sqlLinkColumns + ` FROM urls ORDER BY short_url`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(*l); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// AddURL adds a new shortened URL that never expires
+func (s *SQL) AddURL(shortURL string, longURL string) error {
+	if shortURL == "" {
+		return ErrShortURLEmpty
+	}
+
+	return s.AddLink(&Link{
+		ShortURL: shortURL,
+		LongURL:  longURL,
+	})
+}
+
+// AddLink adds a new shortened URL. If the short URL is empty, a new one is generated and set in the link
+func (s *SQL) AddLink(l *Link) error {
+	if err := prepareLink(l, policyOrDefault(s.Policy)); err != nil {
+		return err
+	}
+
+	var owner *User
+	if l.Owner != "" {
+		var err error
+		if owner, err = s.ReadUser(l.Owner); err != nil {
+			return err
+		}
+	}
+
+	if err := checkNamespace(owner, l.ShortURL); err != nil {
+		return err
+	}
+
+	if l.ShortURL != "" {
+		added, err := s.insertLink(s.DB, l.ShortURL, l)
+		if err != nil {
+			return err
+		}
+
+		if !added {
+			return ErrAlreadyExists
+		}
+
+		return nil
+	}
+
+	g := generatorOrDefault(s.Generator)
+
+	for i := 0; i <= g.Retries; i++ {
+		code, err := g.Generate()
+		if err != nil {
+			return err
+		}
+
+		shortURL := s.canonical(ownerPrefix(owner) + code)
+		if IsReserved(shortURL) {
+			continue
+		}
+
+		added, err := s.insertLink(s.DB, shortURL, l)
+		if err != nil {
+			return err
+		}
+
+		if added {
+			l.ShortURL = shortURL
+			return nil
+		}
+	}
+
+	return ErrGeneratorExhausted
+}
+
+// ImportLinks imports a batch of shortened URLs in a single transaction
+func (s *SQL) ImportLinks(links []Link, opts ImportOptions) ([]ImportResult, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	im := &importer{
+		generator: s.Generator,
+		policy:    s.Policy,
+		exists: func(shortURL string) (bool, error) {
+			var n int
+			if err := tx.QueryRow(s.rebind(`SELECT COUNT(*) FROM urls WHERE short_url = ?`), shortURL).Scan(&n); err != nil {
+				return false, err
+			}
+
+			return n > 0, nil
+		},
+		write: func(l *Link, overwrite bool) error {
+			if overwrite {
+				return s.overwriteLink(tx, l)
+			}
+
+			added, err := s.insertLink(tx, l.ShortURL, l)
+			if err != nil {
+				return err
+			}
+
+			if !added {
+				return ErrAlreadyExists
+			}
+
+			return nil
+		},
+	}
+
+	results, err := im.run(links, opts)
+	if err != nil {
+		return results, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// UpdateURL changes the target URL of an existing shortened URL. The previous target is added to its history
+func (s *SQL) UpdateURL(shortURL string, longURL string) error {
+	return s.UpdateLink(shortURL, LinkUpdate{LongURL: longURL})
+}
+
+// UpdateLink changes the target URL and the redirect status of an existing shortened URL in a single transaction
+func (s *SQL) UpdateLink(shortURL string, u LinkUpdate) error {
+	return s.UpdateLinkAudit(shortURL, u, nil)
+}
+
+// UpdateLinkAudit changes the target URL and the redirect status of an existing shortened URL and records the change
+// in the audit log, in a single transaction
+func (s *SQL) UpdateLinkAudit(shortURL string, u LinkUpdate, audit AuditFunc) error {
+	shortURL = s.canonical(shortURL)
+
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := s.lockLink(tx, shortURL)
+	if err != nil {
+		return err
+	}
+
+	columns := []string{}
+	args := []interface{}{}
+
+	if u.LongURL != "" {
+		if err := s.saveHistory(tx, shortURL, u.LongURL); err != nil {
+			return err
+		}
+
+		columns = append(columns, "long_url = ?")
+		args = append(args, u.LongURL)
+	}
+
+	if u.RedirectStatus != nil {
+		columns = append(columns, "redirect_status = ?")
+		args = append(args, *u.RedirectStatus)
+	}
+
+	if _, err := tx.Exec(s.rebind(`UPDATE urls SET `+strings.Join(columns, ", ")+` WHERE short_url = ?`), append(args, shortURL)...); err != nil {
+		return err
+	}
+
+	if err := s.appendAuditChange(tx, audit, old); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// History returns the previous targets of a shortened URL, from the oldest to the newest
+func (s *SQL) History(shortURL string) ([]TargetChange, error) {
+	shortURL = s.canonical(shortURL)
+
+	var n int
+	if err := s.DB.QueryRow(s.rebind(`SELECT COUNT(*) FROM urls WHERE short_url = ?`), shortURL).Scan(&n); err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	rows, err := s.DB.Query(s.rebind(`SELECT long_url, replaced_at FROM url_history WHERE short_url = ? ORDER BY replaced_at`), shortURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []TargetChange{}
+	for rows.Next() {
+		var c TargetChange
+		if err := rows.Scan(&c.LongURL, &c.ReplacedAt); err != nil {
+			return nil, err
+		}
+
+		c.ReplacedAt = c.ReplacedAt.UTC()
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+// SetDisabled disables or enables an existing shortened URL. The disabled shortened URLs don't redirect
+func (s *SQL) SetDisabled(shortURL string, disabled bool) error {
+	return s.SetDisabledAudit(shortURL, disabled, nil)
+}
+
+// SetDisabledAudit disables or enables an existing shortened URL and records the change in the audit log, in a single
+// transaction
+func (s *SQL) SetDisabledAudit(shortURL string, disabled bool, audit AuditFunc) error {
+	shortURL = s.canonical(shortURL)
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := s.lockLink(tx, shortURL)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(s.rebind(`UPDATE urls SET disabled = ? WHERE short_url = ?`), disabled, shortURL); err != nil {
+		return err
+	}
+
+	if err := s.appendAuditChange(tx, audit, old); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRedirectStatus changes the status code of the redirects of an existing shortened URL
+func (s *SQL) SetRedirectStatus(shortURL string, status int) error {
+	return s.UpdateLink(shortURL, LinkUpdate{RedirectStatus: &status})
+}
+
+// DeleteURL removes a shortened URL, its hits and its history
+func (s *SQL) DeleteURL(shortURL string) error {
+	return s.DeleteURLAudit(shortURL, nil)
+}
+
+// DeleteURLAudit removes a shortened URL, its hits and its history and records its removal in the audit log, in a
+// single transaction
+func (s *SQL) DeleteURLAudit(shortURL string, audit AuditFunc) error {
+	shortURL = s.canonical(shortURL)
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := s.lockLink(tx, shortURL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deleteLink(tx, shortURL); err != nil {
+		return err
+	}
+
+	if audit != nil {
+		if err := s.insertAudit(tx, audit(old, nil)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired removes all the shortened URLs that have expired at the time provided, with their hits and their
+// history. It returns the number of shortened URLs removed
+func (s *SQL) DeleteExpired(now time.Time) (int, error) {
+	return s.DeleteExpiredAudit(now, nil)
+}
+
+// DeleteExpiredAudit removes all the shortened URLs that have expired at the time provided, with their hits and their
+// history, and records the removal of each one in the audit log, in a single transaction. It returns the number of
+// shortened URLs removed
+func (s *SQL) DeleteExpiredAudit(now time.Time, audit AuditFunc) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		s.rebind(`SELECT `+sqlLinkColumns+` FROM urls WHERE (expires_at IS NOT NULL AND expires_at <= ?) OR (max_clicks > 0 AND clicks >= max_clicks)`+s.forUpdate()),
+		now.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := []*Link{}
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		expired = append(expired, l)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Only the shortened URLs read are removed, so all of them are recorded
+	for _, l := range expired {
+		if err := s.deleteLink(tx, l.ShortURL); err != nil {
+			return 0, err
+		}
+
+		if audit != nil {
+			if err := s.insertAudit(tx, audit(l, nil)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// Stats returns the statistics of the SQL database
+func (s *SQL) Stats() (*Stats, error) {
+	stats := &Stats{}
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM urls`).Scan(&stats.Links); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// RecordHits stores the hits of shortened URLs and increments their click counters. All the hits are stored in a
+// single transaction. The hits of shortened URLs that don't exist are ignored
+func (s *SQL) RecordHits(hits []Hit) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, h := range hits {
+		h.ShortURL = s.canonical(h.ShortURL)
+
+		// The clicks already counted when following the link are only checked to exist
+		var n int64
+		if h.Counted {
+			if err := tx.QueryRow(s.rebind(`SELECT COUNT(*) FROM urls WHERE short_url = ?`), h.ShortURL).Scan(&n); err != nil {
+				return err
+			}
+		} else {
+			rsp, err := tx.Exec(s.rebind(`UPDATE urls SET clicks = clicks + 1 WHERE short_url = ?`), h.ShortURL)
+			if err != nil {
+				return err
+			}
+
+			if n, err = rsp.RowsAffected(); err != nil {
+				return err
+			}
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		if _, err := tx.Exec(
+			s.rebind(`INSERT INTO hits (short_url, time, referrer, user_agent, country) VALUES (?, ?, ?, ?, ?)`),
+			h.ShortURL, h.Time.UTC(), h.Referrer, h.UserAgent, h.Country,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Clicks returns the click statistics of a shortened URL
+func (s *SQL) Clicks(shortURL string) (*ClickStats, error) {
+	shortURL = s.canonical(shortURL)
+
+	var total int
+	if err := s.DB.QueryRow(s.rebind(`SELECT clicks FROM urls WHERE short_url = ?`), shortURL).Scan(&total); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	// The hits are aggregated by the DB, and only the top referrers and countries are read. The time of the hits is
+	// stored in UTC, so its first 10 characters are the day
+	counts := newClickCounts()
+	for _, q := range []struct {
+		query  string
+		args   []interface{}
+		counts map[string]int
+	}{{
+		`SELECT substr(CAST(time AS TEXT), 1, 10), COUNT(*) FROM hits WHERE short_url = ? GROUP BY 1`,
+		[]interface{}{shortURL},
+		counts.days,
+	}, {
+		`SELECT referrer, COUNT(*) FROM hits WHERE short_url = ? AND referrer <> '' GROUP BY referrer ORDER BY 2 DESC, 1 LIMIT ?`,
+		[]interface{}{shortURL, maxTopReferrers},
+		counts.referrers,
+	}, {
+		`SELECT country, COUNT(*) FROM hits WHERE short_url = ? AND country <> '' GROUP BY country ORDER BY 2 DESC, 1 LIMIT ?`,
+		[]interface{}{shortURL, maxTopCountries},
+		counts.countries,
+	}} {
+		if err := s.countHits(q.query, q.args, q.counts); err != nil {
+			return nil, err
+		}
+	}
+
+	return newClickStats(shortURL, total, counts), nil
+}
+
+// countHits runs a query that counts hits grouped by a column and adds the counts to the map
+func (s *SQL) countHits(query string, args []interface{}, counts map[string]int) error {
+	rows, err := s.DB.Query(s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key string
+			n   int
+		)
+		if err := rows.Scan(&key, &n); err != nil {
+			return err
+		}
+
+		counts[key] = n
+	}
+
+	return rows.Err()
+}
+
+// AddKey creates a new API key with the name provided and returns it. Only the hash of the key is stored
+func (s *SQL) AddKey(name string) (string, error) {
+	key, hash, k, err := newKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	rsp, err := s.DB.Exec(
+		s.rebind(`INSERT INTO api_keys (hash, name, prefix, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`),
+		hash, k.Name, k.Prefix, k.CreatedAt,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return "", ErrKeyAlreadyExists
+	}
+
+	return key, nil
+}
+
+// CheckKey returns the API key if it's valid. If it isn't, it returns ErrKeyInvalid
+func (s *SQL) CheckKey(key string) (*APIKey, error) {
+	k := &APIKey{}
+	if err := s.DB.QueryRow(
+		s.rebind(`SELECT name, prefix, created_at FROM api_keys WHERE hash = ?`), hashKey(key),
+	).Scan(&k.Name, &k.Prefix, &k.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrKeyInvalid
+		}
+
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ListKeys returns all the API keys, sorted by name
+func (s *SQL) ListKeys() ([]APIKey, error) {
+	rows, err := s.DB.Query(`SELECT name, prefix, created_at FROM api_keys ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.Name, &k.Prefix, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteKey removes the API key with the name provided
+func (s *SQL) DeleteKey(name string) error {
+	rsp, err := s.DB.Exec(s.rebind(`DELETE FROM api_keys WHERE name = ?`), name)
+	if err != nil {
+		return err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
+
+// AddUser adds a new user with the password provided. Only the hash of the password is stored
+func (s *SQL) AddUser(u *User, password string) error {
+	hash, err := newUser(u, password)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := s.DB.Exec(
+		s.rebind(`INSERT INTO users (username, password_hash, namespace, admin, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (username) DO NOTHING`),
+		u.Username, string(hash), u.Namespace, u.Admin, u.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrUserAlreadyExists
+	}
+
+	return nil
+}
+
+// Authenticate returns the user if the password is valid. If it isn't, it returns ErrUserInvalid
+func (s *SQL) Authenticate(username, password string) (*User, error) {
+	u, err := s.readUser(username)
+	if err != nil {
+		if err == ErrUserNotFound {
+			return nil, ErrUserInvalid
+		}
+
+		return nil, err
+	}
+
+	if err := checkPassword(u.PasswordHash, password); err != nil {
+		return nil, err
+	}
+
+	return &u.User, nil
+}
+
+// ReadUser returns an user
+func (s *SQL) ReadUser(username string) (*User, error) {
+	u, err := s.readUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u.User, nil
+}
+
+// ListUsers returns all the users, sorted by username
+func (s *SQL) ListUsers() ([]User, error) {
+	rows, err := s.DB.Query(`SELECT username, namespace, admin, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Username, &u.Namespace, &u.Admin, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// DeleteUser removes an user. Its links aren't removed
+func (s *SQL) DeleteUser(username string) error {
+	rsp, err := s.DB.Exec(s.rebind(`DELETE FROM users WHERE username = ?`), username)
+	if err != nil {
+		return err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// AppendAudit adds entries at the end of the audit log. The links of the entries are stored as JSON
+func (s *SQL) AppendAudit(entries ...AuditEntry) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertAudit(tx, entries...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertAudit adds entries at the end of the audit log
+func (s *SQL) insertAudit(e execer, entries ...AuditEntry) error {
+	for _, entry := range entries {
+		oldLink, err := auditLink(entry.Old)
+		if err != nil {
+			return err
+		}
+
+		newLink, err := auditLink(entry.New)
+		if err != nil {
+			return err
+		}
+
+		if _, err := e.Exec(
+			s.rebind(`INSERT INTO audit_log (time, actor, action, short_url, old_link, new_link) VALUES (?, ?, ?, ?, ?, ?)`),
+			entry.Time.UTC(), entry.Actor, string(entry.Action), entry.ShortURL, oldLink, newLink,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendAuditChange adds the entry of a change of an existing shortened URL to the audit log inside the transaction,
+// reading the shortened URL after the change. If the audit function is nil, the change isn't recorded
+func (s *SQL) appendAuditChange(tx *sql.Tx, audit AuditFunc, old *Link) error {
+	if audit == nil {
+		return nil
+	}
+
+	l, err := scanLink(tx.QueryRow(s.rebind(`SELECT `+sqlLinkColumns+` FROM urls WHERE short_url = ?`), old.ShortURL))
+	if err != nil {
+		return err
+	}
+
+	return s.insertAudit(tx, audit(old, l))
+}
+
+// WalkAudit calls the function provided with each entry of the audit log selected by the filter, from the oldest to
+// the newest, until it returns an error. The entries are read while they are walked
+func (s *SQL) WalkAudit(f AuditFilter, fn func(e AuditEntry) error) error {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, string(f.Action))
+	}
+
+	if f.ShortURL != "" {
+		where = append(where, "short_url = ?")
+		args = append(args, f.ShortURL)
+	}
+
+	if !f.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, f.Since.UTC())
+	}
+
+	if !f.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	query := `SELECT time, actor, action, short_url, old_link, new_link FROM audit_log WHERE ` + strings.Join(where, " AND ") + ` ORDER BY time`
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+
+	rows, err := s.DB.Query(s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var action string
+		var oldLink, newLink sql.NullString
+		if err := rows.Scan(&e.Time, &e.Actor, &action, &e.ShortURL, &oldLink, &newLink); err != nil {
+			return err
+		}
+
+		e.Time = e.Time.UTC()
+		e.Action = AuditAction(action)
+
+		if oldLink.Valid {
+			e.Old = &Link{}
+			if err := json.Unmarshal([]byte(oldLink.String), e.Old); err != nil {
+				return err
+			}
+		}
+
+		if newLink.Valid {
+			e.New = &Link{}
+			if err := json.Unmarshal([]byte(newLink.String), e.New); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// auditLink encodes a link of an entry of the audit log as JSON. It returns nil if there's no link
+func auditLink(l *Link) (interface{}, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// readUser returns an user with the hash of its password
+func (s *SQL) readUser(username string) (*userRecord, error) {
+	u := &userRecord{}
+	var hash string
+	if err := s.DB.QueryRow(
+		s.rebind(`SELECT username, password_hash, namespace, admin, created_at FROM users WHERE username = ?`), username,
+	).Scan(&u.Username, &hash, &u.Namespace, &u.Admin, &u.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	u.PasswordHash = []byte(hash)
+
+	return u, nil
+}
+
+// sqlLinkColumns are the columns of the urls table read by scanLink
+const sqlLinkColumns = `short_url, long_url, expires_at, max_clicks, owner, disabled, created_at, clicks, redirect_status`
+
+// scanLink reads a shortened URL from a row with the sqlLinkColumns
+func scanLink(row interface{ Scan(...interface{}) error }) (*Link, error) {
+	l := &Link{}
+	var expiresAt, createdAt sql.NullTime
+	if err := row.Scan(&l.ShortURL, &l.LongURL, &expiresAt, &l.MaxClicks, &l.Owner, &l.Disabled, &createdAt, &l.Clicks, &l.RedirectStatus); err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		l.ExpiresAt = &expiresAt.Time
+	}
+
+	if createdAt.Valid {
+		l.CreatedAt = createdAt.Time
+	}
+
+	return l, nil
+}
+
+// readLink returns a shortened URL
+func (s *SQL) readLink(shortURL string) (*Link, error) {
+	l, err := scanLink(s.DB.QueryRow(s.rebind(`SELECT `+sqlLinkColumns+` FROM urls WHERE short_url = ?`), shortURL))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// lockLink reads a shortened URL inside a transaction that is going to change it. With PostgreSQL, its row is locked
+// until the end of the transaction, so the concurrent changes wait for each other
+func (s *SQL) lockLink(tx *sql.Tx, shortURL string) (*Link, error) {
+	l, err := scanLink(tx.QueryRow(s.rebind(`SELECT `+sqlLinkColumns+` FROM urls WHERE short_url = ?`+s.forUpdate()), shortURL))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// forUpdate returns the clause that locks the rows selected until the end of the transaction. SQLite doesn't need
+// it, because its write transactions are serialized
+func (s *SQL) forUpdate() string {
+	if s.Dialect != DialectPostgres {
+		return ""
+	}
+
+	return " FOR UPDATE"
+}
+
+// deleteLink removes a shortened URL with its hits and its history
+func (s *SQL) deleteLink(e execer, shortURL string) error {
+	for _, query := range []string{
+		`DELETE FROM hits WHERE short_url = ?`,
+		`DELETE FROM url_history WHERE short_url = ?`,
+		`DELETE FROM urls WHERE short_url = ?`,
+	} {
+		if _, err := e.Exec(s.rebind(query), shortURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execer executes queries, and it's implemented by both the DB and its transactions
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveHistory adds the current target of a shortened URL to its history if it's different from the new one
+func (s *SQL) saveHistory(e execer, shortURL, longURL string) error {
+	_, err := e.Exec(
+		s.rebind(`INSERT INTO url_history (short_url, long_url, replaced_at) SELECT short_url, long_url, ? FROM urls WHERE short_url = ? AND long_url <> ?`),
+		time.Now().UTC(), shortURL, longURL,
+	)
+
+	return err
+}
+
+// overwriteLink replaces an existing shortened URL, keeping its clicks and its history. The previous target is added
+// to its history
+func (s *SQL) overwriteLink(e execer, l *Link) error {
+	var expiresAt interface{}
+	if l.ExpiresAt != nil {
+		expiresAt = l.ExpiresAt.UTC()
+	}
+
+	if err := s.saveHistory(e, l.ShortURL, l.LongURL); err != nil {
+		return err
+	}
+
+	_, err := e.Exec(
+		s.rebind(`UPDATE urls SET long_url = ?, expires_at = ?, max_clicks = ?, owner = ?, disabled = ?, created_at = ?, redirect_status = ? WHERE short_url = ?`),
+		l.LongURL, expiresAt, l.MaxClicks, l.Owner, l.Disabled, l.CreatedAt.UTC(), l.RedirectStatus, l.ShortURL,
+	)
+
+	return err
+}
+
+// insertLink inserts a new shortened URL with the short URL provided. It returns false if the short URL is already
+// in use. The conflict is resolved by the database, so it's safe to be called by multiple instances at the same time
+func (s *SQL) insertLink(e execer, shortURL string, l *Link) (bool, error) {
+	var expiresAt interface{}
+	if l.ExpiresAt != nil {
+		expiresAt = l.ExpiresAt.UTC()
+	}
+
+	rsp, err := e.Exec(
+		s.rebind(`INSERT INTO urls (short_url, long_url, expires_at, max_clicks, owner, disabled, created_at, redirect_status) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (short_url) DO NOTHING`),
+		shortURL, l.LongURL, expiresAt, l.MaxClicks, l.Owner, l.Disabled, l.CreatedAt.UTC(), l.RedirectStatus,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := rsp.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// rebind changes the '?' placeholders of the query to the ones used by the dialect of the database
+func (s *SQL) rebind(query string) string {
+	if s.Dialect != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+
+			continue
+		}
+
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package db
+
+import "testing"
+
+// Should change the placeholders only when using PostgreSQL
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect  string
+		query    string
+		expected string
+	}{
+		{
+			dialect:  DialectSQLite,
+			query:    "UPDATE urls SET long_url = ? WHERE short_url = ?",
+			expected: "UPDATE urls SET long_url = ? WHERE short_url = ?",
+		},
+		{
+			dialect:  DialectPostgres,
+			query:    "UPDATE urls SET long_url = ? WHERE short_url = ?",
+			expected: "UPDATE urls SET long_url = $1 WHERE short_url = $2",
+		},
+	}
+
+	for _, tt := range tests {
+		s := &SQL{
+			Dialect: tt.dialect,
+		}
+
+		if rsp := s.rebind(tt.query); rsp != tt.expected {
+			t.Errorf("expecting %s, but got %s", tt.expected, rsp)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package db_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+
+	_ "modernc.org/sqlite"
+)
+
+// newSQLite returns a SQL store that uses an in-memory SQLite database
+func newSQLite(t *testing.T) *db.SQL {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	// Each connection to :memory: has its own database
+	sqlDB.SetMaxOpenConns(1)
+
+	return &db.SQL{
+		DB:      sqlDB,
+		Dialect: db.DialectSQLite,
+	}
+}
+
+// Should work as expected
+func TestSQL(t *testing.T) {
+	for _, tt := range tests {
+		s := newSQLite(t)
+
+		if err := s.Initialize(); err != nil {
+			t.Fatalf("unexpected error initializing the DB: %v", err)
+		}
+
+		// The migrations can be applied multiple times
+		if err := s.Initialize(); err != nil {
+			t.Fatalf("unexpected error initializing the DB again: %v", err)
+		}
+
+		if err := s.AddURL(tt.shortURL, tt.longURL); err != nil {
+			t.Errorf("unexpected error adding the URL: %v", err)
+		}
+
+		if err := s.AddURL(tt.shortURL, tt.longURL); err != db.ErrAlreadyExists {
+			t.Errorf("expecting %v, but got %v", db.ErrAlreadyExists, err)
+		}
+
+		rsp, err := s.ReadURL(tt.shortURL)
+		if err != nil {
+			t.Errorf("unexpected error when reading the URL: %v", err)
+		}
+
+		if rsp != tt.longURL {
+			t.Errorf("expecting %s, but got %s", tt.longURL, rsp)
+		}
+
+		generated := &db.Link{LongURL: tt.longURL}
+		if err := s.AddLink(generated); err != nil {
+			t.Errorf("unexpected error adding the generated URL: %v", err)
+		}
+
+		if err = s.UpdateURL(generated.ShortURL, "https://nefixestrada.com"); err != nil {
+			t.Errorf("unexpected error updating the URL: %v", err)
+		}
+
+		expected := []db.Link{
+			{ShortURL: generated.ShortURL, LongURL: "https://nefixestrada.com"},
+			{ShortURL: tt.shortURL, LongURL: tt.longURL},
+		}
+		if expected[0].ShortURL > expected[1].ShortURL {
+			expected[0], expected[1] = expected[1], expected[0]
+		}
+
+		links, err := s.ListURLs()
+		if err != nil {
+			t.Errorf("unexpected error listing the URLs: %v", err)
+		}
+
+		for i := range links {
+			if links[i].CreatedAt.IsZero() {
+				t.Errorf("expecting the creation time of %s to be set", links[i].ShortURL)
+			}
+
+			links[i].CreatedAt = time.Time{}
+		}
+
+		if !reflect.DeepEqual(links, expected) {
+			t.Errorf("expecting %v, but got %v", expected, links)
+		}
+
+		stats, err := s.Stats()
+		if err != nil {
+			t.Errorf("unexpected error getting the stats: %v", err)
+		}
+
+		if stats.Links != 2 {
+			t.Errorf("expecting %d, but got %d", 2, stats.Links)
+		}
+
+		if err = s.DeleteURL(tt.shortURL); err != nil {
+			t.Errorf("unexpected error deleting the URL: %v", err)
+		}
+
+		if _, err = s.ReadURL(tt.shortURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err = s.UpdateURL(tt.shortURL, tt.longURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err = s.DeleteURL(tt.shortURL); err != db.ErrNotFound {
+			t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+		}
+
+		if err := s.DB.Close(); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// The short URL can't be empty
+func TestSQLAddURLShortNoEmpty(t *testing.T) {
+	for _, tt := range tests {
+		s := newSQLite(t)
+
+		if err := s.Initialize(); err != nil {
+			t.Fatalf("unexpected error initializing the DB: %v", err)
+		}
+
+		if err := s.AddURL("", tt.longURL); err != db.ErrShortURLEmpty {
+			t.Errorf("expecting %v, but got %v", db.ErrShortURLEmpty, err)
+		}
+
+		if err := s.DB.Close(); err != nil {
+			t.Fatalf("error finishing the test: %v", err)
+		}
+	}
+}
+
+// Should return an error when the dialect is unknown
+func TestSQLInitializeUnknownDialect(t *testing.T) {
+	s := newSQLite(t)
+	s.Dialect = "oracle"
+
+	expectedErr := "unknown SQL dialect oracle"
+
+	if err := s.Initialize(); err == nil || err.Error() != expectedErr {
+		t.Errorf("expecting %s, but got %v", expectedErr, err)
+	}
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+)
+
+var (
+	// ErrNotFound is returned when the shortened URL doesn't exist in the DB
+	ErrNotFound = errors.New("the shortened URL wasn't found in the DB")
+
+	// ErrAlreadyExists is returned when adding a shortened URL that is already in the DB
+	ErrAlreadyExists = errors.New("there's already an shortened URL with that URL")
+
+	// ErrExpired is returned when reading a shortened URL that has expired
+	ErrExpired = errors.New("the shortened URL has expired")
+
+	// ErrDisabled is returned when reading a shortened URL that has been disabled
+	ErrDisabled = errors.New("the shortened URL is disabled")
+
+	// ErrShortURLEmpty is returned when the short URL is empty
+	ErrShortURLEmpty = &ValidationError{"the short URL can't be empty"}
+
+	// ErrShortURLReserved is returned when the short URL starts with a path reserved by the URL shortener
+	ErrShortURLReserved = &ValidationError{"the short URL is reserved by the URL shortener"}
+
+	// ErrLongURLEmpty is returned when the long URL is empty
+	ErrLongURLEmpty = &ValidationError{"the long URL can't be empty"}
+
+	// ErrLongURLInvalid is returned when the long URL isn't a valid URL
+	ErrLongURLInvalid = &ValidationError{"the long URL needs to be a valid URL"}
+
+	// ErrExpiresAtPast is returned when the expiration date is in the past
+	ErrExpiresAtPast = &ValidationError{"the expiration date needs to be in the future"}
+
+	// ErrMaxClicksNegative is returned when the maximum number of clicks is negative
+	ErrMaxClicksNegative = &ValidationError{"the maximum number of clicks can't be negative"}
+
+	// ErrRedirectStatusInvalid is returned when the redirect status isn't one of RedirectStatuses
+	ErrRedirectStatusInvalid = &ValidationError{"the redirect status needs to be 301, 302, 307 or 308"}
+)
+
+// ValidationError is the error returned when the data provided to the DB isn't valid
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+// Store is the interface that needs to be implemented by the storage backends of the URL shortener
+type Store interface {
+	// Initialize prepares the store to be used
+	Initialize() error
+	// Ping checks that the store has been initialized and that the shortened URLs can be read
+	Ping() error
+	// ReadURL returns the target URL of a shortened URL. If the shortened URL has expired, it returns ErrExpired, and
+	// if it's disabled, it returns ErrDisabled
+	ReadURL(shortURL string) (string, error)
+	// ReadRedirect returns the target URL of a shortened URL and the status code of its redirect, which is 0 if it uses
+	// the default one. It returns the same errors as ReadURL
+	ReadRedirect(shortURL string) (string, int, error)
+	// ReadLink returns a shortened URL, even if it has expired or it's disabled
+	ReadLink(shortURL string) (*Link, error)
+	// FollowLink returns a shortened URL that is going to redirect. If it has a maximum number of clicks, the click
+	// is counted atomically, so the concurrent redirects can't exceed the limit. The links without maximum are only
+	// read, so their redirects don't wait for each other. It returns the same errors as ReadURL
+	FollowLink(shortURL string) (*Link, error)
+	// ListURLs returns all the shortened URLs, sorted by the short URL
+	ListURLs() ([]Link, error)
+	// WalkURLs calls the function provided with each shortened URL, sorted by the short URL, until it returns an
+	// error, which is returned
+	WalkURLs(fn func(l Link) error) error
+	// AddURL adds a new shortened URL that never expires
+	AddURL(shortURL string, longURL string) error
+	// AddLink adds a new shortened URL. If the short URL is empty, a new one is generated and set in the link. If the
+	// link has owner, the short URL needs to be inside its namespace
+	AddLink(l *Link) error
+	// ImportLinks imports a batch of shortened URLs at once, and returns the result of each one of them. The invalid
+	// shortened URLs are reported without stopping the import, and the conflicts are resolved with the policy
+	// provided. If an error is returned, none of the shortened URLs of the batch is imported
+	ImportLinks(links []Link, opts ImportOptions) ([]ImportResult, error)
+	// UpdateURL changes the target URL of an existing shortened URL. The previous target is added to its history
+	UpdateURL(shortURL string, longURL string) error
+	// UpdateLink changes the target URL and the redirect status of an existing shortened URL at once. Either all the
+	// changes are made or none of them
+	UpdateLink(shortURL string, u LinkUpdate) error
+	// History returns the previous targets of a shortened URL, from the oldest to the newest
+	History(shortURL string) ([]TargetChange, error)
+	// SetDisabled disables or enables an existing shortened URL. The disabled shortened URLs don't redirect
+	SetDisabled(shortURL string, disabled bool) error
+	// SetRedirectStatus changes the status code of the redirects of an existing shortened URL. If it's 0, the default
+	// one is used
+	SetRedirectStatus(shortURL string, status int) error
+	// DeleteURL removes a shortened URL
+	DeleteURL(shortURL string) error
+	// DeleteExpired removes all the shortened URLs that have expired at the time provided. It returns the number of
+	// shortened URLs removed
+	DeleteExpired(now time.Time) (int, error)
+	// Stats returns statistics of the store
+	Stats() (*Stats, error)
+	// RecordHits stores the hits of shortened URLs and increments their click counters. The hits of shortened URLs
+	// that don't exist are ignored
+	RecordHits(hits []Hit) error
+	// Clicks returns the click statistics of a shortened URL
+	Clicks(shortURL string) (*ClickStats, error)
+}
+
+// Link is a shortened URL and the URL that it redirects to
+type Link struct {
+	ShortURL string `json:"shortURL"`
+	LongURL  string `json:"longURL"`
+
+	// ExpiresAt is the time when the shortened URL expires. If it's nil, it never expires
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// MaxClicks is the number of clicks after which the shortened URL expires. If it's 0, there's no limit
+	MaxClicks int `json:"maxClicks,omitempty"`
+
+	// Owner is the username of the user that created the shortened URL. If it's empty, it doesn't have owner
+	Owner string `json:"owner,omitempty"`
+	// Disabled is whether the shortened URL has been disabled, so it doesn't redirect
+	Disabled bool `json:"disabled,omitempty"`
+	// RedirectStatus is the status code of the redirects of the shortened URL, one of RedirectStatuses. If it's 0, the
+	// default one of the URL shortener is used
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+
+	// CreatedAt is the time when the shortened URL was created. It's set when adding it if it's zero, and it's zero
+	// for the shortened URLs created before it was stored
+	CreatedAt time.Time `json:"-"`
+	// Clicks is the number of clicks of the shortened URL. It's set by the store when reading the shortened URL
+	Clicks int `json:"-"`
+}
+
+// Expired returns whether the shortened URL has expired at the time provided with the number of clicks provided
+func (l *Link) Expired(now time.Time, clicks int) bool {
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return true
+	}
+
+	return l.MaxClicks > 0 && clicks >= l.MaxClicks
+}
+
+// Available returns an error if the shortened URL can't redirect at the time provided, because it has expired or
+// it's disabled
+func (l *Link) Available(now time.Time) error {
+	if l.Disabled {
+		return ErrDisabled
+	}
+
+	if l.Expired(now, l.Clicks) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// Expires returns whether the shortened URL can expire
+func (l *Link) Expires() bool {
+	return l.ExpiresAt != nil || l.MaxClicks > 0
+}
+
+// TargetChange is a previous target of a shortened URL, that has been replaced
+type TargetChange struct {
+	LongURL    string    `json:"longURL"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
+
+// Stats are the statistics of a store
+type Stats struct {
+	Links int `json:"links"`
+}
+
+// RedirectStatuses are the status codes that can be used by the redirects of the shortened URLs. The permanent ones
+// (301 and 308) are cached by the browsers, and the ones that keep the method and the body (307 and 308) are useful
+// for the API clients
+var RedirectStatuses = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// ValidateRedirectStatus checks that a status code can be used by the redirects of the shortened URLs. The 0 is
+// valid, since it means that the default one is used
+func ValidateRedirectStatus(status int) error {
+	if status == 0 {
+		return nil
+	}
+
+	for _, s := range RedirectStatuses {
+		if status == s {
+			return nil
+		}
+	}
+
+	return ErrRedirectStatusInvalid
+}
+
+// LinkUpdate are the changes of an existing shortened URL. The fields that aren't set aren't changed, but the target
+// is required unless the redirect status is set
+type LinkUpdate struct {
+	// LongURL is the new target URL. The previous target is added to the history
+	LongURL string
+	// RedirectStatus is the new status code of the redirects. If it points to 0, the default one is used
+	RedirectStatus *int
+}
+
+// validate checks that the changes are valid, before making any of them
+func (u LinkUpdate) validate() error {
+	if u.RedirectStatus != nil {
+		if err := ValidateRedirectStatus(*u.RedirectStatus); err != nil {
+			return err
+		}
+	}
+
+	if u.LongURL != "" || u.RedirectStatus == nil {
+		return validateLongURL(u.LongURL)
+	}
+
+	return nil
+}
+
+// ReservedShortURLs are the paths served by the URL shortener itself. They can't be used as the first segment of the
+// short URLs (e.g. neither api nor api/go can be used), so the shortened URLs can't shadow them
+var ReservedShortURLs = []string{"api", "admin", "static", "healthz", "readyz", "metrics", "favicon.ico"}
+
+// IsReserved returns whether the first segment of a short URL is reserved by the URL shortener. They are compared
+// without case
+func IsReserved(shortURL string) bool {
+	segment := strings.SplitN(shortURL, "/", 2)[0]
+	for _, reserved := range ReservedShortURLs {
+		if strings.EqualFold(segment, reserved) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prepareLink checks that a new shortened URL is valid, makes its short URL canonical and sets its creation time if
+// it's not set. The short URL is only checked if it's set, since it can be generated
+func prepareLink(l *Link, p *CodePolicy) error {
+	if l.ShortURL != "" {
+		l.ShortURL = p.Canonical(l.ShortURL)
+
+		if IsReserved(l.ShortURL) {
+			return ErrShortURLReserved
+		}
+
+		if err := p.Check(l.ShortURL); err != nil {
+			return err
+		}
+	}
+
+	if err := validateLongURL(l.LongURL); err != nil {
+		return err
+	}
+
+	if l.ExpiresAt != nil && !l.ExpiresAt.After(time.Now()) {
+		return ErrExpiresAtPast
+	}
+
+	if l.MaxClicks < 0 {
+		return ErrMaxClicksNegative
+	}
+
+	if err := ValidateRedirectStatus(l.RedirectStatus); err != nil {
+		return err
+	}
+
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now().UTC()
+	}
+
+	return nil
+}
+
+// validateLongURL checks that the long URL is a valid target for a shortened URL
+func validateLongURL(longURL string) error {
+	if longURL == "" {
+		return ErrLongURLEmpty
+	}
+
+	if !govalidator.IsURL(longURL) {
+		return ErrLongURLInvalid
+	}
+
+	return nil
+}
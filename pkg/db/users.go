@@ -0,0 +1,150 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUserNotFound is returned when the user doesn't exist in the DB
+	ErrUserNotFound = errors.New("the user wasn't found in the DB")
+
+	// ErrUserAlreadyExists is returned when adding an user with an username that is already in use
+	ErrUserAlreadyExists = errors.New("there's already an user with that username")
+
+	// ErrUserInvalid is returned when the username or the password of an user aren't valid
+	ErrUserInvalid = errors.New("the username or the password aren't valid")
+
+	// ErrUsernameEmpty is returned when the username is empty
+	ErrUsernameEmpty = &ValidationError{"the username can't be empty"}
+
+	// ErrPasswordShort is returned when the password is too short
+	ErrPasswordShort = &ValidationError{"the password needs to have at least 8 characters"}
+
+	// ErrNamespaceInvalid is returned when the namespace of an user has characters that aren't allowed
+	ErrNamespaceInvalid = &ValidationError{"the namespace can only have letters, numbers, '-' and '_'"}
+
+	// ErrNamespaceReserved is returned when the namespace of an user is a path reserved by the URL shortener
+	ErrNamespaceReserved = &ValidationError{"the namespace is reserved by the URL shortener"}
+
+	// ErrShortURLNamespace is returned when the short URL isn't inside the namespace of its owner
+	ErrShortURLNamespace = &ValidationError{"the short URL needs to be inside the namespace of the user"}
+)
+
+// minPasswordLength is the minimum length of the passwords of the users
+const minPasswordLength = 8
+
+// namespaceRegexp are the namespaces allowed
+var namespaceRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// UserStore is the interface that needs to be implemented by the storage backends that store the users. Only the
+// hash of the passwords is stored
+type UserStore interface {
+	// AddUser adds a new user with the password provided
+	AddUser(u *User, password string) error
+	// Authenticate returns the user if the password is valid. If it isn't, it returns ErrUserInvalid
+	Authenticate(username, password string) (*User, error)
+	// ReadUser returns an user
+	ReadUser(username string) (*User, error)
+	// ListUsers returns all the users, sorted by username
+	ListUsers() ([]User, error)
+	// DeleteUser removes an user. Its links aren't removed
+	DeleteUser(username string) error
+}
+
+// User is an user of the URL shortener, that owns the links it creates
+type User struct {
+	Username string `json:"username"`
+	// Namespace is the prefix of the short URLs of the user (e.g. team-a for /team-a/...). If it's empty, the user
+	// can only create short URLs without namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Admin is whether the user can manage all the links, and not only its own ones
+	Admin     bool      `json:"admin,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// userRecord is an user with the hash of its password, as stored by the storage backends
+type userRecord struct {
+	User
+	PasswordHash []byte `json:"passwordHash"`
+}
+
+// Prefix returns the prefix that the short URLs of the user need to have
+func (u *User) Prefix() string {
+	if u.Namespace == "" {
+		return ""
+	}
+
+	return u.Namespace + "/"
+}
+
+// newUser validates a new user and returns the hash of its password
+func newUser(u *User, password string) ([]byte, error) {
+	if u.Username == "" {
+		return nil, ErrUsernameEmpty
+	}
+
+	if len(password) < minPasswordLength {
+		return nil, ErrPasswordShort
+	}
+
+	if u.Namespace != "" && !namespaceRegexp.MatchString(u.Namespace) {
+		return nil, ErrNamespaceInvalid
+	}
+
+	if IsReserved(u.Namespace) {
+		return nil, ErrNamespaceReserved
+	}
+
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// checkPassword checks the password of an user against the hash stored
+func checkPassword(hash []byte, password string) error {
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return ErrUserInvalid
+	}
+
+	return nil
+}
+
+// checkNamespace checks that a short URL can be used by its owner. The short URLs of the users with namespace need to
+// be inside it, and the users without namespace can't use any namespace. The links without owner can use any short
+// URL, like the admins. The empty short URLs are generated inside the namespace, so they are always valid
+func checkNamespace(owner *User, shortURL string) error {
+	if owner == nil || owner.Admin || shortURL == "" {
+		return nil
+	}
+
+	prefix := owner.Prefix()
+	if prefix == "" {
+		if strings.Contains(shortURL, "/") {
+			return ErrShortURLNamespace
+		}
+
+		return nil
+	}
+
+	if !strings.HasPrefix(shortURL, prefix) || strings.Contains(strings.TrimPrefix(shortURL, prefix), "/") || shortURL == prefix {
+		return ErrShortURLNamespace
+	}
+
+	return nil
+}
+
+// ownerPrefix returns the prefix of the generated short URLs of a link owned by the user provided
+func ownerPrefix(owner *User) string {
+	if owner == nil {
+		return ""
+	}
+
+	return owner.Prefix()
+}
@@ -0,0 +1,183 @@
+package db_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+type userStore interface {
+	db.Store
+	db.UserStore
+}
+
+func testUsers(t *testing.T, s userStore) {
+	if err := s.AddUser(&db.User{Username: "nefix"}, "password"); err != nil {
+		t.Fatalf("unexpected error adding the user: %v", err)
+	}
+
+	if err := s.AddUser(&db.User{Username: "team", Namespace: "team-a"}, "password"); err != nil {
+		t.Fatalf("unexpected error adding the user: %v", err)
+	}
+
+	errTests := []struct {
+		user        *db.User
+		password    string
+		expectedErr error
+	}{
+		{&db.User{Username: "nefix"}, "password", db.ErrUserAlreadyExists},
+		{&db.User{}, "password", db.ErrUsernameEmpty},
+		{&db.User{Username: "short"}, "pass", db.ErrPasswordShort},
+		{&db.User{Username: "invalid", Namespace: "team/a"}, "password", db.ErrNamespaceInvalid},
+		{&db.User{Username: "reserved", Namespace: "api"}, "password", db.ErrNamespaceReserved},
+	}
+
+	for _, tt := range errTests {
+		if err := s.AddUser(tt.user, tt.password); err != tt.expectedErr {
+			t.Errorf("expecting %v, but got %v", tt.expectedErr, err)
+		}
+	}
+
+	u, err := s.Authenticate("team", "password")
+	if err != nil {
+		t.Errorf("unexpected error authenticating the user: %v", err)
+	}
+
+	if u.Username != "team" || u.Namespace != "team-a" || u.CreatedAt.IsZero() {
+		t.Errorf("unexpected user: %v", u)
+	}
+
+	if _, err = s.Authenticate("team", "wrong password"); err != db.ErrUserInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrUserInvalid, err)
+	}
+
+	if _, err = s.Authenticate("notfound", "password"); err != db.ErrUserInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrUserInvalid, err)
+	}
+
+	users, err := s.ListUsers()
+	if err != nil {
+		t.Errorf("unexpected error listing the users: %v", err)
+	}
+
+	if len(users) != 2 || users[0].Username != "nefix" || users[1].Username != "team" {
+		t.Errorf("expecting the users nefix and team, but got %v", users)
+	}
+
+	// The links record their owner and the namespaces are enforced
+	linkTests := []struct {
+		link        *db.Link
+		expectedErr error
+	}{
+		{&db.Link{ShortURL: "team-a/git", LongURL: "https://gitea.nefixestrada.com", Owner: "team"}, nil},
+		{&db.Link{ShortURL: "git", LongURL: "https://gitea.nefixestrada.com", Owner: "team"}, db.ErrShortURLNamespace},
+		{&db.Link{ShortURL: "team-a/", LongURL: "https://gitea.nefixestrada.com", Owner: "team"}, db.ErrShortURLSegment},
+		{&db.Link{ShortURL: "team-a/git/go", LongURL: "https://gitea.nefixestrada.com", Owner: "team"}, db.ErrShortURLNamespace},
+		{&db.Link{ShortURL: "blog", LongURL: "https://nefixestrada.com", Owner: "nefix"}, nil},
+		{&db.Link{ShortURL: "team-a/blog", LongURL: "https://nefixestrada.com", Owner: "nefix"}, db.ErrShortURLNamespace},
+		{&db.Link{ShortURL: "team-a/admin", LongURL: "https://nefixestrada.com"}, nil},
+		{&db.Link{ShortURL: "ghost", LongURL: "https://nefixestrada.com", Owner: "ghost"}, db.ErrUserNotFound},
+	}
+
+	for _, tt := range linkTests {
+		if err := s.AddLink(tt.link); err != tt.expectedErr {
+			t.Errorf("expecting %v, but got %v", tt.expectedErr, err)
+		}
+	}
+
+	generated := &db.Link{LongURL: "https://nefixestrada.com", Owner: "team"}
+	if err = s.AddLink(generated); err != nil {
+		t.Errorf("unexpected error adding the link: %v", err)
+	}
+
+	if !strings.HasPrefix(generated.ShortURL, "team-a/") || len(generated.ShortURL) != len("team-a/")+db.DefaultLength {
+		t.Errorf("expecting a short URL inside team-a, but got %s", generated.ShortURL)
+	}
+
+	l, err := s.ReadLink("team-a/git")
+	if err != nil {
+		t.Errorf("unexpected error reading the link: %v", err)
+	}
+
+	if l.Owner != "team" {
+		t.Errorf("expecting %s, but got %s", "team", l.Owner)
+	}
+
+	// The owner is kept when updating the link
+	if err = s.UpdateURL("team-a/git", "https://nefixestrada.com"); err != nil {
+		t.Errorf("unexpected error updating the URL: %v", err)
+	}
+
+	links, err := s.ListURLs()
+	if err != nil {
+		t.Errorf("unexpected error listing the URLs: %v", err)
+	}
+
+	for _, l := range links {
+		if l.ShortURL == "team-a/git" && l.Owner != "team" {
+			t.Errorf("expecting %s, but got %s", "team", l.Owner)
+		}
+	}
+
+	if err = s.DeleteUser("team"); err != nil {
+		t.Errorf("unexpected error deleting the user: %v", err)
+	}
+
+	if _, err = s.ReadUser("team"); err != db.ErrUserNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrUserNotFound, err)
+	}
+
+	if err = s.DeleteUser("team"); err != db.ErrUserNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrUserNotFound, err)
+	}
+}
+
+// Should work as expected
+func TestUsers(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+
+	if err = d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	testUsers(t, d)
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should work as expected
+func TestMemoryUsers(t *testing.T) {
+	m := &db.Memory{}
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the memory store: %v", err)
+	}
+
+	testUsers(t, m)
+}
+
+// Should work as expected
+func TestSQLUsers(t *testing.T) {
+	s := newSQLite(t)
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("unexpected error initializing the DB: %v", err)
+	}
+
+	testUsers(t, s)
+
+	if err := s.DB.Close(); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
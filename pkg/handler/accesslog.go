@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader is the header with the ID of the request. If a proxy in front of the URL shortener sets it, its ID
+// is kept
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of the request IDs received, the longer ones are replaced
+const maxRequestIDLength = 128
+
+// statusWriter is a response writer that keeps the status code and the size of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+
+	return n, err
+}
+
+// AccessLog returns a handler that logs every request served by h, with its method, path, status, latency, remote
+// address and ID. The ID is set in the X-Request-ID header of the response, and it's taken from the request if it
+// has it. The requests that fail with a server error are logged as errors
+func AccessLog(h http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id))
+
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(r.Context(), level, "Request served",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Int("size", sw.size),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.String("requestID", id),
+		)
+	})
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// requestIDFromRequest returns the ID of the request, or an empty string if it isn't logged
+func requestIDFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+
+	return id
+}
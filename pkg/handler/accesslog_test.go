@@ -0,0 +1,87 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should log every request with its ID
+func TestAccessLog(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	var buf bytes.Buffer
+	h := handler.AccessLog(handler.Default(d), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	tests := []struct {
+		name           string
+		path           string
+		requestID      string
+		expectedStatus int
+	}{
+		{
+			name:           "with request ID",
+			path:           "/test",
+			requestID:      "abc123",
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "without request ID",
+			path:           "/api/v1/links/notfound",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+
+			r, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.requestID != "" {
+				r.Header.Set("X-Request-ID", tt.requestID)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			id := w.Header().Get("X-Request-ID")
+			if id == "" || (tt.requestID != "" && id != tt.requestID) {
+				t.Errorf("expecting the request ID %q, but got %q", tt.requestID, id)
+			}
+
+			var line struct {
+				Method     string `json:"method"`
+				Path       string `json:"path"`
+				Status     int    `json:"status"`
+				RemoteAddr string `json:"remoteAddr"`
+				RequestID  string `json:"requestID"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("error decoding the log: %v", err)
+			}
+
+			if line.Method != http.MethodGet || line.Path != tt.path || line.Status != tt.expectedStatus ||
+				line.RemoteAddr != r.RemoteAddr || line.RequestID != id {
+				t.Errorf("unexpected log of the request: %s", buf.String())
+			}
+		})
+	}
+}
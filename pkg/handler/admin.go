@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GeertJohan/go.rice"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+const (
+	// adminPath is the path where the admin dashboard is served
+	adminPath = "/admin"
+
+	// adminPageSize is the number of links shown in each page of the admin dashboard
+	adminPageSize = 25
+)
+
+var (
+	// errAdminRequired is returned when an user that isn't an admin tries to use the admin dashboard
+	errAdminRequired = errors.New("only the admins can use the dashboard")
+
+	// errCrossOrigin is returned when an action of the admin dashboard is sent from another site
+	errCrossOrigin = errors.New("the action needs to be sent from the dashboard")
+
+	// errActionInvalid is returned when the action of the admin dashboard doesn't exist
+	errActionInvalid = errors.New("the action isn't valid")
+)
+
+// adminLink is a link shown in the admin dashboard
+type adminLink struct {
+	db.Link
+	// Status is whether the link is active, has expired or is disabled
+	Status string
+}
+
+// adminView is the data used to render the admin dashboard
+type adminView struct {
+	Links []adminLink
+	Query string
+	Sort  string
+	Order string
+	Page  int
+	Pages int
+	Total int
+}
+
+// URL returns the URL of the admin dashboard with the search of the view and the page and sorting provided
+func (v *adminView) URL(page int, sort, order string) string {
+	q := url.Values{}
+	if v.Query != "" {
+		q.Set("q", v.Query)
+	}
+
+	q.Set("sort", sort)
+	q.Set("order", order)
+	q.Set("page", strconv.Itoa(page))
+
+	return adminPath + "?" + q.Encode()
+}
+
+// PageURL returns the URL of the admin dashboard with the search and the sorting of the view, moving the number of
+// pages provided from the current one
+func (v *adminView) PageURL(move int) string {
+	return v.URL(v.Page+move, v.Sort, v.Order)
+}
+
+// SortURL returns the URL of the admin dashboard sorted by the field provided. If the links are already sorted by
+// that field, the order is reversed
+func (v *adminView) SortURL(sort string) string {
+	order := "desc"
+	if v.Sort == sort && v.Order == "desc" {
+		order = "asc"
+	}
+
+	return v.URL(1, sort, order)
+}
+
+// admin serves the admin dashboard, that lists all the links and allows to change them. Only the admins can use it,
+// so it isn't served when the authentication is disabled
+func admin(s db.Store, opts Options, w http.ResponseWriter, r *http.Request) {
+	if !opts.authEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	r, err := authenticate(opts, r)
+	if u := userFromRequest(r); err == nil && u != nil && !u.Admin {
+		err = errAdminRequired
+	}
+
+	if err != nil {
+		if err == errKeyRequired {
+			w.Header().Set("WWW-Authenticate", `Basic realm="urlshortener"`)
+		}
+
+		errorPage(err, w)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		adminAction(audited(s, opts, r), w, r)
+		return
+	}
+
+	adminPage(s, w, r)
+}
+
+// adminPage renders the admin dashboard. The links can be searched by their short or long URL (q), sorted by their
+// creation date or their clicks (sort and order) and are paginated (page)
+func adminPage(s db.Store, w http.ResponseWriter, r *http.Request) {
+	links, err := s.ListURLs()
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	v := &adminView{
+		Query: strings.TrimSpace(r.FormValue("q")),
+		Sort:  r.FormValue("sort"),
+		Order: r.FormValue("order"),
+	}
+
+	if v.Sort != "clicks" {
+		v.Sort = "created"
+	}
+
+	if v.Order != "asc" {
+		v.Order = "desc"
+	}
+
+	links = searchLinks(links, v.Query)
+	sortLinks(links, v.Sort, v.Order == "desc")
+
+	v.Total = len(links)
+	v.Pages = (v.Total + adminPageSize - 1) / adminPageSize
+	if v.Pages == 0 {
+		v.Pages = 1
+	}
+
+	v.Page, _ = strconv.Atoi(r.FormValue("page"))
+	if v.Page < 1 {
+		v.Page = 1
+	}
+
+	if v.Page > v.Pages {
+		v.Page = v.Pages
+	}
+
+	start := (v.Page - 1) * adminPageSize
+	end := start + adminPageSize
+	if end > v.Total {
+		end = v.Total
+	}
+
+	now := time.Now()
+	for _, l := range links[start:end] {
+		status := "Active"
+		switch l.Available(now) {
+		case db.ErrDisabled:
+			status = "Disabled"
+
+		case db.ErrExpired:
+			status = "Expired"
+		}
+
+		v.Links = append(v.Links, adminLink{Link: l, Status: status})
+	}
+
+	tmpl, err := template.New("admin").Parse(rice.MustFindBox("static").MustString("admin.html"))
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	if err := tmpl.Execute(w, v); err != nil {
+		slog.Error("error writting the HTTP response", "at", "adminPage", "err", err)
+	}
+}
+
+// searchLinks returns the links whose short or long URL contain the query, ignoring the case
+func searchLinks(links []db.Link, query string) []db.Link {
+	if query == "" {
+		return links
+	}
+
+	query = strings.ToLower(query)
+
+	found := []db.Link{}
+	for _, l := range links {
+		if strings.Contains(strings.ToLower(l.ShortURL), query) || strings.Contains(strings.ToLower(l.LongURL), query) {
+			found = append(found, l)
+		}
+	}
+
+	return found
+}
+
+// sortLinks sorts the links by their creation date or by their clicks. The links with the same value keep being sorted
+// by their short URL
+func sortLinks(links []db.Link, by string, desc bool) {
+	sort.SliceStable(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		if desc {
+			a, b = b, a
+		}
+
+		if by == "clicks" {
+			return a.Clicks < b.Clicks
+		}
+
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
+
+// adminAction runs an action of the admin dashboard over a link and redirects back to the dashboard. The actions are
+// update (changes the long URL), delete, disable and enable
+func adminAction(s db.Store, w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		errorPage(errCrossOrigin, w)
+		return
+	}
+
+	shortURL := r.PostFormValue("shortURL")
+
+	var err error
+	switch r.PostFormValue("action") {
+	case "update":
+		err = s.UpdateURL(shortURL, r.PostFormValue("longURL"))
+
+	case "delete":
+		err = s.DeleteURL(shortURL)
+
+	case "disable":
+		err = s.SetDisabled(shortURL, true)
+
+	case "enable":
+		err = s.SetDisabled(shortURL, false)
+
+	default:
+		err = errActionInvalid
+	}
+
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	to := adminPath
+	if r.URL.RawQuery != "" {
+		to += "?" + r.URL.RawQuery
+	}
+
+	http.Redirect(w, r, to, http.StatusSeeOther)
+}
+
+// sameOrigin returns whether the request has been sent from the URL shortener itself, using the Origin header or, if
+// it's not set, the Referer header. It protects the actions of the admin dashboard against cross-site requests
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Referer()
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return u.Host == r.Host
+}
@@ -0,0 +1,285 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should only allow the admins to use the dashboard
+func TestAdminAuth(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	for _, u := range []*db.User{{Username: "nefix", Admin: true}, {Username: "team"}} {
+		if err := d.AddUser(u, "password"); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		username       string
+		expectedStatus int
+	}{
+		{
+			name:           "without credentials",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "not admin",
+			username:       "team",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "admin",
+			username:       "nefix",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/admin", nil)
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			if tt.username != "" {
+				r.SetBasicAuth(tt.username, "password")
+			}
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+// Should not serve the dashboard when the authentication is disabled
+func TestAdminAuthDisabled(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	h := handler.Default(d)
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expecting %d, but got %d", http.StatusNotFound, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin", strings.NewReader("action=delete&shortURL=blog"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "http://example.com")
+
+	w = httptest.NewRecorder()
+	h(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expecting %d, but got %d", http.StatusNotFound, w.Code)
+	}
+
+	if _, err := d.ReadURL("blog"); err != nil {
+		t.Errorf("expecting %v, but got %v", nil, err)
+	}
+}
+
+// Should list, search and paginate the links
+func TestAdminPage(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddUser(&db.User{Username: "nefix", Admin: true}, "password"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	for _, shortURL := range []string{"blog", "git", "go"} {
+		if err := d.AddURL(shortURL, "https://"+shortURL+".nefixestrada.com"); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+	}
+
+	for i := 0; i < 30; i++ {
+		if err := d.AddLink(&db.Link{LongURL: "https://golang.org"}); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:     "first page",
+			path:     "/admin",
+			expected: []string{"33 links", "Page 1 of 2", "Next"},
+		},
+		{
+			name:        "last page",
+			path:        "/admin?page=2",
+			expected:    []string{"Page 2 of 2", "Previous"},
+			notExpected: []string{"Next"},
+		},
+		{
+			name:        "search",
+			path:        "/admin?q=NEFIX",
+			expected:    []string{"3 links", "/blog", "/git", "/go", "Page 1 of 1"},
+			notExpected: []string{"golang.org"},
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+			r.SetBasicAuth("nefix", "password")
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expecting %d, but got %d", http.StatusOK, w.Code)
+			}
+
+			for _, s := range tt.expected {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("expecting %s to be in the page", s)
+				}
+			}
+
+			for _, s := range tt.notExpected {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("expecting %s not to be in the page", s)
+				}
+			}
+		})
+	}
+}
+
+// Should run the actions of the dashboard and redirect back to it
+func TestAdminAction(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddUser(&db.User{Username: "nefix", Admin: true}, "password"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := d.AddURL("blog", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		body             string
+		origin           string
+		expectedStatus   int
+		expectedReadErr  error
+		expectedLongURL  string
+		expectedLocation string
+	}{
+		{
+			name:            "cross origin",
+			body:            "action=disable&shortURL=blog",
+			origin:          "https://evil.com",
+			expectedStatus:  http.StatusForbidden,
+			expectedLongURL: "https://nefixestrada.com",
+		},
+		{
+			name:             "disable",
+			body:             "action=disable&shortURL=blog",
+			origin:           "http://example.com",
+			expectedStatus:   http.StatusSeeOther,
+			expectedReadErr:  db.ErrDisabled,
+			expectedLongURL:  "https://nefixestrada.com",
+			expectedLocation: "/admin?page=1",
+		},
+		{
+			name:             "enable",
+			body:             "action=enable&shortURL=blog",
+			origin:           "http://example.com",
+			expectedStatus:   http.StatusSeeOther,
+			expectedLongURL:  "https://nefixestrada.com",
+			expectedLocation: "/admin?page=1",
+		},
+		{
+			name:             "update",
+			body:             "action=update&shortURL=blog&longURL=https://blog.nefixestrada.com",
+			origin:           "http://example.com",
+			expectedStatus:   http.StatusSeeOther,
+			expectedLongURL:  "https://blog.nefixestrada.com",
+			expectedLocation: "/admin?page=1",
+		},
+		{
+			name:             "delete",
+			body:             "action=delete&shortURL=blog",
+			origin:           "http://example.com",
+			expectedStatus:   http.StatusSeeOther,
+			expectedReadErr:  db.ErrNotFound,
+			expectedLocation: "/admin?page=1",
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/admin?page=1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Origin", tt.origin)
+			r.SetBasicAuth("nefix", "password")
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			if location := w.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("expecting %s, but got %s", tt.expectedLocation, location)
+			}
+
+			longURL, err := d.ReadURL("blog")
+			if err != tt.expectedReadErr {
+				t.Errorf("expecting %v, but got %v", tt.expectedReadErr, err)
+			}
+
+			if err == nil && longURL != tt.expectedLongURL {
+				t.Errorf("expecting %s, but got %s", tt.expectedLongURL, longURL)
+			}
+		})
+	}
+}
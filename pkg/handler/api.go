@@ -0,0 +1,511 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/bulk"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+const (
+	// apiLinksPath is the path where the links resource of the API is served
+	apiLinksPath = "/api/v1/links"
+
+	// apiStatsPath is the path where the statistics of the store are served
+	apiStatsPath = "/api/v1/stats"
+
+	// apiImportPath is the path where the links are imported in bulk
+	apiImportPath = "/api/v1/import"
+
+	// apiAuditPath is the path where the audit log is served
+	apiAuditPath = "/api/v1/audit"
+
+	// maxImportSize is the maximum size in bytes of the body of a bulk import
+	maxImportSize = 32 << 20
+)
+
+var (
+	// errImportForbidden is returned when an user that isn't an admin tries to import links
+	errImportForbidden = errors.New("only the API keys and the admins can import links")
+
+	// errAuditForbidden is returned when an user that isn't an admin tries to read the audit log
+	errAuditForbidden = errors.New("only the API keys and the admins can read the audit log")
+
+	// errAuditUnsupported is returned when reading the audit log of a store that doesn't keep it
+	errAuditUnsupported = errors.New("the store doesn't keep an audit log")
+)
+
+// apiError is the envelope used for the errors returned by the API
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+// apiErrorBody contains the details of an error returned by the API
+type apiErrorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// API is the handler for the JSON REST API. It serves the links resource at /api/v1/links (with the click statistics
+// of each link at /api/v1/links/{shortURL}/clicks and its previous targets at /api/v1/links/{shortURL}/history), the
+// statistics of the store at /api/v1/stats, the bulk import of links at /api/v1/import and the audit log at
+// /api/v1/audit, if the store keeps it
+func API(s db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == apiAuditPath {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+
+			audit(s, w, r)
+			return
+		}
+
+		if r.URL.Path == apiImportPath {
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, http.MethodPost)
+				return
+			}
+
+			importLinks(s, w, r)
+			return
+		}
+
+		if r.URL.Path == apiStatsPath {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+
+			stats(s, w)
+			return
+		}
+
+		if r.URL.Path == apiLinksPath || r.URL.Path == apiLinksPath+"/" {
+			switch r.Method {
+			case http.MethodGet:
+				listLinks(s, w, r)
+
+			case http.MethodPost:
+				createLink(s, w, r)
+
+			default:
+				methodNotAllowed(w, http.MethodGet, http.MethodPost)
+			}
+
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, apiLinksPath+"/") {
+			writeAPIError(w, http.StatusNotFound, errors.New("the requested resource doesn't exist"))
+			return
+		}
+
+		shortURL := strings.TrimPrefix(r.URL.Path, apiLinksPath+"/")
+
+		if strings.HasSuffix(shortURL, "/history") {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+
+			history(s, w, r, strings.TrimSuffix(shortURL, "/history"))
+			return
+		}
+
+		if strings.HasSuffix(shortURL, "/clicks") {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+
+			clicks(s, w, r, strings.TrimSuffix(shortURL, "/clicks"))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			getLink(s, w, r, shortURL)
+
+		case http.MethodPut, http.MethodPatch:
+			updateLink(s, w, r, shortURL)
+
+		case http.MethodDelete:
+			deleteLink(s, w, r, shortURL)
+
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+		}
+	}
+}
+
+// listLinks returns all the links of the DB. The users only get their own links
+func listLinks(s db.Store, w http.ResponseWriter, r *http.Request) {
+	links, err := s.ListURLs()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	if u := userFromRequest(r); u != nil && !u.Admin {
+		owned := []db.Link{}
+		for _, l := range links {
+			if l.Owner == u.Username {
+				owned = append(owned, l)
+			}
+		}
+
+		links = owned
+	}
+
+	writeJSON(w, http.StatusOK, links)
+}
+
+// createLinkRequest is the body of the requests that create links. The expiration can be set with a date
+// (expiresAt) or with a duration from now (expiresIn)
+type createLinkRequest struct {
+	db.Link
+	ExpiresIn string `json:"expiresIn,omitempty"`
+}
+
+// createLink adds a new link to the DB. If the short URL is empty, a new one is generated
+func createLink(s db.Store, w http.ResponseWriter, r *http.Request) {
+	var req createLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.New("the request body needs to be a valid JSON"))
+		return
+	}
+
+	link := req.Link
+	if u := userFromRequest(r); u != nil {
+		link.Owner = u.Username
+	}
+
+	var err error
+	if link.ExpiresAt, err = expiresAt(req.ExpiresIn, link.ExpiresAt); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if err := s.AddLink(&link); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", apiLinksPath+"/"+link.ShortURL)
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// importLinks imports the links of the body while it's read, in chunks of bulk.DefaultChunkSize links, each one in a
+// single transaction. The body is a JSON array of links (application/json), JSON Lines (application/x-ndjson) or CSV
+// (text/csv), with their creation date, and it can't be bigger than maxImportSize. The conflict policy (conflict) and
+// the dry run (dryRun) are set in the query. It returns the result of each link, with its line (its position in the
+// JSON arrays). If the import stops, the chunks before the one where it happened are still imported
+func importLinks(s db.Store, w http.ResponseWriter, r *http.Request) {
+	if u := userFromRequest(r); u != nil && !u.Admin {
+		writeDBError(w, errImportForbidden)
+		return
+	}
+
+	opts := bulk.Options{
+		ImportOptions: db.ImportOptions{
+			Conflict: db.ConflictPolicy(r.URL.Query().Get("conflict")),
+		},
+	}
+
+	if err := opts.Conflict.Validate(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	if val := r.URL.Query().Get("dryRun"); val != "" {
+		var err error
+		if opts.DryRun, err = strconv.ParseBool(val); err != nil {
+			writeAPIError(w, http.StatusBadRequest, errors.New("dryRun needs to be a boolean"))
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	rd, err := bulk.NewReader(body, importFormat(r))
+	if err != nil {
+		writeImportError(w, &bulk.ReadError{Err: err})
+		return
+	}
+
+	results := []bulk.Result{}
+	if _, err := bulk.Import(s, rd, opts, func(res bulk.Result) {
+		results = append(results, res)
+	}); err != nil {
+		writeImportError(w, err)
+		return
+	}
+
+	// The rows that can't be read are reported before the rest of the rows of their chunk
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Line < results[j].Line
+	})
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// importFormat returns the format of the body of a bulk import, following its Content-Type. By default, it's a JSON
+// array
+func importFormat(r *http.Request) bulk.Format {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "text/csv":
+		return bulk.FormatCSV
+
+	case "application/x-ndjson", "application/jsonl":
+		return bulk.FormatJSONL
+
+	default:
+		return bulk.FormatJSON
+	}
+}
+
+// writeImportError returns the error that stopped a bulk import. The bodies that are too big or that can't be read
+// are rejected, and the rest of the errors come from the store
+func writeImportError(w http.ResponseWriter, err error) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the request body can't be bigger than %d bytes", tooBig.Limit))
+		return
+	}
+
+	if _, ok := err.(*bulk.ReadError); ok {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeDBError(w, err)
+}
+
+// audit returns the entries of the audit log, from the oldest to the newest. They can be filtered by short URL
+// (shortURL), actor, action and time (since and until, using RFC 3339), and limited (limit)
+func audit(s db.Store, w http.ResponseWriter, r *http.Request) {
+	if u := userFromRequest(r); u != nil && !u.Admin {
+		writeDBError(w, errAuditForbidden)
+		return
+	}
+
+	auditLog, ok := s.(db.AuditLog)
+	if !ok {
+		writeAPIError(w, http.StatusNotImplemented, errAuditUnsupported)
+		return
+	}
+
+	q := r.URL.Query()
+	f := db.AuditFilter{
+		ShortURL: q.Get("shortURL"),
+		Actor:    q.Get("actor"),
+		Action:   db.AuditAction(q.Get("action")),
+	}
+
+	for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if val := q.Get(param); val != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, val); err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("%s needs to be a date in RFC 3339 format", param))
+				return
+			}
+		}
+	}
+
+	if val := q.Get("limit"); val != "" {
+		var err error
+		if f.Limit, err = strconv.Atoi(val); err != nil || f.Limit < 0 {
+			writeAPIError(w, http.StatusBadRequest, errors.New("limit needs to be a positive number"))
+			return
+		}
+	}
+
+	entries, err := db.ListAudit(auditLog, f)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// getLink returns a single link of the DB, even if it has expired
+func getLink(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	if err := authorize(s, r, shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	link, err := s.ReadLink(shortURL)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, link)
+}
+
+// updateLinkRequest is the body of the requests that update a link. The fields that aren't set aren't changed, but
+// the target is required unless the redirect status is set
+type updateLinkRequest struct {
+	LongURL        string `json:"longURL"`
+	RedirectStatus *int   `json:"redirectStatus"`
+}
+
+// updateLink changes the target and the redirect status of an existing link. The previous target is kept in its
+// history. It returns the link updated
+func updateLink(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	var req updateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.New("the request body needs to be a valid JSON"))
+		return
+	}
+
+	if err := authorize(s, r, shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	if err := s.UpdateLink(shortURL, db.LinkUpdate{LongURL: req.LongURL, RedirectStatus: req.RedirectStatus}); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	link, err := s.ReadLink(shortURL)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, link)
+}
+
+// deleteLink removes a link from the DB
+func deleteLink(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	if err := authorize(s, r, shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	if err := s.DeleteURL(shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clicks returns the click statistics of a link
+func clicks(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	if err := authorize(s, r, shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	stats, err := s.Clicks(shortURL)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// history returns the previous targets of a link, from the oldest to the newest
+func history(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	if err := authorize(s, r, shortURL); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	history, err := s.History(shortURL)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// stats returns the statistics of the store
+func stats(s db.Store, w http.ResponseWriter) {
+	stats, err := s.Stats()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// methodNotAllowed returns a method not allowed error with the allowed methods
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, errors.New("the method isn't allowed for the requested resource"))
+}
+
+// writeDBError returns an error of the DB with the right HTTP status code
+func writeDBError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch err.(type) {
+	case *db.ValidationError:
+		status = http.StatusUnprocessableEntity
+
+	default:
+		switch err {
+		case db.ErrNotFound:
+			status = http.StatusNotFound
+
+		case db.ErrAlreadyExists:
+			status = http.StatusConflict
+
+		case db.ErrUserNotFound:
+			status = http.StatusUnprocessableEntity
+
+		case db.ErrExpired, db.ErrDisabled:
+			status = http.StatusGone
+
+		case errForbidden, errImportForbidden, errAuditForbidden:
+			status = http.StatusForbidden
+
+		default:
+			slog.Error("error at the API", "err", err)
+		}
+	}
+
+	writeAPIError(w, status, err)
+}
+
+// writeAPIError returns an error using the error envelope of the API
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{
+		Error: apiErrorBody{
+			Status:  status,
+			Message: err.Error(),
+		},
+	})
+}
+
+// writeJSON encodes the body as JSON and writes it to the response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("error writting the HTTP response", "at", "writeJSON", "err", err)
+	}
+}
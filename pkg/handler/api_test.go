@@ -0,0 +1,492 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+var apiTests = []struct {
+	name           string
+	method         string
+	path           string
+	body           string
+	expectedStatus int
+	expectedBody   string
+}{
+	{
+		name:           "list",
+		method:         http.MethodGet,
+		path:           "/api/v1/links",
+		expectedStatus: http.StatusOK,
+		expectedBody:   `[{"shortURL":"test","longURL":"https://nefixestrada.com"}]` + "\n",
+	},
+	{
+		name:           "create",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusCreated,
+		expectedBody:   `{"shortURL":"go","longURL":"https://golang.org"}` + "\n",
+	},
+	{
+		name:           "create already exists",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"test","longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusConflict,
+		expectedBody:   `{"error":{"status":409,"message":"there's already an shortened URL with that URL"}}` + "\n",
+	},
+	{
+		name:           "create invalid",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://notanurl!"}`,
+		expectedStatus: http.StatusUnprocessableEntity,
+		expectedBody:   `{"error":{"status":422,"message":"the long URL needs to be a valid URL"}}` + "\n",
+	},
+	{
+		name:           "create with maximum clicks",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://golang.org","maxClicks":10}`,
+		expectedStatus: http.StatusCreated,
+		expectedBody:   `{"shortURL":"go","longURL":"https://golang.org","maxClicks":10}` + "\n",
+	},
+	{
+		name:           "create expiration in the past",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://golang.org","expiresAt":"2006-01-02T15:04:05Z"}`,
+		expectedStatus: http.StatusUnprocessableEntity,
+		expectedBody:   `{"error":{"status":422,"message":"the expiration date needs to be in the future"}}` + "\n",
+	},
+	{
+		name:           "create invalid expiration duration",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://golang.org","expiresIn":"tomorrow"}`,
+		expectedStatus: http.StatusUnprocessableEntity,
+		expectedBody:   `{"error":{"status":422,"message":"the expiration duration needs to be a valid duration (e.g. 24h)"}}` + "\n",
+	},
+	{
+		name:           "create expiration duration and date",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{"shortURL":"go","longURL":"https://golang.org","expiresIn":"1h","expiresAt":"2106-01-02T15:04:05Z"}`,
+		expectedStatus: http.StatusUnprocessableEntity,
+		expectedBody:   `{"error":{"status":422,"message":"the expiration can't be both a duration and a date"}}` + "\n",
+	},
+	{
+		name:           "create invalid JSON",
+		method:         http.MethodPost,
+		path:           "/api/v1/links",
+		body:           `{`,
+		expectedStatus: http.StatusBadRequest,
+		expectedBody:   `{"error":{"status":400,"message":"the request body needs to be a valid JSON"}}` + "\n",
+	},
+	{
+		name:           "get",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/test",
+		expectedStatus: http.StatusOK,
+		expectedBody:   `{"shortURL":"test","longURL":"https://nefixestrada.com"}` + "\n",
+	},
+	{
+		name:           "get not found",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/notfound",
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the shortened URL wasn't found in the DB"}}` + "\n",
+	},
+	{
+		name:           "update",
+		method:         http.MethodPut,
+		path:           "/api/v1/links/test",
+		body:           `{"longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusOK,
+		expectedBody:   `{"shortURL":"test","longURL":"https://golang.org"}` + "\n",
+	},
+	{
+		name:           "update not found",
+		method:         http.MethodPatch,
+		path:           "/api/v1/links/notfound",
+		body:           `{"longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the shortened URL wasn't found in the DB"}}` + "\n",
+	},
+	{
+		name:           "delete",
+		method:         http.MethodDelete,
+		path:           "/api/v1/links/test",
+		expectedStatus: http.StatusNoContent,
+	},
+	{
+		name:           "update at the short path",
+		method:         http.MethodPatch,
+		path:           "/test",
+		body:           `{"longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusOK,
+		expectedBody:   `{"shortURL":"test","longURL":"https://golang.org"}` + "\n",
+	},
+	{
+		name:           "delete at the short path",
+		method:         http.MethodDelete,
+		path:           "/test",
+		expectedStatus: http.StatusNoContent,
+	},
+	{
+		name:           "delete at the short path not found",
+		method:         http.MethodDelete,
+		path:           "/notfound",
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the shortened URL wasn't found in the DB"}}` + "\n",
+	},
+	{
+		name:           "history",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/test/history",
+		expectedStatus: http.StatusOK,
+		expectedBody:   "[]\n",
+	},
+	{
+		name:           "history not found",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/notfound/history",
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the shortened URL wasn't found in the DB"}}` + "\n",
+	},
+	{
+		name:           "clicks",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/test/clicks",
+		expectedStatus: http.StatusOK,
+		expectedBody:   `{"shortURL":"test","total":0,"perDay":[],"topReferrers":[],"topCountries":[]}` + "\n",
+	},
+	{
+		name:           "clicks not found",
+		method:         http.MethodGet,
+		path:           "/api/v1/links/notfound/clicks",
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the shortened URL wasn't found in the DB"}}` + "\n",
+	},
+	{
+		name:           "stats",
+		method:         http.MethodGet,
+		path:           "/api/v1/stats",
+		expectedStatus: http.StatusOK,
+		expectedBody:   `{"links":1}` + "\n",
+	},
+	{
+		name:           "import",
+		method:         http.MethodPost,
+		path:           "/api/v1/import?conflict=skip",
+		body:           `[{"shortURL":"go","longURL":"https://golang.org"},{"shortURL":"test","longURL":"https://golang.org"},{"shortURL":"bad","longURL":""}]`,
+		expectedStatus: http.StatusOK,
+		expectedBody:   `[{"line":1,"shortURL":"go","status":"created"},{"line":2,"shortURL":"test","status":"skipped"},{"line":3,"shortURL":"bad","status":"invalid","error":"the long URL can't be empty"}]` + "\n",
+	},
+	{
+		name:           "import wrong type",
+		method:         http.MethodPost,
+		path:           "/api/v1/import",
+		body:           `[{"shortURL":"go","longURL":"https://golang.org","maxClicks":"ten"},{"shortURL":"docs","longURL":"https://golang.org/doc"}]`,
+		expectedStatus: http.StatusOK,
+		expectedBody:   `[{"line":1,"shortURL":"go","status":"invalid","error":"invalid JSON: json: cannot unmarshal string into Go struct field Record.maxClicks of type int"},{"line":2,"shortURL":"docs","status":"created"}]` + "\n",
+	},
+	{
+		name:           "import not an array",
+		method:         http.MethodPost,
+		path:           "/api/v1/import",
+		body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+		expectedStatus: http.StatusBadRequest,
+		expectedBody:   `{"error":{"status":400,"message":"the JSON file needs to be an array of links"}}` + "\n",
+	},
+	{
+		name:           "import invalid JSON",
+		method:         http.MethodPost,
+		path:           "/api/v1/import",
+		body:           `[{"shortURL":"go","longURL":"https://golang.org"},{"shortURL"`,
+		expectedStatus: http.StatusBadRequest,
+		expectedBody:   `{"error":{"status":400,"message":"invalid JSON: unexpected EOF"}}` + "\n",
+	},
+	{
+		name:           "import conflict",
+		method:         http.MethodPost,
+		path:           "/api/v1/import?conflict=fail",
+		body:           `[{"shortURL":"test","longURL":"https://golang.org"}]`,
+		expectedStatus: http.StatusConflict,
+		expectedBody:   `{"error":{"status":409,"message":"there's already an shortened URL with that URL"}}` + "\n",
+	},
+	{
+		name:           "import invalid conflict policy",
+		method:         http.MethodPost,
+		path:           "/api/v1/import?conflict=merge",
+		body:           `[]`,
+		expectedStatus: http.StatusUnprocessableEntity,
+		expectedBody:   `{"error":{"status":422,"message":"the conflict policy needs to be skip, overwrite or fail"}}` + "\n",
+	},
+	{
+		name:           "method not allowed",
+		method:         http.MethodDelete,
+		path:           "/api/v1/links",
+		expectedStatus: http.StatusMethodNotAllowed,
+		expectedBody:   `{"error":{"status":405,"message":"the method isn't allowed for the requested resource"}}` + "\n",
+	},
+	{
+		name:           "unknown resource",
+		method:         http.MethodGet,
+		path:           "/api/v1/users",
+		expectedStatus: http.StatusNotFound,
+		expectedBody:   `{"error":{"status":404,"message":"the requested resource doesn't exist"}}` + "\n",
+	},
+}
+
+// Should work as expected
+func TestAPI(t *testing.T) {
+	for _, tt := range apiTests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &db.Memory{}
+			if err := d.Initialize(); err != nil {
+				t.Fatalf("error initializing the DB: %v", err)
+			}
+
+			if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			r, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.Default(d)(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expecting %s, but got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// Should generate the short URL when it's not provided
+func TestAPICreateGenerated(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, "/api/v1/links", strings.NewReader(`{"longURL":"https://golang.org"}`))
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	var link db.Link
+	if err = json.NewDecoder(w.Body).Decode(&link); err != nil {
+		t.Fatalf("error decoding the response: %v", err)
+	}
+
+	if len(link.ShortURL) != db.DefaultLength {
+		t.Errorf("expecting a short URL of length %d, but got %s", db.DefaultLength, link.ShortURL)
+	}
+
+	if w.Header().Get("Location") != "/api/v1/links/"+link.ShortURL {
+		t.Errorf("expecting %s, but got %s", "/api/v1/links/"+link.ShortURL, w.Header().Get("Location"))
+	}
+
+	longURL, err := d.ReadURL(link.ShortURL)
+	if err != nil {
+		t.Errorf("unexpected error when reading the URL in the DB: %v", err)
+	}
+
+	if longURL != "https://golang.org" {
+		t.Errorf("expecting %s, but got %s", "https://golang.org", longURL)
+	}
+}
+
+// Should set the expiration date from the duration
+func TestAPICreateExpiresIn(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, "/api/v1/links", strings.NewReader(`{"shortURL":"go","longURL":"https://golang.org","expiresIn":"24h"}`))
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	before := time.Now()
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	l, err := d.ReadLink("go")
+	if err != nil {
+		t.Fatalf("unexpected error when reading the link in the DB: %v", err)
+	}
+
+	if l.ExpiresAt == nil || l.ExpiresAt.Before(before.Add(24*time.Hour)) || l.ExpiresAt.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("expecting an expiration in 24h, but got %v", l.ExpiresAt)
+	}
+}
+
+// Should return gone when reading an expired link
+func TestAPIGetExpired(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddLink(&db.Link{ShortURL: "go", LongURL: "https://golang.org", MaxClicks: 1}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := d.RecordHits([]db.Hit{{ShortURL: "go", Time: time.Now()}}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	// The API still returns the expired links, so they can be inspected
+	r, err := http.NewRequest(http.MethodGet, "/api/v1/links/go", nil)
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	// The redirect doesn't work anymore
+	r, err = http.NewRequest(http.MethodGet, "/go", nil)
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("expecting %d, but got %d", http.StatusGone, w.Code)
+	}
+}
+
+// Should import the links of JSON arrays, JSON Lines and CSV bodies in chunks, and reject the bodies that are too big
+func TestAPIImport(t *testing.T) {
+	links := make([]string, 1200)
+	for i := range links {
+		links[i] = fmt.Sprintf(`{"shortURL":"link%d","longURL":"https://golang.org"}`, i)
+	}
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedResults int
+	}{
+		{
+			name:            "json array in chunks",
+			contentType:     "application/json",
+			body:            "[" + strings.Join(links, ",") + "]",
+			expectedStatus:  http.StatusOK,
+			expectedResults: len(links),
+		},
+		{
+			name:            "json lines",
+			contentType:     "application/x-ndjson",
+			body:            strings.Join(links[:3], "\n"),
+			expectedStatus:  http.StatusOK,
+			expectedResults: 3,
+		},
+		{
+			name:            "csv",
+			contentType:     "text/csv; charset=utf-8",
+			body:            "short_url,long_url\nlink0,https://golang.org\nlink1,https://golang.org\n",
+			expectedStatus:  http.StatusOK,
+			expectedResults: 2,
+		},
+		{
+			name:           "csv without long_url",
+			contentType:    "text/csv",
+			body:           "short_url,url\nlink0,https://golang.org\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too big",
+			contentType:    "application/json",
+			body:           "[" + strings.Repeat(" ", 32<<20) + "]",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &db.Memory{}
+			if err := d.Initialize(); err != nil {
+				t.Fatalf("error initializing the DB: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/import", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			w := httptest.NewRecorder()
+
+			handler.Default(d)(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expecting %d, but got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var results []db.ImportResult
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("error decoding the response: %v", err)
+			}
+
+			if len(results) != tt.expectedResults {
+				t.Errorf("expecting %d, but got %d", tt.expectedResults, len(results))
+			}
+
+			stats, err := d.Stats()
+			if err != nil {
+				t.Fatalf("unexpected error reading the stats: %v", err)
+			}
+
+			if stats.Links != tt.expectedResults {
+				t.Errorf("expecting %d, but got %d", tt.expectedResults, stats.Links)
+			}
+		})
+	}
+}
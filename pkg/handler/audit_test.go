@@ -0,0 +1,127 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should record the changes of the links with who makes them, and only allow the API keys and the admins to read them
+func TestAudit(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	key, err := d.AddKey("deploy")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := d.AddUser(&db.User{Username: "nefix"}, "password"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d, Audit: d})
+
+	do := func(method, path, body string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+
+		if auth != nil {
+			auth(r)
+		}
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		return w
+	}
+
+	withKey := func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+key) }
+	withUser := func(r *http.Request) { r.SetBasicAuth("nefix", "password") }
+
+	if w := do(http.MethodPost, "/api/v1/links", `{"shortURL":"blog","longURL":"https://nefixestrada.com"}`, withUser); w.Code != http.StatusCreated {
+		t.Fatalf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	// The target and the redirect status are changed together, with a single entry
+	if w := do(http.MethodPut, "/blog", `{"longURL":"https://blog.nefixestrada.com","redirectStatus":301}`, withKey); w.Code != http.StatusOK {
+		t.Fatalf("expecting %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	// The failed changes shouldn't be recorded
+	if w := do(http.MethodDelete, "/api/v1/links/notfound", "", withKey); w.Code != http.StatusNotFound {
+		t.Fatalf("expecting %d, but got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := do(http.MethodGet, "/api/v1/audit?shortURL=blog", "", withKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	var entries []db.AuditEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("error decoding the response: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expecting %d entries, but got %v", 2, entries)
+	}
+
+	if entries[0].Actor != "user:nefix" || entries[0].Action != db.AuditCreate || entries[0].Old != nil || entries[0].New.Owner != "nefix" {
+		t.Errorf("expecting the creation by user:nefix, but got %+v", entries[0])
+	}
+
+	if entries[1].Actor != "key:deploy" || entries[1].Action != db.AuditUpdate ||
+		entries[1].Old.LongURL != "https://nefixestrada.com" || entries[1].New.LongURL != "https://blog.nefixestrada.com" ||
+		entries[1].Old.RedirectStatus != 0 || entries[1].New.RedirectStatus != http.StatusMovedPermanently {
+		t.Errorf("expecting the update by key:deploy, but got %+v", entries[1])
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		auth           func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "without credentials",
+			path:           "/api/v1/audit",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "user that isn't an admin",
+			path:           "/api/v1/audit",
+			auth:           withUser,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "invalid date",
+			path:           "/api/v1/audit?since=yesterday",
+			auth:           withKey,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid limit",
+			path:           "/api/v1/audit?limit=-1",
+			auth:           withKey,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(http.MethodGet, tt.path, "", tt.auth); w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+var (
+	// errKeyRequired is returned when a request that needs to be authenticated doesn't have valid credentials
+	errKeyRequired = errors.New("a valid API key or username and password are required")
+
+	// errForbidden is returned when an user tries to read or change a link of another user
+	errForbidden = errors.New("the link belongs to another user")
+
+	// errCrossSite is returned when a form authenticated with HTTP basic authentication is sent from another site
+	errCrossSite = errors.New("the form needs to be sent from the URL shortener")
+)
+
+// contextKey is the type of the keys of the values that the handler stores in the context of the requests
+type contextKey int
+
+const (
+	// userContextKey is the key of the authenticated user in the context of the requests
+	userContextKey contextKey = iota
+	// actorContextKey is the key of who makes the request in the context of the requests
+	actorContextKey
+	// requestIDContextKey is the key of the ID of the request in the context of the requests
+	requestIDContextKey
+)
+
+// anonymousActor is who makes the requests when the authentication is disabled
+const anonymousActor = "anonymous"
+
+// apiKey returns the API key of the request. It can be sent in the Authorization header as a bearer token, in the
+// X-API-Key header or in the apiKey field of a form in the body. The query string isn't read, so the key doesn't end
+// in the logs or the browser history
+func apiKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	return r.PostFormValue("apiKey")
+}
+
+// credentials returns the username and the password of the request. They can be sent using HTTP basic
+// authentication or in the username and password fields of a form in the body
+func credentials(r *http.Request) (string, string, bool) {
+	if username, password, ok := r.BasicAuth(); ok {
+		return username, password, true
+	}
+
+	if username := r.PostFormValue("username"); username != "" {
+		return username, r.PostFormValue("password"), true
+	}
+
+	return "", "", false
+}
+
+// crossSite returns whether a request authenticated with HTTP basic authentication has been sent by a browser from
+// another site. The browsers send the credentials of basic authentication automatically, so any site could use them to
+// submit a form to the URL shortener. The requests without Origin and Referer headers aren't sent by browsers (e.g.
+// curl), so they aren't cross-site
+func crossSite(r *http.Request) bool {
+	if _, _, ok := r.BasicAuth(); !ok {
+		return false
+	}
+
+	if r.Header.Get("Origin") == "" && r.Referer() == "" {
+		return false
+	}
+
+	return !sameOrigin(r)
+}
+
+// authEnabled returns whether the requests can be authenticated. If the keys and the users are nil, the authentication
+// is disabled
+func (o Options) authEnabled() bool {
+	return o.Keys != nil || o.Users != nil
+}
+
+// authenticate checks the credentials of the request, that can be an API key or the username and password of an
+// user. It returns the request with the authenticated user, that is nil when using an API key, and who makes the
+// request in its context. If the keys and the users are nil, all the requests are allowed
+func authenticate(opts Options, r *http.Request) (*http.Request, error) {
+	if !opts.authEnabled() {
+		return r, nil
+	}
+
+	if opts.Users != nil {
+		if username, password, ok := credentials(r); ok {
+			u, err := opts.Users.Authenticate(username, password)
+			if err != nil {
+				if err == db.ErrUserInvalid {
+					return r, errKeyRequired
+				}
+
+				slog.Error("error authenticating the user", "username", username, "requestID", requestIDFromRequest(r), "err", err)
+
+				return r, err
+			}
+
+			return withActor(withUser(r, u), "user:"+u.Username), nil
+		}
+	}
+
+	key := apiKey(r)
+	if opts.Keys == nil || key == "" {
+		return r, errKeyRequired
+	}
+
+	k, err := opts.Keys.CheckKey(key)
+	if err != nil {
+		if err == db.ErrKeyInvalid {
+			return r, errKeyRequired
+		}
+
+		slog.Error("error checking the API key", "requestID", requestIDFromRequest(r), "err", err)
+
+		return r, err
+	}
+
+	return withActor(r, "key:"+k.Name), nil
+}
+
+// requiresAuth returns whether the request needs to be authenticated. The requests that change the links, the reads
+// of the links (with their clicks and their history) and the audit log need it
+func requiresAuth(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.URL.Path == apiLinksPath || strings.HasPrefix(r.URL.Path, apiLinksPath+"/") || r.URL.Path == apiAuditPath
+
+	default:
+		return true
+	}
+}
+
+// withUser returns the request with the authenticated user in its context
+func withUser(r *http.Request, u *db.User) *http.Request {
+	if u == nil {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, u))
+}
+
+// withActor returns the request with who makes it in its context
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorContextKey, actor))
+}
+
+// actorFromRequest returns who makes the request, as it's recorded in the audit log (e.g. user:nefix or key:deploy)
+func actorFromRequest(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorContextKey).(string); ok {
+		return actor
+	}
+
+	return anonymousActor
+}
+
+// audited returns the store that records the changes made by the request in the audit log. If the audit log isn't
+// set, the changes aren't recorded
+func audited(s db.Store, opts Options, r *http.Request) db.Store {
+	if opts.Audit == nil {
+		return s
+	}
+
+	return &db.Audited{Store: s, Log: opts.Audit, Actor: actorFromRequest(r)}
+}
+
+// userFromRequest returns the authenticated user of the request. It's nil when the request isn't authenticated as an
+// user, which means that it has access to all the links, like the admins
+func userFromRequest(r *http.Request) *db.User {
+	u, _ := r.Context().Value(userContextKey).(*db.User)
+
+	return u
+}
+
+// authorize checks that the user of the request can read or change a link. The users can only read and change their
+// own links, except the admins
+func authorize(s db.Store, r *http.Request, shortURL string) error {
+	u := userFromRequest(r)
+	if u == nil || u.Admin {
+		return nil
+	}
+
+	l, err := s.ReadLink(shortURL)
+	if err != nil {
+		return err
+	}
+
+	if l.Owner != u.Username {
+		return errForbidden
+	}
+
+	return nil
+}
+
+// writeAuthError returns an authentication error of the API
+func writeAuthError(w http.ResponseWriter, err error) {
+	if err != errKeyRequired {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="urlshortener"`)
+	writeAPIError(w, http.StatusUnauthorized, err)
+}
@@ -0,0 +1,493 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should require a valid API key to read and change the links, but not to follow them
+func TestNewAuth(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	key, err := d.AddKey("test")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		header         map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "redirect",
+			method:         http.MethodGet,
+			path:           "/test",
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "get without key",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/test",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "get with key",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/test",
+			header:         map[string]string{"Authorization": "Bearer " + key},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "clicks without key",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/test/clicks",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "history without key",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/test/history",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "stats page without key",
+			method:         http.MethodGet,
+			path:           "/test+",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "stats page with key",
+			method:         http.MethodGet,
+			path:           "/test+",
+			header:         map[string]string{"X-API-Key": key},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "create without key",
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create with invalid key",
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+			header:         map[string]string{"Authorization": "Bearer invalid"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create with bearer key",
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+			header:         map[string]string{"Authorization": "Bearer " + key},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "update without key",
+			method:         http.MethodPut,
+			path:           "/api/v1/links/test",
+			body:           `{"longURL":"https://golang.org"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "update at the short path without key",
+			method:         http.MethodPut,
+			path:           "/test",
+			body:           `{"longURL":"https://golang.org"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "update at the short path with key",
+			method:         http.MethodPut,
+			path:           "/test",
+			body:           `{"longURL":"https://golang.org"}`,
+			header:         map[string]string{"Authorization": "Bearer " + key},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete with header key",
+			method:         http.MethodDelete,
+			path:           "/api/v1/links/go",
+			header:         map[string]string{"X-API-Key": key},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "form without key",
+			method:         http.MethodPost,
+			path:           "/",
+			body:           "shortURL=form&longURL=https://golang.org",
+			header:         map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "form with key",
+			method:         http.MethodPost,
+			path:           "/",
+			body:           "shortURL=form&longURL=https://golang.org&apiKey=" + key,
+			header:         map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "form with key in the query",
+			method:         http.MethodPost,
+			path:           "/?apiKey=" + key,
+			body:           "shortURL=query&longURL=https://golang.org",
+			header:         map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+// Should only allow the users to list, read and change their own links
+func TestNewAuthUsers(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	for _, u := range []*db.User{{Username: "nefix"}, {Username: "team", Namespace: "team-a"}, {Username: "admin", Admin: true}} {
+		if err := d.AddUser(u, "password"); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+	}
+
+	if err := d.AddLink(&db.Link{ShortURL: "blog", LongURL: "https://nefixestrada.com", Owner: "nefix"}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		username       string
+		password       string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "list without credentials",
+			method:         http.MethodGet,
+			path:           "/api/v1/links",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "list with wrong password",
+			method:         http.MethodGet,
+			path:           "/api/v1/links",
+			username:       "nefix",
+			password:       "wrong password",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create inside the namespace",
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"team-a/go","longURL":"https://golang.org"}`,
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"shortURL":"team-a/go","longURL":"https://golang.org","owner":"team"}` + "\n",
+		},
+		{
+			name:           "create outside the namespace",
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"go","longURL":"https://golang.org"}`,
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "list own links",
+			method:         http.MethodGet,
+			path:           "/api/v1/links",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"shortURL":"team-a/go","longURL":"https://golang.org","owner":"team"}]` + "\n",
+		},
+		{
+			name:           "update link of another user",
+			method:         http.MethodPut,
+			path:           "/api/v1/links/blog",
+			body:           `{"longURL":"https://golang.org"}`,
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "delete link of another user",
+			method:         http.MethodDelete,
+			path:           "/api/v1/links/blog",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "delete link of another user at the short path",
+			method:         http.MethodDelete,
+			path:           "/blog",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "get link of another user",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/blog",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "clicks of a link of another user",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/blog/clicks",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "history of a link of another user",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/blog/history",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "stats page of a link of another user",
+			method:         http.MethodGet,
+			path:           "/blog+",
+			username:       "team",
+			password:       "password",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "get own link",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/blog",
+			username:       "nefix",
+			password:       "password",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"shortURL":"blog","longURL":"https://nefixestrada.com","owner":"nefix"}` + "\n",
+		},
+		{
+			name:           "stats page of own link",
+			method:         http.MethodGet,
+			path:           "/blog+",
+			username:       "nefix",
+			password:       "password",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "history of a link of another user as admin",
+			method:         http.MethodGet,
+			path:           "/api/v1/links/blog/history",
+			username:       "admin",
+			password:       "password",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "update link of another user as admin",
+			method:         http.MethodPut,
+			path:           "/api/v1/links/blog",
+			body:           `{"longURL":"https://golang.org"}`,
+			username:       "admin",
+			password:       "password",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete own link",
+			method:         http.MethodDelete,
+			path:           "/api/v1/links/blog",
+			username:       "nefix",
+			password:       "password",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+
+			if tt.username != "" {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("expecting %s, but got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// Should reject the forms authenticated with HTTP basic authentication that are sent from another site
+func TestNewAuthUsersFormCrossSite(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddUser(&db.User{Username: "nefix"}, "password"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		shortURL       string
+		header         map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "from another site",
+			shortURL:       "evil",
+			header:         map[string]string{"Origin": "http://evil.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "from another site with referer",
+			shortURL:       "referer",
+			header:         map[string]string{"Referer": "http://evil.com/form"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "from an opaque origin",
+			shortURL:       "opaque",
+			header:         map[string]string{"Origin": "null"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "from the main page",
+			shortURL:       "page",
+			header:         map[string]string{"Origin": "http://example.com"},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "without browser",
+			shortURL:       "curl",
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	h := handler.New(d, handler.Options{Keys: d, Users: d})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("shortURL="+tt.shortURL+"&longURL=https://nefixestrada.com"))
+			if err != nil {
+				t.Fatalf("error preparing the test: %v", err)
+			}
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetBasicAuth("nefix", "password")
+
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			_, err = d.ReadLink(tt.shortURL)
+			if created := err == nil; created != (tt.expectedStatus == http.StatusCreated) {
+				t.Errorf("expecting the link to be created %v, but got %v", tt.expectedStatus == http.StatusCreated, created)
+			}
+		})
+	}
+}
+
+// Should set the owner of the links created with the form
+func TestNewAuthUsersForm(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddUser(&db.User{Username: "nefix"}, "password"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, "/", strings.NewReader("shortURL=blog&longURL=https://nefixestrada.com&username=nefix&password=password"))
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+
+	handler.New(d, handler.Options{Keys: d, Users: d})(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	l, err := d.ReadLink("blog")
+	if err != nil {
+		t.Fatalf("unexpected error when reading the link in the DB: %v", err)
+	}
+
+	if l.Owner != "nefix" {
+		t.Errorf("expecting %s, but got %s", "nefix", l.Owner)
+	}
+}
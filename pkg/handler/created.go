@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GeertJohan/go.rice"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
+)
+
+// createdQRSize is the size in pixels of the QR code shown in the page of the links created
+const createdQRSize = 256
+
+// createdLink is the response to the clients that create a link with the form and accept JSON. It's the link with
+// its full short link
+type createdLink struct {
+	db.Link
+	ShortLink string `json:"shortLink"`
+}
+
+// createdPageData is the data of the page of the links created
+type createdPageData struct {
+	Link      *db.Link
+	ShortLink string
+	// QRCode is the QR code of the short link, as a PNG data URL. If it's empty, it isn't shown
+	QRCode template.URL
+}
+
+// shortLink returns the full URL of a short URL. It's built with the public URL, or with the scheme and the host of
+// the request if the public URL isn't set
+func (o Options) shortLink(r *http.Request, shortURL string) string {
+	base := strings.TrimSuffix(o.PublicURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		base = scheme + "://" + r.Host
+	}
+
+	return base + (&url.URL{Path: "/" + shortURL}).EscapedPath()
+}
+
+// created responds to the creation of a link with the form. The clients that prefer JSON get the link as JSON and
+// the rest get a page with the short link, a button to copy it and its QR code
+func created(opts Options, w http.ResponseWriter, r *http.Request, l *db.Link) {
+	shortLink := opts.shortLink(r, l.ShortURL)
+	w.Header().Set("Location", shortLink)
+
+	if acceptsJSON(r) {
+		writeJSON(w, http.StatusCreated, createdLink{Link: *l, ShortLink: shortLink})
+		return
+	}
+
+	data := createdPageData{
+		Link:      l,
+		ShortLink: shortLink,
+	}
+
+	o := opts.qr().Defaults
+	o.Size = createdQRSize
+
+	if png, err := opts.qr().Generate(shortLink, qr.FormatPNG, o); err != nil {
+		slog.Error("error generating the QR code", "at", "created", "shortURL", l.ShortURL, "err", err)
+	} else {
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	tmpl, err := template.New("created").Parse(rice.MustFindBox("static").MustString("created.html"))
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.Error("error writting the HTTP response", "at", "created", "err", err)
+	}
+}
+
+// acceptsJSON returns whether the client prefers JSON over HTML, following the quality values of its Accept header.
+// The wildcards aren't taken into account, so the clients that accept anything get HTML
+func acceptsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if val, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(val, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = q
+
+		case "text/html":
+			htmlQ = q
+		}
+	}
+
+	return jsonQ > htmlQ
+}
@@ -0,0 +1,147 @@
+package handler_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should respond with the link created as JSON or as a page, depending on the Accept header
+func TestNewCreated(t *testing.T) {
+	tests := []struct {
+		name           string
+		accept         string
+		shortURL       string
+		longURL        string
+		expectedStatus int
+		expectedType   string
+		expectedBody   string
+	}{
+		{
+			name:           "json",
+			accept:         "application/json",
+			shortURL:       "go",
+			longURL:        "https://golang.org",
+			expectedStatus: http.StatusCreated,
+			expectedType:   "application/json",
+			expectedBody:   `{"shortURL":"go","longURL":"https://golang.org","shortLink":"https://short.nefixestrada.com/go"}`,
+		},
+		{
+			name:           "json preferred",
+			accept:         "text/html;q=0.5, application/json",
+			shortURL:       "café",
+			longURL:        "https://golang.org",
+			expectedStatus: http.StatusCreated,
+			expectedType:   "application/json",
+			expectedBody:   `{"shortURL":"café","longURL":"https://golang.org","shortLink":"https://short.nefixestrada.com/caf%C3%A9"}`,
+		},
+		{
+			name:           "json error",
+			accept:         "application/json",
+			shortURL:       "invalid",
+			longURL:        "not an URL",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   "application/json",
+			expectedBody:   `{"error":{"status":422,"message":"the long URL needs to be a valid URL"}}`,
+		},
+		{
+			name:           "json conflict",
+			accept:         "application/json",
+			shortURL:       "go",
+			longURL:        "https://golang.org",
+			expectedStatus: http.StatusConflict,
+			expectedType:   "application/json",
+			expectedBody:   `{"error":{"status":409,"message":"there's already an shortened URL with that URL"}}`,
+		},
+		{
+			name:           "html preferred",
+			accept:         "text/html, application/json;q=0.9",
+			shortURL:       "blog",
+			longURL:        "https://nefixestrada.com",
+			expectedStatus: http.StatusCreated,
+			expectedType:   "text/html; charset=utf-8",
+		},
+		{
+			name:           "anything",
+			accept:         "*/*",
+			shortURL:       "docs",
+			longURL:        "https://golang.org/doc",
+			expectedStatus: http.StatusCreated,
+			expectedType:   "text/html; charset=utf-8",
+		},
+	}
+
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	h := handler.New(d, handler.Options{PublicURL: "https://short.nefixestrada.com"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"shortURL": {tt.shortURL}, "longURL": {tt.longURL}}
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept", tt.accept)
+
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Header().Get("Content-Type") != tt.expectedType {
+				t.Errorf("expecting %s, but got %s", tt.expectedType, w.Header().Get("Content-Type"))
+			}
+
+			if tt.expectedBody != "" && strings.TrimSpace(w.Body.String()) != tt.expectedBody {
+				t.Errorf("expecting %s, but got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// Should build the short links with the scheme and the host of the request when the public URL isn't set
+func TestNewCreatedRequestURL(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	h := handler.Default(d)
+
+	tests := []struct {
+		shortURL string
+		tls      bool
+		expected string
+	}{
+		{shortURL: "go", expected: "http://short.nefixestrada.com/go"},
+		{shortURL: "blog", tls: true, expected: "https://short.nefixestrada.com/blog"},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"shortURL": {tt.shortURL}, "longURL": {"https://golang.org"}}
+
+		r := httptest.NewRequest(http.MethodPost, "http://short.nefixestrada.com/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Header().Get("Location") != tt.expected {
+			t.Errorf("expecting %s, but got %s", tt.expected, w.Header().Get("Location"))
+		}
+	}
+}
@@ -1,75 +1,389 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GeertJohan/go.rice"
 
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
 )
 
-// Default is the default handler. It searches for the URL and if it doesn't exist or there's an error, it redirects to
-// the main page
-func Default(db *db.DB) http.HandlerFunc {
+// Recorder records the hits of the redirects
+type Recorder interface {
+	Record(h db.Hit)
+}
+
+// Metrics observes the requests served by the handler
+type Metrics interface {
+	// ObserveRequest is called after serving each request with the route that served it (e.g. redirect or api), its
+	// method, its status code and its duration
+	ObserveRequest(route, method string, status int, d time.Duration)
+}
+
+// Options are the options of the handler
+type Options struct {
+	// Recorder records the hits of the redirects. If it's nil, the hits aren't recorded
+	Recorder Recorder
+
+	// Keys are the API keys that can create, update and delete all the links
+	Keys db.KeyStore
+
+	// Users are the users that can create links and update and delete their own links. If the keys and the users are
+	// nil, anyone can create, update and delete links
+	Users db.UserStore
+
+	// Audit is where the changes of the links are recorded, with who makes them. If it's nil, they aren't recorded
+	Audit db.AuditLog
+
+	// Metrics observes the requests served. If it's nil, they aren't observed
+	Metrics Metrics
+
+	// MetricsHandler serves the metrics at /metrics. If it's nil, they aren't served by the handler (e.g. because they
+	// are served by a separate listener)
+	MetricsHandler http.Handler
+
+	// RedirectStatus is the status code of the redirects of the links that don't set one. If it's 0, 302 Found is used
+	RedirectStatus int
+
+	// PublicURL is the base URL where the URL shortener is reachable (e.g. https://short.nefixestrada.com), used to
+	// build the full short links. If it's empty, they are built with the scheme and the host of each request
+	PublicURL string
+
+	// QR generates the QR codes of the short links. If it's nil, a generator with the default options is used
+	QR *qr.Generator
+}
+
+// redirectStatus returns the status code of the redirect of a link with the redirect status provided
+func (o Options) redirectStatus(status int) int {
+	if status != 0 {
+		return status
+	}
+
+	if o.RedirectStatus != 0 {
+		return o.RedirectStatus
+	}
+
+	return http.StatusFound
+}
+
+// Default is the default handler, with the default options
+func Default(db db.Store) http.HandlerFunc {
+	return New(db, Options{})
+}
+
+// New returns the handler. It searches for the URL and if it doesn't exist or there's an error, it redirects to
+// the main page. The requests to /api/ are served by the API handler, the admin dashboard is served at /admin and the
+// click statistics of a shortened URL are shown adding a '+' at the end of it. The links can also be updated (PUT or
+// PATCH) and deleted (DELETE) at their short path, the same way as in the API. The requests that change the links and
+// the admin dashboard need to be authenticated if the keys or the users are set. The liveness and readiness probes
+// are served at /healthz and /readyz, the static files at /static/ and, if the metrics handler is set, the metrics
+// at /metrics. The rest of the paths reserved by db.ReservedShortURLs return 404 Not Found without searching for them
+func New(store db.Store, opts Options) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		route := opts.route(r)
+
+		if opts.Metrics != nil {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			w = sw
+
+			defer func() {
+				status := sw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				opts.Metrics.ObserveRequest(route, r.Method, status, time.Since(start))
+			}()
+		}
+
 		path := r.URL.Path[1:]
 
-		if path == "" {
+		switch route {
+		case routeHealth:
+			health(w, r)
+
+		case routeReady:
+			ready(store, w, r)
+
+		case routeMetrics:
+			opts.MetricsHandler.ServeHTTP(w, r)
+
+		case routeStatic:
+			staticFiles(w, r)
+
+		case routeNotFound:
+			http.NotFound(w, r)
+
+		case routeAPI:
+			if requiresAuth(r) {
+				var err error
+				if r, err = authenticate(opts, r); err != nil {
+					writeAuthError(w, err)
+					return
+				}
+			}
+
+			API(audited(store, opts, r))(w, r)
+
+		case routeAdmin:
+			admin(store, opts, w, r)
+
+		case routeLink:
+			r, err := authenticate(opts, r)
+			if err != nil {
+				writeAuthError(w, err)
+				return
+			}
+
+			if r.Method == http.MethodDelete {
+				deleteLink(audited(store, opts, r), w, r, path)
+			} else {
+				updateLink(audited(store, opts, r), w, r, path)
+			}
+
+		case routeStats:
+			r, err := authenticate(opts, r)
+			if err != nil {
+				if err == errKeyRequired {
+					w.Header().Set("WWW-Authenticate", `Basic realm="urlshortener"`)
+				}
+
+				errorPage(err, w)
+				return
+			}
+
+			statsPage(store, w, r, strings.TrimSuffix(path, "+"))
+
+		case routeQR:
+			qrCode(store, opts, w, r, path)
+
+		case routeMain:
 			if r.Method == http.MethodPost {
-				addURL(db, w, r)
+				if crossSite(r) {
+					errorPage(errCrossSite, w)
+					return
+				}
+
+				r, err := authenticate(opts, r)
+				if err != nil {
+					errorPage(err, w)
+					return
+				}
+
+				addURL(audited(store, opts, r), opts, w, r)
 				return
 			}
 
 			mainPage(w)
-			return
-		}
 
-		var toURL string
-		var err error
-		if toURL, err = db.ReadURL(path); err != nil {
-			errorPage(err, w)
-			return
+		default:
+			redirect(store, opts, w, r, path)
 		}
+	}
+}
 
-		if len(strings.Split(toURL, "://")) == 1 {
-			toURL = "http://" + toURL
-		}
+// redirect redirects to the target URL of a shortened URL, with its redirect status, and records the hit. The links
+// with a maximum number of clicks count the click before redirecting, so they return 410 Gone once it's reached
+func redirect(store db.Store, opts Options, w http.ResponseWriter, r *http.Request, shortURL string) {
+	l, err := store.FollowLink(shortURL)
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
 
-		http.Redirect(w, r, toURL, http.StatusFound)
+	if opts.Recorder != nil {
+		opts.Recorder.Record(db.Hit{
+			ShortURL:  shortURL,
+			Time:      time.Now(),
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			Country:   country(r),
+			Counted:   l.MaxClicks > 0,
+		})
 	}
+
+	toURL := l.LongURL
+
+	if len(strings.Split(toURL, "://")) == 1 {
+		toURL = "http://" + toURL
+	}
+
+	http.Redirect(w, r, toURL, opts.redirectStatus(l.RedirectStatus))
+}
+
+// countryHeaders are the headers set by proxies and CDNs with the country of the client
+var countryHeaders = []string{"CF-IPCountry", "X-Country-Code", "X-AppEngine-Country"}
+
+// country returns the country of the client if it's provided by the proxy in front of the URL shortener
+func country(r *http.Request) string {
+	for _, h := range countryHeaders {
+		if c := r.Header.Get(h); c != "" {
+			return strings.ToUpper(c)
+		}
+	}
+
+	return ""
 }
 
 // mainPage renders the main page
 func mainPage(w io.Writer) {
 	if _, err := fmt.Fprint(w, rice.MustFindBox("static").MustString("index.html")); err != nil {
-		log.Printf("error writting the HTTP response at mainPage: %v", err)
+		slog.Error("error writting the HTTP response", "at", "mainPage", "err", err)
+	}
+}
+
+// statsPage renders the click statistics of a shortened URL. The users can only see the ones of their own links,
+// except the admins
+func statsPage(s db.Store, w http.ResponseWriter, r *http.Request, shortURL string) {
+	if err := authorize(s, r, shortURL); err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	stats, err := s.Clicks(shortURL)
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	tmpl, err := template.New("stats").Parse(rice.MustFindBox("static").MustString("stats.html"))
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	if err := tmpl.Execute(w, stats); err != nil {
+		slog.Error("error writting the HTTP response", "at", "statsPage", "err", err)
 	}
 }
 
 // errorPage renders an error page with the error provided
 func errorPage(err error, w http.ResponseWriter) {
-	w.WriteHeader(http.StatusBadRequest)
+	status := http.StatusBadRequest
+	switch err {
+	case db.ErrExpired, db.ErrDisabled:
+		status = http.StatusGone
+
+	case errKeyRequired:
+		status = http.StatusUnauthorized
+
+	case errAdminRequired, errCrossOrigin, errCrossSite, errForbidden:
+		status = http.StatusForbidden
+	}
+
+	w.WriteHeader(status)
 	if _, writeErr := fmt.Fprintf(w, "There was an error processing your request: %v\n", err); writeErr != nil {
-		log.Printf("error writting the HTTP response at errorPage: %v", writeErr)
+		slog.Error("error writting the HTTP response", "at", "errorPage", "err", writeErr)
 	}
 }
 
-// addURL adds a new URL to the DB
-func addURL(db *db.DB, w http.ResponseWriter, r *http.Request) {
-	if err := db.AddURL(r.FormValue("shortURL"), r.FormValue("longURL")); err != nil {
+// addURL adds a new URL to the DB. If the short URL is empty, a new one is generated. It responds with the short
+// link created, as a page or as JSON if the client prefers it
+func addURL(s db.Store, opts Options, w http.ResponseWriter, r *http.Request) {
+	l, err := linkFromForm(r)
+	if err != nil {
+		if acceptsJSON(r) {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		errorPage(err, w)
+		return
+	}
+
+	if u := userFromRequest(r); u != nil {
+		l.Owner = u.Username
+	}
+
+	if err := s.AddLink(l); err != nil {
+		if acceptsJSON(r) {
+			writeDBError(w, err)
+			return
+		}
+
 		errorPage(err, w)
 		return
 	}
 
-	url := r.FormValue("longURL")
+	created(opts, w, r, l)
+}
+
+// formTimeLayout is the layout of the dates sent by the datetime-local inputs. They are interpreted as UTC
+const formTimeLayout = "2006-01-02T15:04"
+
+// linkFromForm returns the new shortened URL sent in the form of the main page
+func linkFromForm(r *http.Request) (*db.Link, error) {
+	l := &db.Link{
+		ShortURL: r.FormValue("shortURL"),
+		LongURL:  r.FormValue("longURL"),
+	}
+
+	var at *time.Time
+	if val := r.FormValue("expiresAt"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			if t, err = time.Parse(formTimeLayout, val); err != nil {
+				return nil, errExpiresAtInvalid
+			}
+		}
+
+		at = &t
+	}
 
-	if len(strings.Split(url, "://")) == 1 {
-		url = "http://" + url
+	var err error
+	if l.ExpiresAt, err = expiresAt(r.FormValue("expiresIn"), at); err != nil {
+		return nil, err
 	}
 
-	http.Redirect(w, r, url, http.StatusFound)
+	if val := r.FormValue("maxClicks"); val != "" {
+		if l.MaxClicks, err = strconv.Atoi(val); err != nil {
+			return nil, errMaxClicksInvalid
+		}
+	}
+
+	if val := r.FormValue("redirectStatus"); val != "" {
+		if l.RedirectStatus, err = strconv.Atoi(val); err != nil {
+			return nil, db.ErrRedirectStatusInvalid
+		}
+	}
+
+	return l, nil
+}
+
+var (
+	errExpiresInInvalid = errors.New("the expiration duration needs to be a valid duration (e.g. 24h)")
+	errExpiresAtInvalid = errors.New("the expiration date needs to be a valid date")
+	errExpiresBoth      = errors.New("the expiration can't be both a duration and a date")
+	errMaxClicksInvalid = errors.New("the maximum number of clicks needs to be a number")
+)
+
+// expiresAt returns the expiration date of a new shortened URL, that can be set with a duration from now or with a
+// date. If none of them is set, it returns nil
+func expiresAt(expiresIn string, at *time.Time) (*time.Time, error) {
+	if expiresIn == "" {
+		return at, nil
+	}
+
+	if at != nil {
+		return nil, errExpiresBoth
+	}
+
+	d, err := time.ParseDuration(expiresIn)
+	if err != nil {
+		return nil, errExpiresInInvalid
+	}
+
+	t := time.Now().Add(d)
+
+	return &t, nil
 }
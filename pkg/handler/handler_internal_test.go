@@ -102,16 +102,20 @@ func TestAddURL(t *testing.T) {
 
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	var expected []byte
+	expected := "https://short.nefixestrada.com/go"
 
-	addURL(db, w, r)
+	addURL(db, Options{PublicURL: "https://short.nefixestrada.com/"}, w, r)
 
-	if w.Code != http.StatusFound {
-		t.Errorf("expecting %d, but got %d", http.StatusFound, w.Code)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
 	}
 
-	if !bytes.Equal(w.Body.Bytes(), expected) {
-		t.Errorf("expecting %s, but got %s", expected, w.Body.Bytes())
+	if w.Header().Get("Location") != expected {
+		t.Errorf("expecting %s, but got %s", expected, w.Header().Get("Location"))
+	}
+
+	if !bytes.Contains(w.Body.Bytes(), []byte(`value="`+expected+`"`)) {
+		t.Errorf("expecting the page to show %s, but got %s", expected, w.Body.Bytes())
 	}
 
 	if err := os.Remove("urlshortener.db"); err != nil {
@@ -141,9 +145,9 @@ func TestAddURLErr(t *testing.T) {
 		t.Fatalf("error preparing the HTTP request: %v", err)
 	}
 
-	expected := []byte("There was an error processing your request: the short URL can't be empty\n")
+	expected := []byte("There was an error processing your request: the long URL can't be empty\n")
 
-	addURL(db, w, r)
+	addURL(db, Options{}, w, r)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("expecting %d, but got %d", http.StatusBadRequest, w.Code)
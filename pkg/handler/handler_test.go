@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
 	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
@@ -204,27 +206,30 @@ func TestDefaultHandlerNew(t *testing.T) {
 		t.Fatalf("error initializing the DB: %v", err)
 	}
 
-	r, err := http.NewRequest("POST", "/", strings.NewReader("shortURL=test&longURL=https://nefixestrada.com"))
-	if err != nil {
-		t.Fatalf("error preparing the test: %v", err)
-	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader("shortURL=test&longURL=https://nefixestrada.com"))
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	w := httptest.NewRecorder()
 
-	expected := "https://nefixestrada.com"
+	expected := "http://example.com/test"
 
 	handler := handler.Default(db)
 	handler(w, r)
 
-	if w.Code != http.StatusFound {
-		t.Errorf("expecting %d, but got %d", http.StatusFound, w.Code)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
 	}
 
 	if expected != w.Header().Get("Location") {
 		t.Errorf("expecting %s, but got %s", expected, w.Header().Get("Location"))
 	}
 
+	for _, content := range []string{`value="` + expected + `"`, "https://nefixestrada.com", `src="data:image/png;base64,`} {
+		if !strings.Contains(w.Body.String(), content) {
+			t.Errorf("expecting the page to contain %s, but got %s", content, w.Body.String())
+		}
+	}
+
 	if err := os.Remove("urlshortener.db"); err != nil {
 		t.Fatalf("error finishing the test: %v", err)
 	}
@@ -258,10 +263,13 @@ func TestDefaultHandlerNewNoHttp(t *testing.T) {
 	handler := handler.Default(db)
 	handler(w, r)
 
-	if w.Code != http.StatusFound {
-		t.Errorf("expecting %d, but got %d", http.StatusFound, w.Code)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
 	}
 
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/test", nil))
+
 	if expected != w.Header().Get("Location") {
 		t.Errorf("expecting %s, but got %s", expected, w.Header().Get("Location"))
 	}
@@ -270,3 +278,229 @@ func TestDefaultHandlerNewNoHttp(t *testing.T) {
 		t.Fatalf("error finishing the test: %v", err)
 	}
 }
+
+// Should generate the short URL when adding an URL without short URL
+func TestDefaultHandlerNewGenerated(t *testing.T) {
+	boltDB, err := bolt.Open("urlshortener.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("error creating the testing DB: %v", err)
+	}
+
+	d := &db.DB{
+		DB: boltDB,
+	}
+	err = d.Initialize()
+	if err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r, err := http.NewRequest("POST", "/", strings.NewReader("longURL=https://nefixestrada.com"))
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+
+	handler := handler.Default(d)
+	handler(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	links, err := d.ListURLs()
+	if err != nil {
+		t.Fatalf("unexpected error listing the URLs: %v", err)
+	}
+
+	if len(links) != 1 || len(links[0].ShortURL) != db.DefaultLength {
+		t.Errorf("expecting a generated short URL, but got %v", links)
+	}
+
+	if err := os.Remove("urlshortener.db"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should add the expiration when adding an URL with expiration
+func TestDefaultHandlerNewExpiration(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	r, err := http.NewRequest("POST", "/", strings.NewReader("shortURL=test&longURL=https://nefixestrada.com&expiresIn=1h&maxClicks=5"))
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expecting %d, but got %d", http.StatusCreated, w.Code)
+	}
+
+	l, err := d.ReadLink("test")
+	if err != nil {
+		t.Fatalf("unexpected error when reading the link in the DB: %v", err)
+	}
+
+	if l.ExpiresAt == nil || l.MaxClicks != 5 {
+		t.Errorf("expecting an expiration with %d clicks, but got %v", 5, l)
+	}
+}
+
+type mockRecorder struct {
+	hits []db.Hit
+}
+
+func (m *mockRecorder) Record(h db.Hit) {
+	m.hits = append(m.hits, h)
+}
+
+// Should record the hit when redirecting
+func TestNewRecordsHit(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	r, err := http.NewRequest("GET", "/test", nil)
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	r.Header.Set("Referer", "https://golang.org")
+	r.Header.Set("User-Agent", "curl")
+	r.Header.Set("CF-IPCountry", "es")
+
+	w := httptest.NewRecorder()
+
+	rec := &mockRecorder{}
+
+	handler.New(d, handler.Options{Recorder: rec})(w, r)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expecting %d, but got %d", http.StatusFound, w.Code)
+	}
+
+	if len(rec.hits) != 1 {
+		t.Fatalf("expecting %d hits, but got %d", 1, len(rec.hits))
+	}
+
+	h := rec.hits[0]
+	if h.ShortURL != "test" || h.Referrer != "https://golang.org" || h.UserAgent != "curl" || h.Country != "ES" || h.Time.IsZero() {
+		t.Errorf("unexpected hit recorded: %v", h)
+	}
+}
+
+// storeRecorder records the hits directly in the store, like the asynchronous recorder does in the background
+type storeRecorder struct {
+	s db.Store
+}
+
+func (s storeRecorder) Record(h db.Hit) {
+	s.s.RecordHits([]db.Hit{h})
+}
+
+// Should redirect exactly the maximum number of clicks of a link, even when the requests are concurrent
+func TestNewMaxClicksConcurrent(t *testing.T) {
+	const maxClicks, extra = 5, 10
+
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddLink(&db.Link{ShortURL: "test", LongURL: "https://nefixestrada.com", MaxClicks: maxClicks}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	h := handler.New(d, handler.Options{Recorder: storeRecorder{d}})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, maxClicks+extra)
+
+	for i := 0; i < maxClicks+extra; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+			codes <- w.Code
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	redirected, gone := 0, 0
+	for code := range codes {
+		switch {
+		case code >= 300 && code < 400:
+			redirected++
+
+		case code == http.StatusGone:
+			gone++
+
+		default:
+			t.Errorf("unexpected status code: %d", code)
+		}
+	}
+
+	if redirected != maxClicks || gone != extra {
+		t.Errorf("expecting %d redirects and %d gone, but got %d and %d", maxClicks, extra, redirected, gone)
+	}
+
+	stats, err := d.Clicks("test")
+	if err != nil {
+		t.Fatalf("unexpected error reading the clicks: %v", err)
+	}
+
+	if stats.Total != maxClicks {
+		t.Errorf("expecting %d, but got %d", maxClicks, stats.Total)
+	}
+}
+
+// Should return the statistics page
+func TestDefaultHandlerStatsPage(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := d.RecordHits([]db.Hit{{ShortURL: "test", Time: time.Date(2018, 10, 1, 10, 0, 0, 0, time.UTC), Referrer: "https://golang.org"}}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	r, err := http.NewRequest("GET", "/test+", nil)
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+
+	handler.Default(d)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	for _, expected := range []string{"<h1>/test</h1>", "1 clicks in total", "<td>2018-10-01</td><td>1</td>", "<td>https://golang.org</td><td>1</td>"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expecting the page to contain %s, but got %s", expected, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+const (
+	// healthPath is the path of the liveness probe, that succeeds while the process is alive
+	healthPath = "/healthz"
+	// readyPath is the path of the readiness probe, that succeeds while the store can be read
+	readyPath = "/readyz"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// healthStatus is the response of the probes. Checks has the result of each check, that is ok or the error
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// health returns that the process is alive
+func health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, healthStatus{Status: statusOK})
+}
+
+// ready returns whether the URL shortener can serve the shortened URLs, checking that the store can be read. If it
+// can't, it returns 503 Service Unavailable
+func ready(s db.Store, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	rsp := healthStatus{
+		Status: statusOK,
+		Checks: map[string]string{"store": statusOK},
+	}
+
+	status := http.StatusOK
+	if err := s.Ping(); err != nil {
+		slog.Warn("The store isn't ready", "requestID", requestIDFromRequest(r), "err", err)
+
+		rsp.Status = statusUnavailable
+		rsp.Checks["store"] = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, rsp)
+}
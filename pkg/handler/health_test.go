@@ -0,0 +1,84 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should return the status of the probes
+func TestHealth(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		store          db.Store
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "alive",
+			store:          d,
+			method:         http.MethodGet,
+			path:           "/healthz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "alive with the store not ready",
+			store:          &db.Memory{},
+			method:         http.MethodGet,
+			path:           "/healthz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "ready",
+			store:          d,
+			method:         http.MethodGet,
+			path:           "/readyz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok","checks":{"store":"ok"}}`,
+		},
+		{
+			name:           "not ready",
+			store:          &db.Memory{},
+			method:         http.MethodGet,
+			path:           "/readyz",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"unavailable","checks":{"store":"the memory store isn't initialized"}}`,
+		},
+		{
+			name:           "method not allowed",
+			store:          d,
+			method:         http.MethodDelete,
+			path:           "/healthz",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   `{"error":{"status":405,"message":"the method isn't allowed for the requested resource"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Default(tt.store)(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+			}
+
+			if body := strings.TrimSpace(w.Body.String()); body != tt.expectedBody {
+				t.Errorf("expecting %s, but got %s", tt.expectedBody, body)
+			}
+		})
+	}
+}
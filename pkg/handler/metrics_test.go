@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+type mockMetrics struct {
+	requests []string
+}
+
+func (m *mockMetrics) ObserveRequest(route, method string, status int, d time.Duration) {
+	m.requests = append(m.requests, fmt.Sprintf("%s %s %d", route, method, status))
+}
+
+// Should observe the requests with their route and serve the metrics
+func TestNewMetrics(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	m := &mockMetrics{}
+	h := handler.New(d, handler.Options{
+		Metrics: m,
+		MetricsHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "urlshortener_redirects_total 1")
+		}),
+	})
+
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{method: http.MethodGet, path: "/test", expected: "redirect GET 302"},
+		{method: http.MethodGet, path: "/notfound", expected: "redirect GET 400"},
+		{method: http.MethodGet, path: "/", expected: "main GET 200"},
+		{method: http.MethodGet, path: "/test+", expected: "stats GET 200"},
+		{method: http.MethodGet, path: "/test.svg", expected: "qr GET 200"},
+		{method: http.MethodGet, path: "/api/v1/links/test", expected: "api GET 200"},
+		{method: http.MethodDelete, path: "/test", expected: "link DELETE 204"},
+		{method: http.MethodGet, path: "/metrics", expected: "metrics GET 200"},
+	}
+
+	for _, tt := range tests {
+		m.requests = nil
+
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if len(m.requests) != 1 || m.requests[0] != tt.expected {
+			t.Errorf("expecting %v, but got %v", []string{tt.expected}, m.requests)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Body.String() != "urlshortener_redirects_total 1" {
+		t.Errorf("expecting %s, but got %s", "urlshortener_redirects_total 1", w.Body.String())
+	}
+}
+
+// Should return not found when the metrics aren't served by the handler
+func TestNewMetricsNotServed(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	m := &mockMetrics{}
+
+	w := httptest.NewRecorder()
+	handler.New(d, handler.Options{Metrics: m})(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expecting %d, but got %d", http.StatusNotFound, w.Code)
+	}
+
+	if len(m.requests) != 1 || m.requests[0] != "not_found GET 404" {
+		t.Errorf("expecting %v, but got %v", []string{"not_found GET 404"}, m.requests)
+	}
+}
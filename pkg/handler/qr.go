@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
+)
+
+// qrMaxAge is how long the clients and the proxies can cache the QR codes
+const qrMaxAge = 24 * time.Hour
+
+// defaultQR is the generator of the QR codes used when the options don't set one
+var defaultQR = qr.NewGenerator(qr.DefaultOptions(), qr.DefaultCacheSize)
+
+// qr returns the generator of the QR codes
+func (o Options) qr() *qr.Generator {
+	if o.QR != nil {
+		return o.QR
+	}
+
+	return defaultQR
+}
+
+// qrPath returns the short URL and the format of the QR code requested at a path ending with .png or .svg. If the
+// path doesn't request a QR code, the format is empty
+func qrPath(path string) (string, qr.Format) {
+	for _, f := range []qr.Format{qr.FormatPNG, qr.FormatSVG} {
+		ext := "." + string(f)
+		if len(path) > len(ext) && strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext), f
+		}
+	}
+
+	return "", ""
+}
+
+// isQRPath returns whether the path requests the QR code of a shortened URL
+func isQRPath(path string) bool {
+	_, format := qrPath(path)
+	return format != ""
+}
+
+// qrCode serves the QR code of the full short link of a shortened URL. The size, the error correction level and the
+// margin can be changed with the size, level and margin query parameters. If the shortened URL with the extension
+// exists (e.g. logo.png), it's redirected instead. The shortened URLs that have expired or are disabled return 410
+// Gone, like their redirects
+func qrCode(store db.Store, opts Options, w http.ResponseWriter, r *http.Request, path string) {
+	if _, err := store.ReadLink(path); err == nil {
+		redirect(store, opts, w, r, path)
+		return
+	}
+
+	shortURL, format := qrPath(path)
+
+	l, err := store.ReadLink(shortURL)
+	if err != nil {
+		if err == db.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+
+		errorPage(err, w)
+		return
+	}
+
+	if err := l.Available(time.Now()); err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	o, err := qrOptions(opts.qr().Defaults, r.URL.Query())
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	img, err := opts.qr().Generate(opts.shortLink(r, l.ShortURL), format, o)
+	if err != nil {
+		errorPage(err, w)
+		return
+	}
+
+	sum := sha256.Sum256(img)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(qrMaxAge.Seconds())))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:16]))
+
+	http.ServeContent(w, r, "qr."+string(format), time.Time{}, bytes.NewReader(img))
+}
+
+// qrOptions returns the options of a QR code, with the query parameters that change the default ones
+func qrOptions(defaults qr.Options, query url.Values) (qr.Options, error) {
+	o := defaults
+
+	if val := query.Get("size"); val != "" {
+		size, err := strconv.Atoi(val)
+		if err != nil {
+			return o, qr.ErrSizeInvalid
+		}
+
+		o.Size = size
+	}
+
+	if val := query.Get("level"); val != "" {
+		o.Level = val
+	}
+
+	if val := query.Get("margin"); val != "" {
+		margin, err := strconv.Atoi(val)
+		if err != nil {
+			return o, qr.ErrMarginInvalid
+		}
+
+		o.Margin = margin
+	}
+
+	return o, o.Validate()
+}
@@ -0,0 +1,142 @@
+package handler_test
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
+)
+
+// Should serve the QR codes of the short links as PNG and SVG images
+func TestNewQR(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	for shortURL, longURL := range map[string]string{"go": "https://golang.org", "logo.png": "https://nefixestrada.com/logo.png", "disabled": "https://golang.org"} {
+		if err := d.AddURL(shortURL, longURL); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+	}
+
+	if err := d.SetDisabled("disabled", true); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := d.AddLink(&db.Link{ShortURL: "expired", LongURL: "https://golang.org", MaxClicks: 1}); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if _, err := d.FollowLink("expired"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	h := handler.New(d, handler.Options{
+		PublicURL: "https://short.nefixestrada.com",
+		QR:        qr.NewGenerator(qr.Options{Size: 128, Level: "M", Margin: 2}, qr.DefaultCacheSize),
+	})
+
+	tests := []struct {
+		method           string
+		path             string
+		expectedStatus   int
+		expectedType     string
+		expectedSize     int
+		expectedLocation string
+	}{
+		{method: http.MethodGet, path: "/go.png", expectedStatus: http.StatusOK, expectedType: "image/png", expectedSize: 128},
+		{method: http.MethodGet, path: "/go.png?size=300&level=h&margin=0", expectedStatus: http.StatusOK, expectedType: "image/png", expectedSize: 300},
+		{method: http.MethodHead, path: "/go.png", expectedStatus: http.StatusOK, expectedType: "image/png"},
+		{method: http.MethodGet, path: "/go.svg", expectedStatus: http.StatusOK, expectedType: "image/svg+xml"},
+		{method: http.MethodGet, path: "/go.png?size=big", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/go.png?size=4096", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/go.png?size=10", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/go.svg?level=X", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/go.svg?margin=-1", expectedStatus: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/notfound.png", expectedStatus: http.StatusNotFound},
+		{method: http.MethodGet, path: "/disabled.png", expectedStatus: http.StatusGone},
+		{method: http.MethodGet, path: "/expired.svg", expectedStatus: http.StatusGone},
+		{method: http.MethodGet, path: "/logo.png", expectedStatus: http.StatusFound, expectedLocation: "https://nefixestrada.com/logo.png"},
+		{method: http.MethodGet, path: "/.png", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("expecting %d for %s, but got %d", tt.expectedStatus, tt.path, w.Code)
+		}
+
+		if tt.expectedType != "" && w.Header().Get("Content-Type") != tt.expectedType {
+			t.Errorf("expecting %s for %s, but got %s", tt.expectedType, tt.path, w.Header().Get("Content-Type"))
+		}
+
+		if tt.expectedLocation != "" && w.Header().Get("Location") != tt.expectedLocation {
+			t.Errorf("expecting %s for %s, but got %s", tt.expectedLocation, tt.path, w.Header().Get("Location"))
+		}
+
+		if tt.expectedSize != 0 {
+			img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("error decoding the PNG image of %s: %v", tt.path, err)
+			}
+
+			if img.Bounds().Dx() != tt.expectedSize {
+				t.Errorf("expecting %d for %s, but got %d", tt.expectedSize, tt.path, img.Bounds().Dx())
+			}
+		}
+	}
+}
+
+// Should encode the full short link in the QR codes and let the clients cache them
+func TestNewQRCache(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	if err := d.AddURL("go", "https://golang.org"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	h := handler.New(d, handler.Options{PublicURL: "https://short.nefixestrada.com"})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/go.svg", nil))
+
+	expected, err := qr.Encode("https://short.nefixestrada.com/go", qr.FormatSVG, qr.DefaultOptions())
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if !bytes.Equal(w.Body.Bytes(), expected) {
+		t.Errorf("expecting %s, but got %s", expected, w.Body.String())
+	}
+
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") {
+		t.Errorf("expecting a public Cache-Control, but got %s", cc)
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("expecting an ETag, but got none")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/go.svg", nil)
+	r.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	h(w, r)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expecting %d, but got %d", http.StatusNotModified, w.Code)
+	}
+}
@@ -0,0 +1,171 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// Should redirect with the redirect status of the link, or with the default one if the link doesn't set it
+func TestNewRedirectStatus(t *testing.T) {
+	tests := []struct {
+		defaultStatus  int
+		linkStatus     int
+		expectedStatus int
+	}{
+		{defaultStatus: 0, linkStatus: 0, expectedStatus: http.StatusFound},
+		{defaultStatus: http.StatusMovedPermanently, linkStatus: 0, expectedStatus: http.StatusMovedPermanently},
+		{defaultStatus: 0, linkStatus: http.StatusTemporaryRedirect, expectedStatus: http.StatusTemporaryRedirect},
+		{defaultStatus: http.StatusMovedPermanently, linkStatus: http.StatusPermanentRedirect, expectedStatus: http.StatusPermanentRedirect},
+	}
+
+	for _, tt := range tests {
+		d := &db.Memory{}
+		if err := d.Initialize(); err != nil {
+			t.Fatalf("error initializing the DB: %v", err)
+		}
+
+		if err := d.AddLink(&db.Link{ShortURL: "test", LongURL: "https://nefixestrada.com", RedirectStatus: tt.linkStatus}); err != nil {
+			t.Fatalf("error preparing the test: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		handler.New(d, handler.Options{RedirectStatus: tt.defaultStatus})(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+		}
+
+		if w.Header().Get("Location") != "https://nefixestrada.com" {
+			t.Errorf("expecting %s, but got %s", "https://nefixestrada.com", w.Header().Get("Location"))
+		}
+	}
+}
+
+// Should set the redirect status of the links created with the form
+func TestDefaultHandlerNewRedirectStatus(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	h := handler.Default(d)
+
+	tests := []struct {
+		shortURL       string
+		redirectStatus string
+		expectedStatus int
+	}{
+		{shortURL: "permanent", redirectStatus: "308", expectedStatus: http.StatusPermanentRedirect},
+		{shortURL: "default", redirectStatus: "", expectedStatus: http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"shortURL": {tt.shortURL}, "longURL": {"https://nefixestrada.com"}, "redirectStatus": {tt.redirectStatus}}
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		h(httptest.NewRecorder(), r)
+
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/"+tt.shortURL, nil))
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+		}
+	}
+
+	for _, redirectStatus := range []string{"303", "permanent"} {
+		form := url.Values{"shortURL": {"invalid"}, "longURL": {"https://nefixestrada.com"}, "redirectStatus": {redirectStatus}}
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expecting %d, but got %d", http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// Should change the redirect status of the links with the API without changing their target
+func TestAPIRedirectStatus(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	h := handler.API(d)
+
+	tests := []struct {
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"test","longURL":"https://nefixestrada.com","redirectStatus":301}`,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"shortURL":"test","longURL":"https://nefixestrada.com","redirectStatus":301}`,
+		},
+		{
+			method:         http.MethodPost,
+			path:           "/api/v1/links",
+			body:           `{"shortURL":"invalid","longURL":"https://nefixestrada.com","redirectStatus":303}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":{"status":422,"message":"the redirect status needs to be 301, 302, 307 or 308"}}`,
+		},
+		{
+			method:         http.MethodPatch,
+			path:           "/api/v1/links/test",
+			body:           `{"redirectStatus":307}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"shortURL":"test","longURL":"https://nefixestrada.com","redirectStatus":307}`,
+		},
+		{
+			method:         http.MethodPut,
+			path:           "/api/v1/links/test",
+			body:           `{"longURL":"https://golang.org","redirectStatus":200}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":{"status":422,"message":"the redirect status needs to be 301, 302, 307 or 308"}}`,
+		},
+		{
+			method:         http.MethodPut,
+			path:           "/api/v1/links/test",
+			body:           `{"longURL":"https://golang.org"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"shortURL":"test","longURL":"https://golang.org","redirectStatus":307}`,
+		},
+		{
+			method:         http.MethodPut,
+			path:           "/api/v1/links/test",
+			body:           `{"longURL":"https://go.dev","redirectStatus":0}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"shortURL":"test","longURL":"https://go.dev"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("expecting %d, but got %d", tt.expectedStatus, w.Code)
+		}
+
+		if strings.TrimSpace(w.Body.String()) != tt.expectedBody {
+			t.Errorf("expecting %s, but got %s", tt.expectedBody, w.Body.String())
+		}
+	}
+}
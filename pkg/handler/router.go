@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/GeertJohan/go.rice"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+const (
+	// metricsPath is the path where the metrics are served, if the handler serves them
+	metricsPath = "/metrics"
+	// staticPath is the prefix of the paths of the static files
+	staticPath = "/static/"
+)
+
+// The routes of the handler, used to dispatch the requests and to group them in the metrics
+const (
+	routeHealth   = "health"
+	routeReady    = "ready"
+	routeMetrics  = "metrics"
+	routeAPI      = "api"
+	routeAdmin    = "admin"
+	routeStatic   = "static"
+	routeNotFound = "not_found"
+	routeLink     = "link"
+	routeStats    = "stats"
+	routeQR       = "qr"
+	routeMain     = "main"
+	routeRedirect = "redirect"
+)
+
+// systemRoute is a route of the URL shortener itself, served under a path reserved by db.ReservedShortURLs
+type systemRoute struct {
+	name string
+	// path is the path of the route. If it ends with '/', it's the prefix of the paths of the route
+	path string
+}
+
+// systemRoutes are the routes of the URL shortener itself. The first segment of their paths needs to be reserved, so
+// the shortened URLs can't shadow them
+var systemRoutes = []systemRoute{
+	{name: routeHealth, path: healthPath},
+	{name: routeReady, path: readyPath},
+	{name: routeMetrics, path: metricsPath},
+	{name: routeAPI, path: "/api/"},
+	{name: routeAdmin, path: adminPath},
+	{name: routeStatic, path: staticPath},
+}
+
+// match returns whether the route serves the path
+func (s systemRoute) match(path string) bool {
+	if strings.HasSuffix(s.path, "/") {
+		return strings.HasPrefix(path, s.path)
+	}
+
+	return path == s.path
+}
+
+// route returns the route of the handler that serves the request. The reserved paths are routed before anything
+// else, and the ones that don't match any route aren't searched as short URLs
+func (o Options) route(r *http.Request) string {
+	path := r.URL.Path[1:]
+
+	if db.IsReserved(path) {
+		for _, s := range systemRoutes {
+			if s.name == routeMetrics && o.MetricsHandler == nil {
+				continue
+			}
+
+			if s.match(r.URL.Path) {
+				return s.name
+			}
+		}
+
+		return routeNotFound
+	}
+
+	switch {
+	case path != "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch || r.Method == http.MethodDelete):
+		return routeLink
+
+	case len(path) > 1 && strings.HasSuffix(path, "+"):
+		return routeStats
+
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && isQRPath(path):
+		return routeQR
+
+	case path == "":
+		return routeMain
+
+	default:
+		return routeRedirect
+	}
+}
+
+// staticAssets are the extensions of the static files served. The rest of the files of the static directory (e.g.
+// the HTML templates) are only used by the handler
+var staticAssets = map[string]bool{
+	".css":   true,
+	".js":    true,
+	".png":   true,
+	".jpg":   true,
+	".jpeg":  true,
+	".gif":   true,
+	".svg":   true,
+	".ico":   true,
+	".webp":  true,
+	".woff":  true,
+	".woff2": true,
+}
+
+// staticFiles serves the assets embedded in the binary. The directories aren't listed, and the paths are cleaned, so
+// the files outside the static directory can't be read
+func staticFiles(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, staticPath)), "/")
+	if !staticAssets[strings.ToLower(path.Ext(name))] {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := rice.MustFindBox("static").HTTPBox().Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/handler"
+)
+
+// lookupStore is a store that counts the lookups of short URLs
+type lookupStore struct {
+	db.Store
+	lookups int
+}
+
+func (s *lookupStore) ReadURL(shortURL string) (string, error) {
+	s.lookups++
+
+	return s.Store.ReadURL(shortURL)
+}
+
+// Should serve the reserved paths without searching for them as short URLs
+func TestNewReserved(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	s := &lookupStore{Store: d}
+	h := handler.Default(s)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/favicon.ico", expectedStatus: http.StatusNotFound},
+		{path: "/static/index.html", expectedStatus: http.StatusNotFound},
+		{path: "/static/admin.html", expectedStatus: http.StatusNotFound},
+		{path: "/static/created.html", expectedStatus: http.StatusNotFound},
+		{path: "/static/stats.html", expectedStatus: http.StatusNotFound},
+		{path: "/static/", expectedStatus: http.StatusNotFound},
+		{path: "/static/notfound.css", expectedStatus: http.StatusNotFound},
+		{path: "/static/../handler.go", expectedStatus: http.StatusNotFound},
+		{path: "/api", expectedStatus: http.StatusNotFound},
+		{path: "/API/v1/links/go", expectedStatus: http.StatusNotFound},
+		{path: "/admin/go", expectedStatus: http.StatusNotFound},
+		{path: "/healthz/go", expectedStatus: http.StatusNotFound},
+		{path: "/metrics", expectedStatus: http.StatusNotFound},
+		{path: "/healthz", expectedStatus: http.StatusOK},
+		{path: "/api/v1/stats", expectedStatus: http.StatusOK},
+	}
+
+	for _, reserved := range db.ReservedShortURLs {
+		tests = append(tests, struct {
+			path           string
+			expectedStatus int
+		}{path: "/" + reserved + "+", expectedStatus: http.StatusBadRequest})
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("expecting %d for %s, but got %d", tt.expectedStatus, tt.path, w.Code)
+		}
+	}
+
+	for _, reserved := range db.ReservedShortURLs {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/"+reserved, nil))
+
+		if w.Code == http.StatusBadRequest || w.Code == http.StatusFound {
+			t.Errorf("expecting /%s to be served by the URL shortener, but got %d", reserved, w.Code)
+		}
+	}
+
+	if s.lookups != 0 {
+		t.Errorf("expecting %d lookups, but got %d", 0, s.lookups)
+	}
+}
@@ -0,0 +1,280 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the format of the time added to the name of the rotated files, so they are sorted by name
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// Rotation are the options of the rotation of the log file. The zero value never rotates it
+type Rotation struct {
+	// MaxSize is the size in bytes after which the log file is rotated. If it's 0, it isn't rotated by size
+	MaxSize int64
+	// MaxAge is the duration after which the log file is rotated since it was opened. If it's 0, it isn't rotated by
+	// time
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, the oldest ones are removed. If it's 0, all of them are kept
+	MaxBackups int
+	// Compress is whether the rotated files are compressed with gzip
+	Compress bool
+}
+
+// File is a log file that is rotated by size and by time, keeping a number of rotated files. The rotated files are
+// named after the log file with the time of the rotation (e.g. urlshortener.log.20060102T150405.000000000), and they
+// are compressed and removed in the background. It can also be reopened, so it can be rotated by an external tool
+// like logrotate
+type File struct {
+	path     string
+	rotation Rotation
+
+	mux      sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+
+	// cleanup is locked while the rotated files are compressed and removed, and wg waits for it when closing
+	cleanup sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// OpenFile opens the log file, creating it if it doesn't exist. The logs are appended to it
+func OpenFile(path string, rotation Rotation) (*File, error) {
+	f := &File{
+		path:     path,
+		rotation: rotation,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes a log in the log file, rotating it before if it's needed
+func (f *File) Write(b []byte) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.needsRotation(int64(len(b))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(b)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Rotate renames the log file, adding the time to its name, and opens a new one
+func (f *File) Rotate() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.f == nil {
+		return os.ErrClosed
+	}
+
+	return f.rotate()
+}
+
+// Reopen closes the log file and opens it again. It's used when the log file has been moved by an external tool
+func (f *File) Reopen() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.f == nil {
+		return os.ErrClosed
+	}
+
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+// Close closes the log file, waiting for the rotated files to be compressed and removed
+func (f *File) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.wg.Wait()
+
+	if f.f == nil {
+		return os.ErrClosed
+	}
+
+	err := f.f.Close()
+	f.f = nil
+
+	return err
+}
+
+// open opens the log file. The mutex needs to be locked
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening the log file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening the log file: %v", err)
+	}
+
+	f.f = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+
+	return nil
+}
+
+// needsRotation returns whether the log file needs to be rotated before writing n bytes. The empty files are never
+// rotated. The mutex needs to be locked
+func (f *File) needsRotation(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if f.rotation.MaxSize > 0 && f.size+n > f.rotation.MaxSize {
+		return true
+	}
+
+	return f.rotation.MaxAge > 0 && time.Since(f.openedAt) >= f.rotation.MaxAge
+}
+
+// rotate renames the log file and opens a new one. The rotated files are compressed and removed in the background.
+// The mutex needs to be locked
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+
+	rotated := f.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(f.path, rotated); err != nil {
+		// The log file is opened again, so the logs can still be written
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+
+		return fmt.Errorf("error rotating the log file: %v", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+
+		// The errors can't be written to the log file, since it could be the cause
+		if f.rotation.Compress {
+			if err := compress(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "error compressing the rotated log file: %v\n", err)
+			}
+		}
+
+		if err := f.removeOld(); err != nil {
+			fmt.Fprintf(os.Stderr, "error removing the old rotated log files: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// removeOld removes the oldest rotated files, keeping the number of backups configured
+func (f *File) removeOld() error {
+	if f.rotation.MaxBackups <= 0 {
+		return nil
+	}
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		return err
+	}
+
+	for len(rotated) > f.rotation.MaxBackups {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+
+		rotated = rotated[1:]
+	}
+
+	return nil
+}
+
+// Rotated returns the paths of the rotated files of the log file, from the oldest to the newest
+func (f *File) Rotated() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := []string{}
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, f.path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+
+	sort.Strings(rotated)
+
+	return rotated, nil
+}
+
+// compress compresses a rotated file with gzip and removes the uncompressed one
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,167 @@
+package logging_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/logging"
+)
+
+// Should rotate the log file by size, compressing the rotated files and keeping the number of backups configured
+func TestFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshortener")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/urlshortener.log"
+	f, err := logging.OpenFile(path, logging.Rotation{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("unexpected error opening the log file: %v", err)
+	}
+
+	for _, l := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(l)); err != nil {
+			t.Fatalf("unexpected error writing the log: %v", err)
+		}
+
+		// The rotated files are named with the time of the rotation
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error closing the log file: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading the log file: %v", err)
+	}
+
+	if string(b) != "fourth\n" {
+		t.Errorf("expecting %q, but got %q", "fourth\n", b)
+	}
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		t.Fatalf("unexpected error listing the rotated files: %v", err)
+	}
+
+	if len(rotated) != 2 {
+		t.Fatalf("expecting %d rotated files, but got %v", 2, rotated)
+	}
+
+	for i, expected := range []string{"second\n", "third\n"} {
+		if !strings.HasSuffix(rotated[i], ".gz") {
+			t.Fatalf("expecting the rotated file to be compressed, but got %s", rotated[i])
+		}
+
+		gz, err := os.Open(rotated[i])
+		if err != nil {
+			t.Fatalf("error opening the rotated file: %v", err)
+		}
+
+		r, err := gzip.NewReader(gz)
+		if err != nil {
+			t.Fatalf("error decompressing the rotated file: %v", err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		gz.Close()
+		if err != nil {
+			t.Fatalf("error decompressing the rotated file: %v", err)
+		}
+
+		if string(b) != expected {
+			t.Errorf("expecting %q, but got %q", expected, b)
+		}
+	}
+}
+
+// Should rotate the log file by time
+func TestFileRotationMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshortener")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := logging.OpenFile(dir+"/urlshortener.log", logging.Rotation{MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error opening the log file: %v", err)
+	}
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatalf("unexpected error writing the log: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Fatalf("unexpected error writing the log: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error closing the log file: %v", err)
+	}
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		t.Fatalf("unexpected error listing the rotated files: %v", err)
+	}
+
+	if len(rotated) != 1 {
+		t.Errorf("expecting %d rotated files, but got %v", 1, rotated)
+	}
+}
+
+// Should write to a new log file after reopening it, when it has been moved
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlshortener")
+	if err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/urlshortener.log"
+	f, err := logging.OpenFile(path, logging.Rotation{})
+	if err != nil {
+		t.Fatalf("unexpected error opening the log file: %v", err)
+	}
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatalf("unexpected error writing the log: %v", err)
+	}
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("error preparing the test: %v", err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("unexpected error reopening the log file: %v", err)
+	}
+
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Fatalf("unexpected error writing the log: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error closing the log file: %v", err)
+	}
+
+	for p, expected := range map[string]string{path + ".1": "first\n", path: "second\n"} {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatalf("error reading the log file: %v", err)
+		}
+
+		if string(b) != expected {
+			t.Errorf("expecting %q, but got %q", expected, b)
+		}
+	}
+}
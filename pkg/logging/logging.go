@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	// FormatText is the logfmt format (e.g. time=... level=INFO msg="Starting to listen" addr=:3000)
+	FormatText = "text"
+	// FormatJSON is the JSON format, with one JSON object per line
+	FormatJSON = "json"
+)
+
+// ErrNoOutput is returned when the logs aren't written anywhere
+var ErrNoOutput = errors.New("the logs need to be written to the standard output or to a file")
+
+// Options are the options of the logger
+type Options struct {
+	// Format is the format of the logs: FormatText or FormatJSON
+	Format string
+	// Level is the minimum level of the logs written
+	Level slog.Level
+	// Stdout is whether the logs are written to the standard output
+	Stdout bool
+	// File is the path of the file where the logs are written. If it's empty, they aren't written to a file
+	File string
+	// Rotation are the options of the rotation of the log file
+	Rotation Rotation
+}
+
+// ParseLevel returns the level with the name provided: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %s, it needs to be debug, info, warn or error", name)
+	}
+
+	return l, nil
+}
+
+// Validate checks that the options are valid
+func (o Options) Validate() error {
+	if o.Format != FormatText && o.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %s, it needs to be %s or %s", o.Format, FormatText, FormatJSON)
+	}
+
+	if !o.Stdout && o.File == "" {
+		return ErrNoOutput
+	}
+
+	if o.Rotation.MaxSize < 0 || o.Rotation.MaxAge < 0 || o.Rotation.MaxBackups < 0 {
+		return errors.New("the log file rotation options can't be negative")
+	}
+
+	return nil
+}
+
+// New returns a logger that writes to the outputs configured. It also returns the log file, that is nil if the logs
+// aren't written to a file, and that needs to be closed after the last log
+func New(opts Options) (*slog.Logger, *File, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	writers := []io.Writer{}
+
+	if opts.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+
+	var f *File
+	if opts.File != "" {
+		var err error
+		if f, err = OpenFile(opts.File, opts.Rotation); err != nil {
+			return nil, nil, err
+		}
+
+		writers = append(writers, f)
+	}
+
+	return slog.New(NewHandler(io.MultiWriter(writers...), opts)), f, nil
+}
+
+// NewHandler returns the handler of the logs that writes to w with the format and the level of the options
+func NewHandler(w io.Writer, opts Options) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+
+	if opts.Format == FormatJSON {
+		return slog.NewJSONHandler(w, handlerOpts)
+	}
+
+	return slog.NewTextHandler(w, handlerOpts)
+}
@@ -0,0 +1,64 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/logging"
+)
+
+// Should write the logs with the level and the format configured
+func TestNew(t *testing.T) {
+	level, err := logging.ParseLevel("warn")
+	if err != nil {
+		t.Fatalf("unexpected error parsing the level: %v", err)
+	}
+
+	logger, f, err := logging.New(logging.Options{
+		Format: logging.FormatJSON,
+		Level:  level,
+		File:   "urlshortener.log",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating the logger: %v", err)
+	}
+
+	logger.Info("Not written")
+	logger.Warn("Written", "shortURL", "blog")
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error closing the logger: %v", err)
+	}
+
+	b, err := ioutil.ReadFile("urlshortener.log")
+	if err != nil {
+		t.Fatalf("error reading the log file: %v", err)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(b, &line); err != nil {
+		t.Fatalf("expecting a single JSON line, but got %s", b)
+	}
+
+	if line["level"] != slog.LevelWarn.String() || line["msg"] != "Written" || line["shortURL"] != "blog" {
+		t.Errorf("expecting the warning, but got %s", b)
+	}
+
+	if err := os.Remove("urlshortener.log"); err != nil {
+		t.Fatalf("error finishing the test: %v", err)
+	}
+}
+
+// Should return an error if the options aren't valid
+func TestNewErr(t *testing.T) {
+	if _, _, err := logging.New(logging.Options{Format: logging.FormatText}); err != logging.ErrNoOutput {
+		t.Errorf("expecting %v, but got %v", logging.ErrNoOutput, err)
+	}
+
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Errorf("expecting an error, but got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// namespace is the prefix of the names of all the metrics
+const namespace = "urlshortener"
+
+// Metrics are the Prometheus metrics of the URL shortener. They include the metrics of the Go runtime and the process
+type Metrics struct {
+	registry *prometheus.Registry
+
+	redirects          prometheus.Counter
+	notFound           prometheus.Counter
+	created            prometheus.Counter
+	validationFailures prometheus.Counter
+	requestDuration    *prometheus.HistogramVec
+	txDuration         *prometheus.HistogramVec
+}
+
+// New returns the metrics of the URL shortener. The number of shortened URLs is read from the store every time the
+// metrics are collected, and so is the size of the DB file if its path isn't empty
+func New(store db.Store, dbPath string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		redirects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Number of redirects to the target URLs of the shortened URLs.",
+		}),
+		notFound: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "not_found_total",
+			Help:      "Number of lookups of shortened URLs that don't exist.",
+		}),
+		created: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "links_created_total",
+			Help:      "Number of shortened URLs created, including the imported ones.",
+		}),
+		validationFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "validation_failures_total",
+			Help:      "Number of shortened URLs rejected because they aren't valid.",
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the HTTP requests served, by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		txDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bolt_transaction_duration_seconds",
+			Help:      "Duration of the transactions of the Bolt DB, by type (read or write).",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"type"}),
+	}
+
+	m.registry.MustRegister(
+		m.redirects,
+		m.notFound,
+		m.created,
+		m.validationFailures,
+		m.requestDuration,
+		m.txDuration,
+		newStoreCollector(store, dbPath),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler returns the handler that serves the metrics in the Prometheus exposition format. If a metric can't be
+// collected, the rest of them are still served
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// ObserveRequest records the duration of an HTTP request served by a route of the handler
+func (m *Metrics) ObserveRequest(route, method string, status int, d time.Duration) {
+	m.requestDuration.WithLabelValues(route, normalizeMethod(method), strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// ObserveTx records the duration of a transaction of the Bolt DB
+func (m *Metrics) ObserveTx(writable bool, d time.Duration) {
+	txType := "read"
+	if writable {
+		txType = "write"
+	}
+
+	m.txDuration.WithLabelValues(txType).Observe(d.Seconds())
+}
+
+// normalizeMethod returns the method of a request as it's used in the labels. The unknown methods are grouped, so
+// the clients can't create new series
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodOptions:
+		return method
+
+	default:
+		return "OTHER"
+	}
+}
+
+// storeCollector collects the number of shortened URLs of the store and the size of the DB file
+type storeCollector struct {
+	store  db.Store
+	dbPath string
+
+	links  *prometheus.Desc
+	dbSize *prometheus.Desc
+}
+
+// newStoreCollector returns a collector of the store. The size of the DB file isn't collected if its path is empty
+func newStoreCollector(store db.Store, dbPath string) *storeCollector {
+	return &storeCollector{
+		store:  store,
+		dbPath: dbPath,
+		links: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "links"),
+			"Number of shortened URLs in the store.",
+			nil, nil,
+		),
+		dbSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "db_size_bytes"),
+			"Size of the DB file in bytes.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.links
+
+	if c.dbPath != "" {
+		ch <- c.dbSize
+	}
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.store.Stats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.links, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.links, prometheus.GaugeValue, float64(stats.Links))
+	}
+
+	if c.dbPath == "" {
+		return
+	}
+
+	info, err := os.Stat(c.dbPath)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.dbSize, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.dbSize, prometheus.GaugeValue, float64(info.Size()))
+}
@@ -0,0 +1,112 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/metrics"
+)
+
+// scrape returns the metrics served by the handler
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	b, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("error reading the metrics: %v", err)
+	}
+
+	return string(b)
+}
+
+// Should work as expected
+func TestStore(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	m := metrics.New(d, "")
+	s := &metrics.Store{Store: d, Metrics: m}
+
+	if err := s.AddURL("test", "https://nefixestrada.com"); err != nil {
+		t.Fatalf("unexpected error adding the URL: %v", err)
+	}
+
+	if err := s.AddLink(&db.Link{ShortURL: "invalid", LongURL: "not a URL"}); err != db.ErrLongURLInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrLongURLInvalid, err)
+	}
+
+	if _, err := s.ImportLinks([]db.Link{
+		{ShortURL: "imported", LongURL: "https://gitea.nefixestrada.com"},
+		{ShortURL: "imported2", LongURL: ""},
+	}, db.ImportOptions{Conflict: db.ConflictSkip}); err != nil {
+		t.Fatalf("unexpected error importing the URLs: %v", err)
+	}
+
+	if err := s.UpdateURL("test", "not a URL"); err != db.ErrLongURLInvalid {
+		t.Errorf("expecting %v, but got %v", db.ErrLongURLInvalid, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.ReadURL("test"); err != nil {
+			t.Fatalf("unexpected error reading the URL: %v", err)
+		}
+	}
+
+	if _, err := s.ReadURL("notfound"); err != db.ErrNotFound {
+		t.Errorf("expecting %v, but got %v", db.ErrNotFound, err)
+	}
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		"urlshortener_redirects_total 2\n",
+		"urlshortener_not_found_total 1\n",
+		"urlshortener_links_created_total 2\n",
+		"urlshortener_validation_failures_total 3\n",
+		"urlshortener_links 2\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expecting %q in the metrics, but got %s", expected, body)
+		}
+	}
+}
+
+// Should work as expected
+func TestObserve(t *testing.T) {
+	d := &db.Memory{}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("error initializing the DB: %v", err)
+	}
+
+	m := metrics.New(d, "metrics_test.go")
+	m.ObserveRequest("redirect", http.MethodGet, http.StatusFound, 10*time.Millisecond)
+	m.ObserveRequest("api", "BREW", http.StatusMethodNotAllowed, time.Millisecond)
+	m.ObserveTx(true, time.Millisecond)
+	m.ObserveTx(false, time.Millisecond)
+	m.ObserveTx(false, time.Millisecond)
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`urlshortener_http_request_duration_seconds_count{code="302",method="GET",route="redirect"} 1` + "\n",
+		`urlshortener_http_request_duration_seconds_count{code="405",method="OTHER",route="api"} 1` + "\n",
+		`urlshortener_bolt_transaction_duration_seconds_count{type="write"} 1` + "\n",
+		`urlshortener_bolt_transaction_duration_seconds_count{type="read"} 2` + "\n",
+		"urlshortener_db_size_bytes ",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expecting %q in the metrics, but got %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/db"
+)
+
+// Store needs to implement the Store and AuditStore interfaces
+var _ db.Store = &Store{}
+var _ db.AuditStore = &Store{}
+
+// errNotAuditStore is returned when recording the changes in the audit log of a store that doesn't keep it
+var errNotAuditStore = errors.New("the store can't record the changes in its audit log")
+
+// Store is a Store that counts the redirects, the lookups of shortened URLs that don't exist, the shortened URLs
+// created and the ones rejected because they aren't valid
+type Store struct {
+	db.Store
+
+	// Metrics are where the events are counted
+	Metrics *Metrics
+}
+
+// ReadURL returns the target URL of a shortened URL and counts the redirect or the lookup of a shortened URL that
+// doesn't exist
+func (s *Store) ReadURL(shortURL string) (string, error) {
+	longURL, err := s.Store.ReadURL(shortURL)
+	s.countRead(err)
+
+	return longURL, err
+}
+
+// ReadRedirect returns the target URL and the redirect status of a shortened URL and counts the redirect or the
+// lookup of a shortened URL that doesn't exist
+func (s *Store) ReadRedirect(shortURL string) (string, int, error) {
+	longURL, status, err := s.Store.ReadRedirect(shortURL)
+	s.countRead(err)
+
+	return longURL, status, err
+}
+
+// AddURL adds a new shortened URL and counts its creation or its validation failure
+func (s *Store) AddURL(shortURL string, longURL string) error {
+	return s.countCreated(s.Store.AddURL(shortURL, longURL))
+}
+
+// AddLink adds a new shortened URL and counts its creation or its validation failure
+func (s *Store) AddLink(l *db.Link) error {
+	return s.countCreated(s.Store.AddLink(l))
+}
+
+// ImportLinks imports a batch of shortened URLs and counts the ones created and the ones that aren't valid. The dry
+// runs aren't counted
+func (s *Store) ImportLinks(links []db.Link, opts db.ImportOptions) ([]db.ImportResult, error) {
+	results, err := s.Store.ImportLinks(links, opts)
+	if err != nil || opts.DryRun {
+		return results, err
+	}
+
+	for _, res := range results {
+		switch res.Status {
+		case db.ImportCreated:
+			s.Metrics.created.Inc()
+
+		case db.ImportInvalid:
+			s.Metrics.validationFailures.Inc()
+		}
+	}
+
+	return results, nil
+}
+
+// FollowLink returns a shortened URL that is going to redirect and counts the redirect, or the lookup if it doesn't
+// exist
+func (s *Store) FollowLink(shortURL string) (*db.Link, error) {
+	l, err := s.Store.FollowLink(shortURL)
+	s.countRead(err)
+
+	return l, err
+}
+
+// UpdateURL changes the target URL of an existing shortened URL and counts its validation failure
+func (s *Store) UpdateURL(shortURL string, longURL string) error {
+	err := s.Store.UpdateURL(shortURL, longURL)
+	s.countInvalid(err)
+
+	return err
+}
+
+// UpdateLink changes the target URL and the redirect status of an existing shortened URL and counts its validation
+// failure
+func (s *Store) UpdateLink(shortURL string, u db.LinkUpdate) error {
+	err := s.Store.UpdateLink(shortURL, u)
+	s.countInvalid(err)
+
+	return err
+}
+
+// SetRedirectStatus changes the redirect status of an existing shortened URL and counts its validation failure
+func (s *Store) SetRedirectStatus(shortURL string, status int) error {
+	err := s.Store.SetRedirectStatus(shortURL, status)
+	s.countInvalid(err)
+
+	return err
+}
+
+// UpdateLinkAudit changes the target URL and the redirect status of an existing shortened URL, records the change in
+// the audit log and counts its validation failure
+func (s *Store) UpdateLinkAudit(shortURL string, u db.LinkUpdate, audit db.AuditFunc) error {
+	a, ok := s.Store.(db.AuditStore)
+	if !ok {
+		return errNotAuditStore
+	}
+
+	err := a.UpdateLinkAudit(shortURL, u, audit)
+	s.countInvalid(err)
+
+	return err
+}
+
+// SetDisabledAudit disables or enables an existing shortened URL and records the change in the audit log
+func (s *Store) SetDisabledAudit(shortURL string, disabled bool, audit db.AuditFunc) error {
+	a, ok := s.Store.(db.AuditStore)
+	if !ok {
+		return errNotAuditStore
+	}
+
+	return a.SetDisabledAudit(shortURL, disabled, audit)
+}
+
+// DeleteURLAudit removes a shortened URL and records its removal in the audit log
+func (s *Store) DeleteURLAudit(shortURL string, audit db.AuditFunc) error {
+	a, ok := s.Store.(db.AuditStore)
+	if !ok {
+		return errNotAuditStore
+	}
+
+	return a.DeleteURLAudit(shortURL, audit)
+}
+
+// DeleteExpiredAudit removes all the shortened URLs that have expired at the time provided and records their removal
+// in the audit log
+func (s *Store) DeleteExpiredAudit(now time.Time, audit db.AuditFunc) (int, error) {
+	a, ok := s.Store.(db.AuditStore)
+	if !ok {
+		return 0, errNotAuditStore
+	}
+
+	return a.DeleteExpiredAudit(now, audit)
+}
+
+// countRead counts the redirect if there's no error, or the lookup of a shortened URL that doesn't exist
+func (s *Store) countRead(err error) {
+	switch err {
+	case nil:
+		s.Metrics.redirects.Inc()
+
+	case db.ErrNotFound:
+		s.Metrics.notFound.Inc()
+	}
+}
+
+// countCreated counts the creation of a shortened URL if there's no error, or its validation failure
+func (s *Store) countCreated(err error) error {
+	if err == nil {
+		s.Metrics.created.Inc()
+	}
+
+	s.countInvalid(err)
+
+	return err
+}
+
+// countInvalid counts a validation failure if the error is a validation error
+func (s *Store) countInvalid(err error) {
+	if _, ok := err.(*db.ValidationError); ok {
+		s.Metrics.validationFailures.Inc()
+	}
+}
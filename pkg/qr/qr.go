@@ -0,0 +1,273 @@
+package qr
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultSize is the size in pixels of the QR codes by default
+	DefaultSize = 256
+	// DefaultLevel is the error correction level of the QR codes by default
+	DefaultLevel = "M"
+	// DefaultMargin is the margin in modules of the QR codes by default, which is the quiet zone of the standard
+	DefaultMargin = 4
+	// DefaultCacheSize is the number of QR codes kept in the cache by default
+	DefaultCacheSize = 1024
+
+	// MaxSize is the maximum size in pixels of the QR codes
+	MaxSize = 2048
+	// MaxMargin is the maximum margin in modules of the QR codes
+	MaxMargin = 32
+)
+
+// Format is the image format of a QR code
+type Format string
+
+const (
+	// FormatPNG is a PNG image
+	FormatPNG Format = "png"
+	// FormatSVG is a SVG image
+	FormatSVG Format = "svg"
+)
+
+var (
+	// ErrFormatInvalid is returned when the format isn't png or svg
+	ErrFormatInvalid = errors.New("the format of the QR code needs to be png or svg")
+
+	// ErrSizeInvalid is returned when the size is out of the limits
+	ErrSizeInvalid = fmt.Errorf("the size of the QR code needs to be between 1 and %d", MaxSize)
+
+	// ErrSizeTooSmall is returned when the size is smaller than the modules of the QR code with its margin
+	ErrSizeTooSmall = errors.New("the size of the QR code is too small for its content")
+
+	// ErrLevelInvalid is returned when the error correction level isn't L, M, Q or H
+	ErrLevelInvalid = errors.New("the error correction level of the QR code needs to be L, M, Q or H")
+
+	// ErrMarginInvalid is returned when the margin is out of the limits
+	ErrMarginInvalid = fmt.Errorf("the margin of the QR code needs to be between 0 and %d", MaxMargin)
+)
+
+// levels are the error correction levels, with the percentage of the QR code that can be restored
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options are the options of a QR code
+type Options struct {
+	// Size is the width and the height of the image, in pixels. The SVG images can be scaled without losing quality
+	Size int
+	// Level is the error correction level: L (7%), M (15%), Q (25%) or H (30%). The higher levels can be read even
+	// if the QR code is damaged, but they need more modules
+	Level string
+	// Margin is the blank space around the QR code, in modules
+	Margin int
+}
+
+// DefaultOptions returns the options of the QR codes by default
+func DefaultOptions() Options {
+	return Options{
+		Size:   DefaultSize,
+		Level:  DefaultLevel,
+		Margin: DefaultMargin,
+	}
+}
+
+// Validate checks that the options are valid. The level is compared without case
+func (o Options) Validate() error {
+	if o.Size < 1 || o.Size > MaxSize {
+		return ErrSizeInvalid
+	}
+
+	if _, ok := levels[strings.ToUpper(o.Level)]; !ok {
+		return ErrLevelInvalid
+	}
+
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return ErrMarginInvalid
+	}
+
+	return nil
+}
+
+// Encode returns the image of the QR code of the content provided
+func Encode(content string, f Format, o Options) ([]byte, error) {
+	if f != FormatPNG && f != FormatSVG {
+		return nil, ErrFormatInvalid
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	q, err := qrcode.New(content, levels[strings.ToUpper(o.Level)])
+	if err != nil {
+		return nil, err
+	}
+
+	q.DisableBorder = true
+	modules := q.Bitmap()
+
+	// The modules are drawn with the same number of pixels, and the pixels left are added to the margin
+	total := len(modules) + 2*o.Margin
+	scale := o.Size / total
+	if scale == 0 {
+		return nil, ErrSizeTooSmall
+	}
+
+	if f == FormatSVG {
+		return encodeSVG(modules, o), nil
+	}
+
+	return encodePNG(modules, o, scale)
+}
+
+// encodePNG draws the modules in a PNG image. Each module is a square of scale pixels
+func encodePNG(modules [][]bool, o Options, scale int) ([]byte, error) {
+	img := image.NewPaletted(image.Rect(0, 0, o.Size, o.Size), color.Palette{color.White, color.Black})
+
+	offset := (o.Size - len(modules)*scale) / 2
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+
+			for py := offset + y*scale; py < offset+(y+1)*scale; py++ {
+				for px := offset + x*scale; px < offset+(x+1)*scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeSVG draws the modules in a SVG image, with a unit for each module. The consecutive modules of each row are
+// drawn together, to keep the image small
+func encodeSVG(modules [][]bool, o Options) []byte {
+	total := len(modules) + 2*o.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, o.Size, o.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, total, total)
+
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+o.Margin, y+o.Margin, x-start, x-start)
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
+
+// cacheKey identifies a QR code in the cache
+type cacheKey struct {
+	content string
+	format  Format
+	options Options
+}
+
+// cacheEntry is a QR code kept in the cache
+type cacheEntry struct {
+	key   cacheKey
+	image []byte
+}
+
+// Generator generates QR codes, keeping the most recently used ones in memory, so they aren't encoded again
+type Generator struct {
+	// Defaults are the options of the QR codes when the requests don't set them
+	Defaults Options
+
+	size    int
+	mux     sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// NewGenerator returns a generator with the default options provided, that keeps up to size QR codes in memory. If
+// the size is 0, the QR codes aren't cached
+func NewGenerator(defaults Options, size int) *Generator {
+	return &Generator{
+		Defaults: defaults,
+		size:     size,
+		entries:  map[cacheKey]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// Generate returns the image of the QR code of the content provided, from the cache if it has already been generated
+func (g *Generator) Generate(content string, f Format, o Options) ([]byte, error) {
+	o.Level = strings.ToUpper(o.Level)
+	key := cacheKey{content: content, format: f, options: o}
+
+	g.mux.Lock()
+	if e, ok := g.entries[key]; ok {
+		g.lru.MoveToFront(e)
+		g.mux.Unlock()
+
+		return e.Value.(*cacheEntry).image, nil
+	}
+	g.mux.Unlock()
+
+	img, err := Encode(content, f, key.options)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.size <= 0 {
+		return img, nil
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if _, ok := g.entries[key]; !ok {
+		g.entries[key] = g.lru.PushFront(&cacheEntry{key: key, image: img})
+
+		if g.lru.Len() > g.size {
+			oldest := g.lru.Back()
+			g.lru.Remove(oldest)
+			delete(g.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+
+	return img, nil
+}
+
+// Len returns the number of QR codes in the cache
+func (g *Generator) Len() int {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	return g.lru.Len()
+}
@@ -0,0 +1,163 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"gitea.nefixestrada.com/nefix/urlshortener/pkg/qr"
+)
+
+// Should check that the options are valid
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		options  qr.Options
+		expected error
+	}{
+		{options: qr.DefaultOptions(), expected: nil},
+		{options: qr.Options{Size: 64, Level: "h", Margin: 0}, expected: nil},
+		{options: qr.Options{Size: 0, Level: "M", Margin: 4}, expected: qr.ErrSizeInvalid},
+		{options: qr.Options{Size: qr.MaxSize + 1, Level: "M", Margin: 4}, expected: qr.ErrSizeInvalid},
+		{options: qr.Options{Size: 256, Level: "X", Margin: 4}, expected: qr.ErrLevelInvalid},
+		{options: qr.Options{Size: 256, Level: "", Margin: 4}, expected: qr.ErrLevelInvalid},
+		{options: qr.Options{Size: 256, Level: "M", Margin: -1}, expected: qr.ErrMarginInvalid},
+		{options: qr.Options{Size: 256, Level: "M", Margin: qr.MaxMargin + 1}, expected: qr.ErrMarginInvalid},
+	}
+
+	for _, tt := range tests {
+		if err := tt.options.Validate(); err != tt.expected {
+			t.Errorf("expecting %v for %+v, but got %v", tt.expected, tt.options, err)
+		}
+	}
+}
+
+// Should encode the QR code as a PNG image of the size provided, with a white margin
+func TestEncodePNG(t *testing.T) {
+	b, err := qr.Encode("https://short.nefixestrada.com/go", qr.FormatPNG, qr.DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("error decoding the PNG image: %v", err)
+	}
+
+	if img.Bounds().Dx() != qr.DefaultSize || img.Bounds().Dy() != qr.DefaultSize {
+		t.Errorf("expecting %dx%d, but got %dx%d", qr.DefaultSize, qr.DefaultSize, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	white := color.GrayModel.Convert(color.White)
+	for _, p := range [][2]int{{0, 0}, {qr.DefaultSize - 1, 0}, {0, qr.DefaultSize - 1}, {qr.DefaultSize - 1, qr.DefaultSize - 1}} {
+		if c := color.GrayModel.Convert(img.At(p[0], p[1])); c != white {
+			t.Errorf("expecting %v at %v, but got %v", white, p, c)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < qr.DefaultSize; y++ {
+		for x := 0; x < qr.DefaultSize; x++ {
+			if color.GrayModel.Convert(img.At(x, y)) != white {
+				dark++
+			}
+		}
+	}
+
+	if dark == 0 {
+		t.Errorf("expecting dark modules, but got %d", dark)
+	}
+}
+
+// Should encode the QR code as a SVG image of the size provided
+func TestEncodeSVG(t *testing.T) {
+	b, err := qr.Encode("https://short.nefixestrada.com/go", qr.FormatSVG, qr.Options{Size: 512, Level: "L", Margin: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svg := string(b)
+	for _, expected := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="512" height="512" viewBox="0 0 33 33"`, `<path fill="#000" d="M2 2h7v1h-7z`, `</svg>`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("expecting %s in %s", expected, svg)
+		}
+	}
+}
+
+// Should return an error when the QR code can't be encoded
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		format   qr.Format
+		options  qr.Options
+		expected error
+	}{
+		{format: "gif", options: qr.DefaultOptions(), expected: qr.ErrFormatInvalid},
+		{format: qr.FormatPNG, options: qr.Options{Size: 256, Level: "X"}, expected: qr.ErrLevelInvalid},
+		{format: qr.FormatPNG, options: qr.Options{Size: 20, Level: "M", Margin: 4}, expected: qr.ErrSizeTooSmall},
+		{format: qr.FormatSVG, options: qr.Options{Size: 20, Level: "M", Margin: 4}, expected: qr.ErrSizeTooSmall},
+	}
+
+	for _, tt := range tests {
+		if _, err := qr.Encode("https://short.nefixestrada.com/go", tt.format, tt.options); err != tt.expected {
+			t.Errorf("expecting %v, but got %v", tt.expected, err)
+		}
+	}
+}
+
+// Should cache the QR codes generated, removing the least recently used ones
+func TestGenerator(t *testing.T) {
+	g := qr.NewGenerator(qr.DefaultOptions(), 2)
+
+	first, err := g.Generate("https://short.nefixestrada.com/go", qr.FormatPNG, g.Defaults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lower := g.Defaults
+	lower.Level = "m"
+
+	cached, err := g.Generate("https://short.nefixestrada.com/go", qr.FormatPNG, lower)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(first, cached) {
+		t.Errorf("expecting the cached QR code, but got a different one")
+	}
+
+	if g.Len() != 1 {
+		t.Errorf("expecting %d, but got %d", 1, g.Len())
+	}
+
+	for _, content := range []string{"https://short.nefixestrada.com/blog", "https://short.nefixestrada.com/docs"} {
+		if _, err := g.Generate(content, qr.FormatSVG, g.Defaults); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if g.Len() != 2 {
+		t.Errorf("expecting %d, but got %d", 2, g.Len())
+	}
+
+	if _, err := g.Generate("https://short.nefixestrada.com/go", qr.FormatPNG, qr.Options{Size: 256, Level: "X"}); err != qr.ErrLevelInvalid {
+		t.Errorf("expecting %v, but got %v", qr.ErrLevelInvalid, err)
+	}
+
+	if g.Len() != 2 {
+		t.Errorf("expecting %d, but got %d", 2, g.Len())
+	}
+}
+
+// Should not cache the QR codes when the size of the cache is 0
+func TestGeneratorNoCache(t *testing.T) {
+	g := qr.NewGenerator(qr.DefaultOptions(), 0)
+
+	if _, err := g.Generate("https://short.nefixestrada.com/go", qr.FormatPNG, g.Defaults); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if g.Len() != 0 {
+		t.Errorf("expecting %d, but got %d", 0, g.Len())
+	}
+}